@@ -0,0 +1,4 @@
+// Package feedapp implements the feed of events that happen in the application.
+// It keeps the latest events on a bounded buffer so subscribers can resume
+// from the last event they received.
+package feedapp
@@ -0,0 +1,27 @@
+package feedapp
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fernandoocampo/thepingthepong/common/logging"
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/sirupsen/logrus"
+)
+
+var log *logging.Handle
+
+// InitLog initializes log configuration for this module.
+func InitLog(data domain.LogData) {
+	var err error
+	log, err = logging.NewLogger(
+		logging.Options{
+			LogLevel:  data.Level,
+			LogFormat: data.Format,
+			LogFields: logrus.Fields{"pkg": "feedapp", "srv": "thepingthepong"},
+		})
+	if err != nil {
+		fmt.Printf("cant load feedapp logger: %v", err)
+		os.Exit(1)
+	}
+}
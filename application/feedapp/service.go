@@ -0,0 +1,169 @@
+package feedapp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+const (
+	// DefaultCapacity is the number of events kept to resume subscriptions when it is not configured
+	DefaultCapacity = 256
+
+	// MatchCompletedEvent is published with the report of every finished match
+	MatchCompletedEvent = "match.completed"
+	// PlayerCreatedEvent is published with every new player
+	PlayerCreatedEvent = "player.created"
+	// PlayerUpdatedEvent is published with every player whose data changed or that was
+	// archived, e.g. the wins, losses and rating of both players after a match
+	PlayerUpdatedEvent = "player.updated"
+	// TournamentFinishedEvent is reserved for the end of a tournament, it can be subscribed
+	// but it is not published until there are tournaments
+	TournamentFinishedEvent = "tournament.finished"
+)
+
+// Event is something that happened in the application.
+type Event struct {
+	ID      uint64      `json:"id"`      // sequential id, the first event is 1
+	Type    string      `json:"type"`    // kind of event, e.g. match.completed
+	Created time.Time   `json:"created"` // when the event happened
+	Data    interface{} `json:"data"`    // the match or player of the event
+}
+
+// FeedService defines behavior to publish events and follow them.
+type FeedService interface {
+	// Publish adds an event of the given type and data to the feed.
+	Publish(eventType string, data interface{}) Event
+	// Subscribe follows the events published after the given event ID, zero means
+	// every event still kept in the feed.
+	Subscribe(lastEventID uint64) *Subscriber
+}
+
+// ringFeed implements the feed service on a ring buffer of the latest events.
+type ringFeed struct {
+	mu      sync.Mutex
+	events  []Event // ring buffer, the oldest event is at start
+	start   int
+	count   int
+	nextID  uint64
+	changed chan struct{} // closed and replaced every time an event is published
+}
+
+// NewRingFeed creates a feed that keeps the given number of latest events.
+func NewRingFeed(capacity int) FeedService {
+	log.Infof("creating ring feed with capacity: %d", capacity)
+	if capacity < 1 {
+		capacity = DefaultCapacity
+	}
+	return &ringFeed{
+		events:  make([]Event, capacity),
+		nextID:  1,
+		changed: make(chan struct{}),
+	}
+}
+
+// Publish adds an event of the given type and data to the feed, overwriting the
+// oldest event if the feed is full.
+func (r *ringFeed) Publish(eventType string, data interface{}) Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event := Event{
+		ID:      r.nextID,
+		Type:    eventType,
+		Created: time.Now(),
+		Data:    data,
+	}
+	r.nextID++
+	if r.count < len(r.events) {
+		r.events[(r.start+r.count)%len(r.events)] = event
+		r.count++
+	} else {
+		r.events[r.start] = event
+		r.start = (r.start + 1) % len(r.events)
+	}
+	log.Debugf("publishing event %d of type %q", event.ID, event.Type)
+	close(r.changed)
+	r.changed = make(chan struct{})
+	return event
+}
+
+// Subscribe follows the events published after the given event ID. An ID the feed
+// never published, e.g. from before a restart, means every event still kept.
+func (r *ringFeed) Subscribe(lastEventID uint64) *Subscriber {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lastEventID >= r.nextID {
+		log.Infof("event %d was never published, subscribing from the oldest event", lastEventID)
+		lastEventID = 0
+	}
+	return &Subscriber{feed: r, lastID: lastEventID}
+}
+
+// next returns the event after the given ID, or the oldest kept event if that one
+// was overwritten, and a channel closed when a new event is published.
+func (r *ringFeed) next(lastID uint64) (Event, bool, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	oldestID := r.nextID - uint64(r.count)
+	if lastID+1 < oldestID {
+		log.Infof("events from %d to %d were overwritten", lastID+1, oldestID-1)
+		lastID = oldestID - 1
+	}
+	if lastID+1 >= r.nextID {
+		return Event{}, false, r.changed
+	}
+	index := (r.start + int(lastID+1-oldestID)) % len(r.events)
+	return r.events[index], true, nil
+}
+
+// Subscriber follows the events of a feed.
+type Subscriber struct {
+	feed   *ringFeed
+	lastID uint64
+}
+
+// Next waits for the next event of the feed. It returns false when the context is done.
+func (s *Subscriber) Next(ctx context.Context) (Event, bool) {
+	for {
+		event, ok, changed := s.feed.next(s.lastID)
+		if ok {
+			s.lastID = event.ID
+			return event, true
+		}
+		select {
+		case <-ctx.Done():
+			return Event{}, false
+		case <-changed:
+		}
+	}
+}
+
+// Subscribe publishes on the feed the events of the bus that subscribers of the feed
+// follow: new players, updated players and finished matches. Events published inside a
+// transaction reach the feed once it is committed.
+func Subscribe(bus domain.EventBus, feed FeedService) {
+	bus.Subscribe(domain.PlayerCreatedEvent, func(ctx context.Context, event domain.Event) error {
+		player := event.(domain.PlayerCreated).Player
+		domain.AfterCommit(ctx, func() { feed.Publish(PlayerCreatedEvent, player) })
+		return nil
+	})
+	bus.Subscribe(domain.StatisticsUpdatedEvent, func(ctx context.Context, event domain.Event) error {
+		player := event.(domain.StatisticsUpdated).Player
+		domain.AfterCommit(ctx, func() { feed.Publish(PlayerUpdatedEvent, player) })
+		return nil
+	})
+	bus.Subscribe(domain.PlayerUpdatedEvent, func(ctx context.Context, event domain.Event) error {
+		player := event.(domain.PlayerUpdated).Player
+		domain.AfterCommit(ctx, func() { feed.Publish(PlayerUpdatedEvent, player) })
+		return nil
+	})
+	bus.Subscribe(domain.MatchPlayedEvent, func(ctx context.Context, event domain.Event) error {
+		match := event.(domain.MatchPlayed).Match
+		// subscribers want the result, the narrative is too long to keep on the feed
+		match.Narrative, match.Events = nil, nil
+		domain.AfterCommit(ctx, func() { feed.Publish(MatchCompletedEvent, match) })
+		return nil
+	})
+}
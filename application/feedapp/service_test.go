@@ -0,0 +1,128 @@
+package feedapp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/application/feedapp"
+	"github.com/fernandoocampo/thepingthepong/application/matchapp"
+	"github.com/fernandoocampo/thepingthepong/application/playerapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+)
+
+func TestSubscribeAfterLastEvent(t *testing.T) {
+	// given
+	feed := feedapp.NewRingFeed(3)
+	for i := 0; i < 5; i++ {
+		feed.Publish(feedapp.PlayerCreatedEvent, i)
+	}
+	cases := map[string]struct {
+		lastEventID uint64
+		want        []uint64
+	}{
+		"from the beginning":        {lastEventID: 0, want: []uint64{3, 4, 5}},
+		"after a kept event":        {lastEventID: 3, want: []uint64{4, 5}},
+		"after an overwritten one":  {lastEventID: 1, want: []uint64{3, 4, 5}},
+		"after the last event":      {lastEventID: 5, want: nil},
+		"after an unknown event id": {lastEventID: 42, want: []uint64{3, 4, 5}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// when
+			got := receiveEvents(feed.Subscribe(c.lastEventID))
+			// then
+			if len(got) != len(c.want) {
+				t.Fatalf("events %v were expected, but got: %v", c.want, got)
+			}
+			for index, id := range c.want {
+				if got[index] != id {
+					t.Errorf("events %v were expected, but got: %v", c.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriberWaitsForNewEvents(t *testing.T) {
+	// given
+	feed := feedapp.NewRingFeed(10)
+	subscriber := feed.Subscribe(0)
+	// when
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		feed.Publish(feedapp.PlayerCreatedEvent, "Ma Long")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, ok := subscriber.Next(ctx)
+	// then
+	if !ok || got.ID != 1 || got.Type != feedapp.PlayerCreatedEvent {
+		t.Errorf("the first event was expected, but got: %+v", got)
+	}
+}
+
+func TestSubscribePublishOnFeed(t *testing.T) {
+	// given
+	feed := feedapp.NewRingFeed(10)
+	bus := domain.NewEventBus()
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerServiceWithBus(&repo, bus)
+	matchService := matchapp.NewBasicMatchServiceWithBus(playerService, domain.MatchSetting{}, bus, repo, nil)
+	bus.Subscribe(domain.MatchPlayedEvent, playerapp.StatisticsHandler(playerService))
+	feedapp.Subscribe(bus, feed)
+	ctx := context.TODO()
+	// when
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	_, err = matchService.Play(ctx, player1ID, player2ID)
+	assertNoError(t, err)
+	// then
+	want := []string{
+		feedapp.PlayerCreatedEvent,
+		feedapp.PlayerCreatedEvent,
+		feedapp.PlayerUpdatedEvent,
+		feedapp.PlayerUpdatedEvent,
+		feedapp.MatchCompletedEvent,
+	}
+	subscriber := feed.Subscribe(0)
+	var updated []domain.Player
+	for index, eventType := range want {
+		got, ok := subscriber.Next(ctx)
+		if !ok || got.Type != eventType {
+			t.Fatalf("event %d must be %q, but got: %+v", index+1, eventType, got)
+		}
+		if got.Type == feedapp.PlayerUpdatedEvent {
+			updated = append(updated, got.Data.(domain.Player))
+		}
+	}
+	// and the updated players carry the rating points the winner took from the loser
+	if updated[0].Rating+updated[1].Rating != 2*domain.DefaultRating || updated[0].Rating == domain.DefaultRating {
+		t.Errorf("the ratings of the players were expected to change, but got: %d and %d", updated[0].Rating, updated[1].Rating)
+	}
+	last := feed.Publish("test", nil)
+	if last.ID != uint64(len(want)+1) {
+		t.Errorf("%d events were expected on the feed, but got: %d", len(want), last.ID-1)
+	}
+}
+
+// receiveEvents returns the ids of the events the subscriber receives without waiting.
+func receiveEvents(subscriber *feedapp.Subscriber) []uint64 {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var result []uint64
+	for event, ok := subscriber.Next(ctx); ok; event, ok = subscriber.Next(ctx) {
+		result = append(result, event.ID)
+	}
+	return result
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("error was not expected, but: %s", err)
+	}
+}
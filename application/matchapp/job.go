@@ -0,0 +1,248 @@
+package matchapp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// JobStatus defines the state of a match job.
+type JobStatus string
+
+const (
+	// JobQueued is a job waiting for a worker
+	JobQueued JobStatus = "queued"
+	// JobRunning is a job whose match is being played
+	JobRunning JobStatus = "running"
+	// JobDone is a job whose match was played, its result contains the report
+	JobDone JobStatus = "done"
+	// JobFailed is a job whose match could not be played
+	JobFailed JobStatus = "failed"
+	// JobCancelled is a job cancelled while it was queued
+	JobCancelled JobStatus = "cancelled"
+
+	// DefaultJobWorkers is the number of workers playing match jobs when it is not configured
+	DefaultJobWorkers = 4
+	// DefaultJobQueue is the number of jobs that can wait for a worker when it is not configured
+	DefaultJobQueue = 100
+	// DefaultJobTimeout is how long a match job can be played when it is not configured
+	DefaultJobTimeout = time.Minute
+	// DefaultJobRetention is how long a finished job can be queried when it is not configured
+	DefaultJobRetention = time.Hour
+)
+
+var (
+	// ErrJobNotFound is returned when there is no job with the given ID
+	ErrJobNotFound = errors.New("match job not found")
+	// ErrJobQueueFull is returned when a job is submitted and every place in the queue is taken
+	ErrJobQueueFull = errors.New("match job queue is full")
+	// ErrJobNotQueued is returned when a job that is no longer queued is cancelled
+	ErrJobNotQueued = errors.New("match job is not queued")
+)
+
+// MatchJob contains the state of a match played in background.
+type MatchJob struct {
+	ID          domain.Key          `json:"id"`
+	Status      JobStatus           `json:"status"`
+	Player1ID   domain.Key          `json:"player1ID"`
+	Player2ID   domain.Key          `json:"player2ID"`
+	Competition string              `json:"competition,omitempty"`
+	Result      *domain.MatchReport `json:"result,omitempty"` // report of the match once it is done
+	Error       string              `json:"error,omitempty"`  // why the match failed
+	Created     time.Time           `json:"created"`
+	Updated     time.Time           `json:"updated"`
+}
+
+// jobRecord contains a job and the setup of its match.
+type jobRecord struct {
+	job   MatchJob
+	setup MatchSetup
+}
+
+// matchJobs contains the jobs and the queue the workers take them from. The queue is
+// closed, and no job is queued, once the jobs are closed.
+type matchJobs struct {
+	mu      sync.Mutex
+	records map[domain.Key]*jobRecord
+	queue   chan domain.Key
+	start   sync.Once
+	working sync.WaitGroup // workers taking jobs from the queue
+	closed  bool
+}
+
+func newMatchJobs(queue int) *matchJobs {
+	return &matchJobs{
+		records: make(map[domain.Key]*jobRecord),
+		queue:   make(chan domain.Key, queue),
+	}
+}
+
+// find returns a copy of the job with the given id.
+func (m *matchJobs) find(jobID domain.Key) (MatchJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[jobID]
+	if !ok {
+		return MatchJob{}, false
+	}
+	return record.job, true
+}
+
+// update changes the job with the given id and returns a copy of it, it returns false if
+// there is no job with that id.
+func (m *matchJobs) update(jobID domain.Key, change func(job *MatchJob)) (MatchJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[jobID]
+	if !ok {
+		return MatchJob{}, false
+	}
+	change(&record.job)
+	record.job.Updated = time.Now()
+	return record.job, true
+}
+
+// take marks the queued job as running and returns its setup, it returns false if the
+// job was cancelled while it was queued or it no longer exists.
+func (m *matchJobs) take(jobID domain.Key) (MatchSetup, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[jobID]
+	if !ok || record.job.Status != JobQueued {
+		return MatchSetup{}, false
+	}
+	record.job.Status = JobRunning
+	record.job.Updated = time.Now()
+	return record.setup, true
+}
+
+func (m *matchJobs) remove(jobID domain.Key) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, jobID)
+}
+
+// close refuses new jobs and waits for the workers to take the queued ones, which fail
+// once the matches played in background are cancelled.
+func (m *matchJobs) close() {
+	// workers cannot start once the jobs are closed
+	m.start.Do(func() {})
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+	m.working.Wait()
+}
+
+// Submit queues a match with the given setup to be played by a worker and returns its job.
+// The setup is validated when the match is played, so errors are reported by the job.
+// Jobs are refused with ErrMatchServiceClosed once the service is closed.
+func (b *basicMatchService) Submit(ctx context.Context, setup MatchSetup) (MatchJob, error) {
+	log.Infof("submitting a match job between %q and %q", setup.Player1ID, setup.Player2ID)
+	b.jobs.start.Do(b.startWorkers)
+	now := time.Now()
+	job := MatchJob{
+		ID:          domain.GenerateUUIDKey(),
+		Status:      JobQueued,
+		Player1ID:   setup.Player1ID,
+		Player2ID:   setup.Player2ID,
+		Competition: setup.Competition,
+		Created:     now,
+		Updated:     now,
+	}
+	b.jobs.mu.Lock()
+	defer b.jobs.mu.Unlock()
+	if b.jobs.closed {
+		log.Warnf("match job between %q and %q cannot be queued: %s", setup.Player1ID, setup.Player2ID, ErrMatchServiceClosed)
+		return MatchJob{}, ErrMatchServiceClosed
+	}
+	select {
+	case b.jobs.queue <- job.ID:
+	default:
+		log.Warnf("match job between %q and %q cannot be queued: %s", setup.Player1ID, setup.Player2ID, ErrJobQueueFull)
+		return MatchJob{}, ErrJobQueueFull
+	}
+	b.jobs.records[job.ID] = &jobRecord{job: job, setup: setup}
+	log.Infof("match job %q queued", job.ID)
+	return job, nil
+}
+
+// FindJob finds a match job by id.
+func (b *basicMatchService) FindJob(ctx context.Context, jobID domain.Key) (MatchJob, error) {
+	log.Infof("finding match job with id: %s", jobID)
+	job, ok := b.jobs.find(jobID)
+	if !ok {
+		return MatchJob{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// CancelJob cancels a match job that is still queued and returns it.
+func (b *basicMatchService) CancelJob(ctx context.Context, jobID domain.Key) (MatchJob, error) {
+	log.Infof("cancelling match job with id: %s", jobID)
+	b.jobs.mu.Lock()
+	defer b.jobs.mu.Unlock()
+	record, ok := b.jobs.records[jobID]
+	if !ok {
+		return MatchJob{}, ErrJobNotFound
+	}
+	if record.job.Status != JobQueued {
+		log.Infof("match job %q cannot be cancelled because it is %s", jobID, record.job.Status)
+		return record.job, ErrJobNotQueued
+	}
+	record.job.Status = JobCancelled
+	record.job.Updated = time.Now()
+	// the job is still queued, the worker that skips it schedules its removal
+	return record.job, nil
+}
+
+// startWorkers starts the workers that play the queued jobs until the jobs are closed.
+func (b *basicMatchService) startWorkers() {
+	log.Infof("starting %d match job workers", b.setting.JobWorkers)
+	b.jobs.working.Add(b.setting.JobWorkers)
+	for i := 0; i < b.setting.JobWorkers; i++ {
+		go func() {
+			defer b.jobs.working.Done()
+			for jobID := range b.jobs.queue {
+				b.playJob(jobID)
+			}
+		}()
+	}
+}
+
+// playJob plays the match of the given job and stores its result.
+func (b *basicMatchService) playJob(jobID domain.Key) {
+	setup, ok := b.jobs.take(jobID)
+	if !ok {
+		log.Infof("match job %q was cancelled", jobID)
+		b.scheduleJobRemoval(jobID)
+		return
+	}
+	defer b.scheduleJobRemoval(jobID)
+	ctx, cancel := context.WithTimeout(b.ctx, b.setting.JobTimeout)
+	defer cancel()
+	match, err := b.PlayMatch(ctx, setup)
+	b.jobs.update(jobID, func(job *MatchJob) {
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = JobDone
+		job.Result = match
+	})
+	log.Infof("match job %q finished", jobID)
+}
+
+// scheduleJobRemoval removes the given finished job after the retention.
+func (b *basicMatchService) scheduleJobRemoval(jobID domain.Key) {
+	time.AfterFunc(b.setting.JobRetention, func() {
+		log.Infof("match job %q can no longer be queried", jobID)
+		b.jobs.remove(jobID)
+	})
+}
@@ -0,0 +1,298 @@
+package matchapp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// Pacing defines how fast the events of a live match are streamed to the spectators.
+type Pacing string
+
+const (
+	// RealTimePacing streams the events at the pace of the virtual clock of the match
+	RealTimePacing Pacing = "realtime"
+	// AcceleratedPacing streams the events with a virtual clock running faster
+	AcceleratedPacing Pacing = "accelerated"
+	// InstantPacing streams the events as soon as they are played
+	InstantPacing Pacing = "instant"
+	// DefaultLivePacing is the pacing used when neither the request nor the setting has one
+	DefaultLivePacing = AcceleratedPacing
+	// DefaultLiveAcceleration is how many times faster an accelerated match is streamed
+	DefaultLiveAcceleration = 10
+	// DefaultLiveRetention is how long a finished live match can still be followed
+	DefaultLiveRetention = time.Minute
+	// DefaultLiveMatches is the number of live matches that can be played at the same time
+	DefaultLiveMatches = 100
+	// DefaultLiveHistory is the number of latest messages of a live match kept for the
+	// spectators who join late
+	DefaultLiveHistory = 1000
+)
+
+const (
+	// EventMessage is the type of the messages with an event of the match
+	EventMessage = "event"
+	// SummaryMessage is the type of the last message, with the report of the match
+	SummaryMessage = "summary"
+	// ErrorMessage is the type of the last message when the match could not be finished
+	ErrorMessage = "error"
+)
+
+var (
+	// ErrLiveMatchNotFound is returned when there is no live match with the given ID
+	ErrLiveMatchNotFound = errors.New("live match not found")
+	// ErrLiveMatchesFull is returned when a live match starts and the maximum of them is being played
+	ErrLiveMatchesFull = errors.New("too many live matches are being played")
+	// ErrMatchServiceClosed is returned when a live match or a match job starts once the
+	// service is closed
+	ErrMatchServiceClosed = errors.New("match service is closed")
+)
+
+// LiveMessage is every message streamed to the spectators of a live match.
+type LiveMessage struct {
+	Type    string              `json:"type"`
+	Event   *domain.MatchEvent  `json:"event,omitempty"`
+	Summary *domain.MatchReport `json:"summary,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// liveMatch keeps the latest messages of a match being played in a ring, so spectators
+// who join late receive the match from the oldest message kept.
+type liveMatch struct {
+	mu        sync.Mutex
+	messages  []LiveMessage // the message with sequence n is at n modulo its capacity
+	published int           // number of messages published since the match began
+	finished  bool
+	changed   chan struct{} // closed and replaced every time a message is published
+}
+
+func newLiveMatch(history int) *liveMatch {
+	return &liveMatch{
+		messages: make([]LiveMessage, 0, history),
+		changed:  make(chan struct{}),
+	}
+}
+
+// publish adds a message, replacing the oldest one when the history is full, and wakes
+// up the spectators waiting for it. The last message finishes the match.
+func (l *liveMatch) publish(message LiveMessage, last bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.messages) < cap(l.messages) {
+		l.messages = append(l.messages, message)
+	} else {
+		l.messages[l.published%cap(l.messages)] = message
+	}
+	l.published++
+	l.finished = last
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Spectator follows the messages of a live match from the oldest one kept.
+type Spectator struct {
+	match *liveMatch
+	next  int
+}
+
+// Next waits for the next message of the match, the messages replaced in the history
+// before the spectator read them are skipped. It returns false when the match is
+// finished and every message was read or when the context is done.
+func (s *Spectator) Next(ctx context.Context) (LiveMessage, bool) {
+	for {
+		s.match.mu.Lock()
+		if s.next < s.match.published {
+			s.next = max(s.next, s.match.published-len(s.match.messages))
+			message := s.match.messages[s.next%cap(s.match.messages)]
+			s.next++
+			s.match.mu.Unlock()
+			return message, true
+		}
+		finished, changed := s.match.finished, s.match.changed
+		s.match.mu.Unlock()
+		if finished {
+			return LiveMessage{}, false
+		}
+		select {
+		case <-ctx.Done():
+			return LiveMessage{}, false
+		case <-changed:
+		}
+	}
+}
+
+// liveMatches contains the live matches that can be followed by ID and limits how many
+// of them are played at the same time.
+type liveMatches struct {
+	mu      sync.Mutex
+	matches map[domain.Key]*liveMatch
+	playing sync.WaitGroup
+	count   int // matches being played
+	limit   int
+	history int
+	closed  bool
+}
+
+func newLiveMatches(limit, history int) *liveMatches {
+	return &liveMatches{
+		matches: make(map[domain.Key]*liveMatch),
+		limit:   limit,
+		history: history,
+	}
+}
+
+// start adds a live match that is being played, it returns ErrLiveMatchesFull when the
+// limit of matches are being played and ErrMatchServiceClosed once they are closed.
+func (l *liveMatches) start(matchID domain.Key) (*liveMatch, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, ErrMatchServiceClosed
+	}
+	if l.count >= l.limit {
+		return nil, ErrLiveMatchesFull
+	}
+	match := newLiveMatch(l.history)
+	l.matches[matchID] = match
+	l.count++
+	l.playing.Add(1)
+	return match, nil
+}
+
+// finish tells that a live match is no longer played, it can still be followed.
+func (l *liveMatches) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count--
+	l.playing.Done()
+}
+
+// close refuses new live matches and waits for the ones being played to finish.
+func (l *liveMatches) close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.playing.Wait()
+}
+
+func (l *liveMatches) find(matchID domain.Key) (*liveMatch, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	match, ok := l.matches[matchID]
+	return match, ok
+}
+
+func (l *liveMatches) remove(matchID domain.Key) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.matches, matchID)
+}
+
+// PlayLive starts a match with the given setup in background and returns its ID, so
+// spectators can follow it while it is played at the given pacing. An empty pacing
+// means the configured one.
+func (b *basicMatchService) PlayLive(ctx context.Context, setup MatchSetup, pacing Pacing) (domain.Key, error) {
+	log.Infof("the live match between %q and %q has began", setup.Player1ID, setup.Player2ID)
+	wait, err := b.pacer(pacing)
+	if err != nil {
+		return "", err
+	}
+	format, err := b.competitionFormat(setup.Competition)
+	if err != nil {
+		return "", err
+	}
+	player1, player2, err := b.findPlayers(ctx, setup)
+	if err != nil {
+		return "", err
+	}
+	matchID := domain.GenerateUUIDKey()
+	live, err := b.live.start(matchID)
+	if err != nil {
+		log.Warnf("live match between %q and %q cannot be played: %s", setup.Player1ID, setup.Player2ID, err)
+		return "", err
+	}
+	// spectators already received the events, so the summary doesn't repeat them
+	settings := setup.settings(format)
+	settings.Quiet = true
+	go b.playLive(matchID, live, player1, player2, settings, wait)
+	return matchID, nil
+}
+
+// playLive plays the match publishing its events as they happen, after waiting the
+// time between them given by the pacing.
+func (b *basicMatchService) playLive(matchID domain.Key, live *liveMatch, player1, player2 domain.Player, settings domain.MatchSettings, wait func(context.Context, time.Duration)) {
+	// the match keeps being played after the request that started it finishes, until
+	// the service is closed
+	ctx := b.ctx
+	defer func() {
+		b.live.finish()
+		time.AfterFunc(b.setting.LiveRetention, func() {
+			log.Infof("live match %q can no longer be followed", matchID)
+			b.live.remove(matchID)
+		})
+	}()
+	var last time.Duration
+	settings.Observer = func(event domain.MatchEvent) {
+		wait(ctx, event.Elapsed-last)
+		last = event.Elapsed
+		live.publish(LiveMessage{Type: EventMessage, Event: &event}, false)
+	}
+	match, err := domain.SimulateMatchContext(ctx, player1, player2, settings)
+	if err != nil {
+		log.Errorf("live match %q between %q and %q cannot be played because: %s", matchID, player1.ID, player2.ID, err.Error())
+		live.publish(LiveMessage{Type: ErrorMessage, Error: err.Error()}, true)
+		return
+	}
+	match.ID = matchID
+	if err := b.matchCompleted(ctx, match); err != nil {
+		live.publish(LiveMessage{Type: ErrorMessage, Error: err.Error()}, true)
+		return
+	}
+	live.publish(LiveMessage{Type: SummaryMessage, Summary: match}, true)
+}
+
+// Follow subscribes a spectator to the live match with the given ID.
+func (b *basicMatchService) Follow(ctx context.Context, matchID domain.Key) (*Spectator, error) {
+	log.Infof("following live match %q", matchID)
+	live, ok := b.live.find(matchID)
+	if !ok {
+		log.Infof("live match %q does not exist", matchID)
+		return nil, ErrLiveMatchNotFound
+	}
+	return &Spectator{match: live}, nil
+}
+
+// pacer returns a function that waits the time between two events of a live match
+// with the given pacing, or until the context is done.
+func (b *basicMatchService) pacer(pacing Pacing) (func(context.Context, time.Duration), error) {
+	if pacing == "" {
+		pacing = Pacing(b.setting.LivePacing)
+	}
+	switch Pacing(strings.ToLower(string(pacing))) {
+	case RealTimePacing:
+		return sleep, nil
+	case AcceleratedPacing:
+		acceleration := time.Duration(b.setting.LiveAcceleration)
+		return func(ctx context.Context, elapsed time.Duration) {
+			sleep(ctx, elapsed/acceleration)
+		}, nil
+	case InstantPacing:
+		return func(context.Context, time.Duration) {}, nil
+	}
+	log.Infof("pacing %q is not valid", pacing)
+	return nil, errors.Wrapf(ErrInvalidMatch, "pacing %q is not valid", pacing)
+}
+
+// sleep waits the given time or until the context is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
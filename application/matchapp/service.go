@@ -2,6 +2,8 @@ package matchapp
 
 import (
 	"context"
+	"runtime"
+	"strings"
 
 	"github.com/fernandoocampo/thepingthepong/application/playerapp"
 	"github.com/fernandoocampo/thepingthepong/domain"
@@ -12,41 +14,273 @@ import (
 type MatchService interface {
 	// Play simulates a match between player1 and player2 and returns a narrative about the event.
 	Play(ctx context.Context, player1ID, player2ID domain.Key) (*domain.MatchReport, error)
+	// PlayMatch simulates a match with the given setup and returns a narrative about the event.
+	PlayMatch(ctx context.Context, setup MatchSetup) (*domain.MatchReport, error)
+	// Preview estimates the outcome of a match with the given setup without playing it.
+	Preview(ctx context.Context, setup MatchSetup) (*domain.MatchPreview, error)
+	// PlayLive starts a match with the given setup in background and returns its ID, so
+	// spectators can follow it while it is played at the given pacing.
+	PlayLive(ctx context.Context, setup MatchSetup, pacing Pacing) (domain.Key, error)
+	// Follow subscribes a spectator to the live match with the given ID.
+	Follow(ctx context.Context, matchID domain.Key) (*Spectator, error)
+	// Submit queues a match with the given setup to be played in background and returns its job.
+	Submit(ctx context.Context, setup MatchSetup) (MatchJob, error)
+	// FindJob finds a match job by id.
+	FindJob(ctx context.Context, jobID domain.Key) (MatchJob, error)
+	// CancelJob cancels a match job that is still queued.
+	CancelJob(ctx context.Context, jobID domain.Key) (MatchJob, error)
+	// Close cancels the matches played in background and waits for them.
+	Close() error
+}
+
+// ErrInvalidMatch is returned when a match is requested with tactics, a competition or a
+// pacing that are not valid.
+var ErrInvalidMatch = errors.New("match is not valid")
+
+const (
+	// DefaultPreviewSimulations is the number of matches simulated to preview a match
+	// when it is not configured.
+	DefaultPreviewSimulations = 1000
+)
+
+// MatchSetup contains the players and the tactics their managers submitted for a match.
+// An empty competition means the match is played with the default format.
+type MatchSetup struct {
+	Player1ID, Player2ID           domain.Key
+	Player1Tactics, Player2Tactics domain.Tactics
+	Competition                    string
+}
+
+// NewMatchSetup builds a match setup where both players use default tactics.
+func NewMatchSetup(player1ID, player2ID domain.Key) *MatchSetup {
+	return &MatchSetup{
+		Player1ID:      player1ID,
+		Player2ID:      player2ID,
+		Player1Tactics: domain.DefaultTactics(),
+		Player2Tactics: domain.DefaultTactics(),
+	}
+}
+
+// settings converts the setup into the settings used by the match engine.
+func (m MatchSetup) settings(format domain.MatchFormat) domain.MatchSettings {
+	return domain.MatchSettings{
+		Player1Tactics: m.Player1Tactics,
+		Player2Tactics: m.Player2Tactics,
+		Format:         format,
+	}
 }
 
 // basicMatchService implements the Match service.
 type basicMatchService struct {
 	playerService playerapp.PlayerService
+	setting       domain.MatchSetting
+	bus           domain.EventBus
+	transactor    domain.Transactor
+	matches       domain.MatchRepository
+	live          *liveMatches
+	jobs          *matchJobs
+	ctx           context.Context // context of the matches played in background
+	cancel        context.CancelFunc
 }
 
 // NewBasicMatchService build a basic implementation for matchservice.
 func NewBasicMatchService(playerService playerapp.PlayerService) MatchService {
-	log.Info("creating basic player service")
+	return NewBasicMatchServiceWithSetting(playerService, domain.MatchSetting{})
+}
+
+// NewBasicMatchServiceWithSetting build a basic implementation for matchservice with the
+// given setting, missing values are replaced with defaults. The statistics of the players
+// are updated after every match, but the reports of the matches are not stored.
+func NewBasicMatchServiceWithSetting(playerService playerapp.PlayerService, setting domain.MatchSetting) MatchService {
+	bus := domain.NewEventBus()
+	bus.Subscribe(domain.MatchPlayedEvent, playerapp.StatisticsHandler(playerService))
+	return NewBasicMatchServiceWithBus(playerService, setting, bus, domain.NoTransactor(), nil)
+}
+
+// NewBasicMatchServiceWithBus build a basic implementation for matchservice with the
+// given setting that stores the report of every played match on the given repository
+// and publishes it on the given bus, whose subscribers are in charge of updating the
+// statistics and ratings of the players. The report is stored and the synchronous
+// subscribers run in a transaction of the given transactor, so their changes are all
+// applied or none is. Reports are not stored if the repository is nil.
+func NewBasicMatchServiceWithBus(playerService playerapp.PlayerService, setting domain.MatchSetting, bus domain.EventBus, transactor domain.Transactor, matches domain.MatchRepository) MatchService {
+	log.Info("creating basic match service")
+	if setting.PreviewSimulations < 1 {
+		setting.PreviewSimulations = DefaultPreviewSimulations
+	}
+	if setting.PreviewWorkers < 1 {
+		setting.PreviewWorkers = runtime.NumCPU()
+	}
+	if setting.LivePacing == "" {
+		setting.LivePacing = string(DefaultLivePacing)
+	}
+	if setting.LiveAcceleration < 1 {
+		setting.LiveAcceleration = DefaultLiveAcceleration
+	}
+	if setting.LiveRetention <= 0 {
+		setting.LiveRetention = DefaultLiveRetention
+	}
+	if setting.LiveMatches < 1 {
+		setting.LiveMatches = DefaultLiveMatches
+	}
+	if setting.LiveHistory < 1 {
+		setting.LiveHistory = DefaultLiveHistory
+	}
+	if setting.JobWorkers < 1 {
+		setting.JobWorkers = DefaultJobWorkers
+	}
+	if setting.JobQueue < 1 {
+		setting.JobQueue = DefaultJobQueue
+	}
+	if setting.JobTimeout <= 0 {
+		setting.JobTimeout = DefaultJobTimeout
+	}
+	if setting.JobRetention <= 0 {
+		setting.JobRetention = DefaultJobRetention
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &basicMatchService{
 		playerService: playerService,
+		setting:       setting,
+		bus:           bus,
+		transactor:    transactor,
+		matches:       matches,
+		live:          newLiveMatches(setting.LiveMatches, setting.LiveHistory),
+		jobs:          newMatchJobs(setting.JobQueue),
+		ctx:           ctx,
+		cancel:        cancel,
 	}
 }
 
+// Close cancels the live matches and the match jobs being played and waits for them to
+// finish, new live matches and jobs are refused.
+func (b *basicMatchService) Close() error {
+	log.Info("closing basic match service")
+	b.cancel()
+	b.live.close()
+	b.jobs.close()
+	return nil
+}
+
 // Play simulates a match between player1 and player2 and returns a narrative about the event.
 func (b *basicMatchService) Play(ctx context.Context, player1ID, player2ID domain.Key) (*domain.MatchReport, error) {
-	log.Infof("the match between %q and %q has began", player1ID, player2ID)
+	return b.PlayMatch(ctx, *NewMatchSetup(player1ID, player2ID))
+}
+
+// PlayMatch simulates a match with the given setup and returns a narrative about the event.
+func (b *basicMatchService) PlayMatch(ctx context.Context, setup MatchSetup) (*domain.MatchReport, error) {
+	log.Infof("the match between %q and %q has began", setup.Player1ID, setup.Player2ID)
+	format, err := b.competitionFormat(setup.Competition)
+	if err != nil {
+		return nil, err
+	}
+	player1, player2, err := b.findPlayers(ctx, setup)
+	if err != nil {
+		return nil, err
+	}
+	match, err := domain.SimulateMatchContext(ctx, player1, player2, setup.settings(format))
+	if err != nil {
+		log.Errorf("match between %q and %q cannot be played because: %s", setup.Player1ID, setup.Player2ID, err.Error())
+		return nil, errors.Wrap(err, "match could not be played")
+	}
+	if err := b.matchCompleted(ctx, match); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// matchCompleted stores and publishes the given match in a transaction, so the report
+// is not kept and the changes of its subscribers are rolled back if any of them fails.
+func (b *basicMatchService) matchCompleted(ctx context.Context, match *domain.MatchReport) error {
+	err := domain.RunInTransaction(ctx, b.transactor, func(ctx context.Context) error {
+		if b.matches != nil {
+			if err := b.matches.Save(ctx, match); err != nil {
+				return err
+			}
+		}
+		return b.bus.Publish(ctx, domain.MatchPlayed{Match: *match})
+	})
+	if err != nil {
+		log.Errorf("match %s between %q and %q cannot be recorded because: %s", match.ID, match.Player1ID, match.Player2ID, err.Error())
+		return errors.Wrap(err, "match could not be recorded")
+	}
+	return nil
+}
+
+// Preview estimates the outcome of a match with the given setup without playing it.
+// Players are only read, so their statistics are not updated.
+func (b *basicMatchService) Preview(ctx context.Context, setup MatchSetup) (*domain.MatchPreview, error) {
+	log.Infof("previewing the match between %q and %q", setup.Player1ID, setup.Player2ID)
+	format, err := b.competitionFormat(setup.Competition)
+	if err != nil {
+		return nil, err
+	}
+	player1, player2, err := b.findPlayers(ctx, setup)
+	if err != nil {
+		return nil, err
+	}
+	preview, err := domain.PreviewMatch(ctx, player1, player2, setup.settings(format),
+		b.setting.PreviewSimulations, b.setting.PreviewWorkers)
+	if err != nil {
+		log.Errorf("match between %q and %q cannot be previewed because: %s", setup.Player1ID, setup.Player2ID, err.Error())
+		return nil, errors.Wrap(err, "match could not be previewed")
+	}
+	return preview, nil
+}
+
+// findPlayers validates the tactics of the setup and finds both players of the match.
+func (b *basicMatchService) findPlayers(ctx context.Context, setup MatchSetup) (domain.Player, domain.Player, error) {
+	player1ID, player2ID := setup.Player1ID, setup.Player2ID
+	if ok, err := domain.ValidateTactics(setup.Player1Tactics); !ok {
+		log.Infof("tactics for player 1: %s are not valid: %s", player1ID, err.Error())
+		return domain.Player{}, domain.Player{}, errors.Wrapf(ErrInvalidMatch, "player 1 tactics are not valid: %s", err)
+	}
+	if ok, err := domain.ValidateTactics(setup.Player2Tactics); !ok {
+		log.Infof("tactics for player 2: %s are not valid: %s", player2ID, err.Error())
+		return domain.Player{}, domain.Player{}, errors.Wrapf(ErrInvalidMatch, "player 2 tactics are not valid: %s", err)
+	}
 	log.Infof("finding player with id: %q", player1ID)
 	player1, err := b.playerService.FindByID(ctx, player1ID)
 	if err != nil { // just the logs
 		log.Errorf("player 1: %s cannot be found because: %s", player1ID, err.Error())
-		return nil, errors.Wrap(err, "player 1 not found at the match")
+		return domain.Player{}, domain.Player{}, errors.Wrap(err, "player 1 not found at the match")
 	}
 	log.Infof("finding player with id: %q", player2ID)
 	player2, err := b.playerService.FindByID(ctx, player2ID)
 	if err != nil { // just the logs
 		log.Errorf("player 2: %s cannot be found because: %s", player2ID, err.Error())
-		return nil, errors.Wrap(err, "player 2 not found at the match")
+		return domain.Player{}, domain.Player{}, errors.Wrap(err, "player 2 not found at the match")
 	}
-	match := domain.SimulateMatch(player1, player2)
-	stats := playerapp.NewPlayerStatistics(match.Winner.ID, match.Loser.ID, 1, 1)
-	err = b.playerService.UpdateStatistics(ctx, *stats)
-	if err != nil { // just the logs
-		log.Errorf("player statistics: %v cannot be updatedbecause: %s", stats, err.Error())
+	// archived players keep the matches they played, but they don't play new ones
+	requested := []domain.Key{player1ID, player2ID}
+	for index, player := range []domain.Player{player1, player2} {
+		if player.ID == "" {
+			log.Infof("player %d: %q doesn't exist", index+1, requested[index])
+			return domain.Player{}, domain.Player{}, errors.Wrapf(domain.ErrPlayerNotFound, "player %d %q doesn't exist", index+1, requested[index])
+		}
+		if player.Archived {
+			log.Infof("player %d: %s is archived", index+1, player.ID)
+			return domain.Player{}, domain.Player{}, errors.Wrapf(domain.ErrPlayerNotFound, "player %d %s is archived", index+1, player.ID)
+		}
 	}
-	return match, nil
+	return player1, player2, nil
+}
+
+// competitionFormat returns the match format of the given competition, or the default
+// format if the competition is empty.
+func (b *basicMatchService) competitionFormat(competition string) (domain.MatchFormat, error) {
+	if competition == "" {
+		return domain.DefaultMatchFormat(), nil
+	}
+	// configuration keys are stored in lower case
+	format, ok := b.setting.Competitions[strings.ToLower(competition)]
+	if !ok {
+		log.Infof("competition %q is not configured", competition)
+		return domain.MatchFormat{}, errors.Wrapf(ErrInvalidMatch, "competition %q does not exist", competition)
+	}
+	if ok, err := domain.ValidateMatchFormat(format); !ok {
+		log.Errorf("competition %q has not a valid format: %s", competition, err.Error())
+		return domain.MatchFormat{}, errors.Wrapf(ErrInvalidMatch, "competition %q has not a valid format: %s", competition, err)
+	}
+	return format, nil
 }
@@ -2,8 +2,11 @@ package matchapp_test
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fernandoocampo/thepingthepong/application/matchapp"
 	"github.com/fernandoocampo/thepingthepong/application/playerapp"
@@ -21,10 +24,8 @@ func TestBasicPlay(t *testing.T) {
 	repo := repository.NewPlayerRepositoryOnMemory(10)
 	playerService := playerapp.NewBasicPlayerService(&repo)
 	ctx := context.TODO()
-	player1ID, err := playerService.Create(ctx, player1Names, player1InitialWins, player1InitialLoses)
-	assertNoError(t, err)
-	player2ID, err := playerService.Create(ctx, player2Names, player2InitialWins, player2InitialLoses)
-	assertNoError(t, err)
+	player1ID := savePlayer(t, repo, player1Names, player1InitialWins, player1InitialLoses)
+	player2ID := savePlayer(t, repo, player2Names, player2InitialWins, player2InitialLoses)
 
 	basicMatchService := matchapp.NewBasicMatchService(playerService)
 
@@ -57,6 +58,477 @@ func TestBasicPlay(t *testing.T) {
 
 }
 
+func TestConcurrentMatchesKeepStatistics(t *testing.T) {
+	// given two players
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	basicMatchService := matchapp.NewBasicMatchService(playerService)
+	// when they play many matches at the same time
+	matches := 20
+	var wg sync.WaitGroup
+	errs := make(chan error, matches)
+	for i := 0; i < matches; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := basicMatchService.Play(ctx, player1ID, player2ID)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assertNoError(t, err)
+	}
+	// then every match is counted once for each player
+	player1, err := repo.FindByID(ctx, player1ID)
+	assertNoError(t, err)
+	player2, err := repo.FindByID(ctx, player2ID)
+	assertNoError(t, err)
+	if player1.Wins+player1.Losses != matches || player2.Wins+player2.Losses != matches || player1.Wins != player2.Losses {
+		t.Errorf("%d matches were expected for each player, but got: %+v and %+v", matches, player1, player2)
+	}
+}
+
+func TestFailedMatchDoesNotUpdateStatistics(t *testing.T) {
+	// given two players and a subscriber that fails after the statistics are updated
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID := savePlayer(t, repo, "Ma Long", 3, 2)
+	player2ID := savePlayer(t, repo, "Xu Xin", 4, 1)
+	bus := domain.NewEventBus()
+	bus.Subscribe(domain.MatchPlayedEvent, playerapp.StatisticsHandler(playerService))
+	bus.Subscribe(domain.MatchPlayedEvent, func(ctx context.Context, event domain.Event) error {
+		return errors.New("scoreboard cannot be updated")
+	})
+	matches := newMatchRepository(t, repo)
+	basicMatchService := matchapp.NewBasicMatchServiceWithBus(playerService, domain.MatchSetting{}, bus, repo, matches)
+	// when they play a match
+	_, err := basicMatchService.Play(ctx, player1ID, player2ID)
+	// then the match fails and neither the statistics nor the ratings are changed
+	if err == nil {
+		t.Fatalf("an error was expected when the match cannot be recorded")
+	}
+	player1, err := repo.FindByID(ctx, player1ID)
+	assertNoError(t, err)
+	player2, err := repo.FindByID(ctx, player2ID)
+	assertNoError(t, err)
+	if player1.Wins != 3 || player1.Losses != 2 || player2.Wins != 4 || player2.Losses != 1 {
+		t.Errorf("statistics must not change, but got: %+v and %+v", player1, player2)
+	}
+	if player1.Rating != domain.DefaultRating || player2.Rating != domain.DefaultRating {
+		t.Errorf("ratings must not change, but got: %d and %d", player1.Rating, player2.Rating)
+	}
+	// and the report is not stored
+	if len(matches.saved) != 1 {
+		t.Fatalf("the report was expected to be saved once, but got: %v", matches.saved)
+	}
+	if got, err := matches.FindByID(ctx, matches.saved[0]); err != nil || got.ID != "" {
+		t.Errorf("the report must not be stored, but got: %+v, %v", got, err)
+	}
+}
+
+func TestPlayedMatchIsStoredAndRated(t *testing.T) {
+	// given two players with the same rating
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	bus := domain.NewEventBus()
+	bus.Subscribe(domain.MatchPlayedEvent, playerapp.StatisticsHandler(playerService))
+	matches := newMatchRepository(t, repo)
+	basicMatchService := matchapp.NewBasicMatchServiceWithBus(playerService, domain.MatchSetting{}, bus, repo, matches)
+	// when they play a match
+	match, err := basicMatchService.Play(ctx, player1ID, player2ID)
+	assertNoError(t, err)
+	// then its report is stored
+	stored, err := matches.FindByID(ctx, match.ID)
+	assertNoError(t, err)
+	if stored.ID != match.ID || stored.Winner == nil || stored.Winner.ID != match.Winner.ID {
+		t.Errorf("match %s won by %s was expected to be stored, but got: %+v", match.ID, match.Winner.ID, stored)
+	}
+	// and the winner takes rating points from the loser
+	points := domain.RatingChange(*match.Winner, *match.Loser)
+	winner, err := repo.FindByID(ctx, match.Winner.ID)
+	assertNoError(t, err)
+	loser, err := repo.FindByID(ctx, match.Loser.ID)
+	assertNoError(t, err)
+	if points == 0 || winner.Rating != domain.DefaultRating+points || loser.Rating != domain.DefaultRating-points {
+		t.Errorf("ratings %d and %d were expected, but got: %d and %d",
+			domain.DefaultRating+points, domain.DefaultRating-points, winner.Rating, loser.Rating)
+	}
+	if winner.Wins != 1 || loser.Losses != 1 {
+		t.Errorf("one win and one loss were expected, but got: %+v and %+v", winner, loser)
+	}
+}
+
+func TestArchivedPlayerCannotPlay(t *testing.T) {
+	// given two players, one of them archived
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	assertNoError(t, playerService.Delete(ctx, player2ID))
+	basicMatchService := matchapp.NewBasicMatchService(playerService)
+	// when they play a match
+	_, err = basicMatchService.Play(ctx, player1ID, player2ID)
+	// then the match is not played
+	if !errors.Is(err, domain.ErrPlayerNotFound) || !strings.Contains(err.Error(), "archived") {
+		t.Errorf("an error about the archived player was expected, but got: %v", err)
+	}
+	player1, err := repo.FindByID(ctx, player1ID)
+	assertNoError(t, err)
+	if player1.Wins+player1.Losses != 0 {
+		t.Errorf("statistics must not change, but got: %+v", player1)
+	}
+}
+
+func TestUnknownPlayerCannotPlay(t *testing.T) {
+	// given a player
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	basicMatchService := matchapp.NewBasicMatchService(playerService)
+	for name, player2ID := range map[string]domain.Key{"unknown id": domain.GenerateUUIDKey(), "empty id": ""} {
+		t.Run(name, func(t *testing.T) {
+			// when the player plays against a player that doesn't exist
+			_, err := basicMatchService.Play(ctx, player1ID, player2ID)
+			// then the match is not played because the player is not found
+			if !errors.Is(err, domain.ErrPlayerNotFound) {
+				t.Errorf("error %q was expected, but got: %v", domain.ErrPlayerNotFound, err)
+			}
+			// and it cannot be previewed either
+			_, err = basicMatchService.Preview(ctx, *matchapp.NewMatchSetup(player2ID, player1ID))
+			if !errors.Is(err, domain.ErrPlayerNotFound) {
+				t.Errorf("error %q was expected on the preview, but got: %v", domain.ErrPlayerNotFound, err)
+			}
+		})
+	}
+}
+
+func TestPreviewDoesNotUpdateStatistics(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID := savePlayer(t, repo, "Ma Long", 10, 13)
+	player2ID := savePlayer(t, repo, "Xu Xin", 20, 5)
+	setting := domain.MatchSetting{PreviewSimulations: 50, PreviewWorkers: 2}
+	basicMatchService := matchapp.NewBasicMatchServiceWithSetting(playerService, setting)
+
+	got, err := basicMatchService.Preview(ctx, *matchapp.NewMatchSetup(player1ID, player2ID))
+	assertNoError(t, err)
+
+	if got.Simulations != setting.PreviewSimulations {
+		t.Errorf("%d simulations were expected, but got: %d", setting.PreviewSimulations, got.Simulations)
+	}
+	player1, err := repo.FindByID(ctx, player1ID)
+	assertNoError(t, err)
+	player2, err := repo.FindByID(ctx, player2ID)
+	assertNoError(t, err)
+	if player1.Wins != 10 || player1.Losses != 13 || player2.Wins != 20 || player2.Losses != 5 {
+		t.Errorf("preview must not update statistics, but got player 1: %d-%d and player 2: %d-%d",
+			player1.Wins, player1.Losses, player2.Wins, player2.Losses)
+	}
+}
+
+func TestPlayCompetitionMatch(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	setting := domain.MatchSetting{
+		Competitions: map[string]domain.MatchFormat{
+			"friendly": {GamesToWin: 1, PointsToWinGame: 5},
+		},
+	}
+	basicMatchService := matchapp.NewBasicMatchServiceWithSetting(playerService, setting)
+
+	setup := matchapp.NewMatchSetup(player1ID, player2ID)
+	setup.Competition = "Friendly"
+	got, err := basicMatchService.PlayMatch(ctx, *setup)
+	assertNoError(t, err)
+
+	if len(got.Score.Games) != 1 {
+		t.Errorf("a friendly match must be played to one game, but got: %+v", got.Score)
+	}
+
+	setup.Competition = "unknown"
+	_, err = basicMatchService.PlayMatch(ctx, *setup)
+	if !errors.Is(err, matchapp.ErrInvalidMatch) {
+		t.Errorf("a match of an unknown competition must not be played, but got: %v", err)
+	}
+}
+
+func TestFollowLiveMatch(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	basicMatchService := matchapp.NewBasicMatchService(playerService)
+
+	// given a live match followed by two spectators
+	matchID, err := basicMatchService.PlayLive(ctx, *matchapp.NewMatchSetup(player1ID, player2ID), matchapp.InstantPacing)
+	assertNoError(t, err)
+	spectator1, err := basicMatchService.Follow(ctx, matchID)
+	assertNoError(t, err)
+	spectator2, err := basicMatchService.Follow(ctx, matchID)
+	assertNoError(t, err)
+
+	// when both spectators follow the match until it finishes
+	var got1, got2 []matchapp.LiveMessage
+	for message, ok := spectator1.Next(ctx); ok; message, ok = spectator1.Next(ctx) {
+		got1 = append(got1, message)
+	}
+	for message, ok := spectator2.Next(ctx); ok; message, ok = spectator2.Next(ctx) {
+		got2 = append(got2, message)
+	}
+
+	// then both receive every event and the summary at the end
+	if len(got1) < 2 || len(got1) != len(got2) {
+		t.Fatalf("both spectators must receive the same events, but got: %d and %d", len(got1), len(got2))
+	}
+	for index, message := range got1[:len(got1)-1] {
+		if message.Type != matchapp.EventMessage || message.Event == nil {
+			t.Errorf("message %d must be an event, but got: %+v", index, message)
+		}
+	}
+	summary := got1[len(got1)-1]
+	if summary.Type != matchapp.SummaryMessage || summary.Summary == nil || summary.Summary.ID != matchID {
+		t.Fatalf("the last message must be the summary of match %q, but got: %+v", matchID, summary)
+	}
+	winner, err := repo.FindByID(ctx, summary.Summary.Winner.ID)
+	assertNoError(t, err)
+	if winner.Wins != 1 {
+		t.Errorf("the winner of a live match must have 1 win, but got: %d", winner.Wins)
+	}
+
+	_, err = basicMatchService.Follow(ctx, domain.GenerateUUIDKey())
+	if err != matchapp.ErrLiveMatchNotFound {
+		t.Errorf("following an unknown match must return %v, but got: %v", matchapp.ErrLiveMatchNotFound, err)
+	}
+	_, err = basicMatchService.PlayLive(ctx, *matchapp.NewMatchSetup(player1ID, player2ID), "slow")
+	if err == nil {
+		t.Errorf("a live match with an unknown pacing must not be played")
+	}
+}
+
+func TestLiveMatchesAreLimited(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	setup := *matchapp.NewMatchSetup(player1ID, player2ID)
+	basicMatchService := matchapp.NewBasicMatchServiceWithSetting(playerService, domain.MatchSetting{LiveMatches: 1, LiveHistory: 3})
+
+	// given a live match played in real time
+	matchID, err := basicMatchService.PlayLive(ctx, setup, matchapp.RealTimePacing)
+	assertNoError(t, err)
+	spectator, err := basicMatchService.Follow(ctx, matchID)
+	assertNoError(t, err)
+
+	// when another one starts
+	_, err = basicMatchService.PlayLive(ctx, setup, matchapp.InstantPacing)
+
+	// then it is refused until the first one finishes
+	if err != matchapp.ErrLiveMatchesFull {
+		t.Errorf("error %q was expected, but got: %v", matchapp.ErrLiveMatchesFull, err)
+	}
+
+	// when the service is closed
+	assertNoError(t, basicMatchService.Close())
+
+	// then the live match is stopped
+	var got []matchapp.LiveMessage
+	for message, ok := spectator.Next(ctx); ok; message, ok = spectator.Next(ctx) {
+		got = append(got, message)
+	}
+	if len(got) == 0 || got[len(got)-1].Type != matchapp.ErrorMessage {
+		t.Errorf("the live match must finish with an error, but got: %+v", got)
+	}
+	// and new ones are refused
+	_, err = basicMatchService.PlayLive(ctx, setup, matchapp.InstantPacing)
+	if err != matchapp.ErrMatchServiceClosed {
+		t.Errorf("error %q was expected, but got: %v", matchapp.ErrMatchServiceClosed, err)
+	}
+}
+
+func TestLiveMatchKeepsItsLatestMessages(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	basicMatchService := matchapp.NewBasicMatchServiceWithSetting(playerService, domain.MatchSetting{LiveHistory: 3})
+
+	// given a live match that finished
+	matchID, err := basicMatchService.PlayLive(ctx, *matchapp.NewMatchSetup(player1ID, player2ID), matchapp.InstantPacing)
+	assertNoError(t, err)
+	spectator, err := basicMatchService.Follow(ctx, matchID)
+	assertNoError(t, err)
+	for _, ok := spectator.Next(ctx); ok; _, ok = spectator.Next(ctx) {
+	}
+
+	// when a spectator follows it late
+	late, err := basicMatchService.Follow(ctx, matchID)
+	assertNoError(t, err)
+	var got []matchapp.LiveMessage
+	for message, ok := late.Next(ctx); ok; message, ok = late.Next(ctx) {
+		got = append(got, message)
+	}
+
+	// then only the latest messages are received, the summary at the end
+	if len(got) != 3 || got[0].Type != matchapp.EventMessage || got[2].Type != matchapp.SummaryMessage {
+		t.Errorf("two events and the summary were expected, but got: %+v", got)
+	}
+}
+
+// blockingPlayerService blocks finding players until it is released, so match
+// jobs stay running.
+type blockingPlayerService struct {
+	playerapp.PlayerService
+	release chan struct{}
+}
+
+func (b blockingPlayerService) FindByID(ctx context.Context, key domain.Key) (domain.Player, error) {
+	<-b.release
+	return b.PlayerService.FindByID(ctx, key)
+}
+
+func TestMatchJobs(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	blocking := blockingPlayerService{PlayerService: playerService, release: make(chan struct{})}
+	setting := domain.MatchSetting{JobWorkers: 1, JobQueue: 2}
+	basicMatchService := matchapp.NewBasicMatchServiceWithSetting(blocking, setting)
+	setup := *matchapp.NewMatchSetup(player1ID, player2ID)
+
+	// given a worker playing the first job and two jobs waiting for it
+	first, err := basicMatchService.Submit(ctx, setup)
+	assertNoError(t, err)
+	waitForJob(t, basicMatchService, first.ID, matchapp.JobRunning)
+	second, err := basicMatchService.Submit(ctx, setup)
+	assertNoError(t, err)
+	third, err := basicMatchService.Submit(ctx, setup)
+	assertNoError(t, err)
+	_, err = basicMatchService.Submit(ctx, setup)
+	if err != matchapp.ErrJobQueueFull {
+		t.Errorf("a job must not be queued when the queue is full, but got: %v", err)
+	}
+
+	// when the second job is cancelled while it is queued
+	cancelled, err := basicMatchService.CancelJob(ctx, second.ID)
+	assertNoError(t, err)
+	_, err = basicMatchService.CancelJob(ctx, first.ID)
+	if err != matchapp.ErrJobNotQueued {
+		t.Errorf("a running job must not be cancelled, but got: %v", err)
+	}
+	close(blocking.release)
+
+	// then the other jobs are played and their results can be queried
+	if cancelled.Status != matchapp.JobCancelled {
+		t.Errorf("the second job must be cancelled, but got: %s", cancelled.Status)
+	}
+	for _, jobID := range []domain.Key{first.ID, third.ID} {
+		job := waitForJob(t, basicMatchService, jobID, matchapp.JobDone)
+		if job.Result == nil || job.Result.Winner == nil {
+			t.Errorf("job %q must contain the match report, but got: %+v", jobID, job)
+		}
+	}
+	job, err := basicMatchService.FindJob(ctx, second.ID)
+	assertNoError(t, err)
+	if job.Status != matchapp.JobCancelled || job.Result != nil {
+		t.Errorf("the cancelled job must not be played, but got: %+v", job)
+	}
+	_, err = basicMatchService.FindJob(ctx, domain.GenerateUUIDKey())
+	if err != matchapp.ErrJobNotFound {
+		t.Errorf("an unknown job must not be found, but got: %v", err)
+	}
+}
+
+func TestCancelledJobIsKeptUntilItIsSkipped(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(10)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	ctx := context.TODO()
+	player1ID, err := playerService.Create(ctx, "Ma Long", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(ctx, "Xu Xin", 0, 0)
+	assertNoError(t, err)
+	blocking := blockingPlayerService{PlayerService: playerService, release: make(chan struct{})}
+	setting := domain.MatchSetting{JobWorkers: 1, JobQueue: 2, JobRetention: time.Millisecond}
+	basicMatchService := matchapp.NewBasicMatchServiceWithSetting(blocking, setting)
+	setup := *matchapp.NewMatchSetup(player1ID, player2ID)
+
+	// given a worker playing the first job and a second job cancelled while it is queued
+	first, err := basicMatchService.Submit(ctx, setup)
+	assertNoError(t, err)
+	waitForJob(t, basicMatchService, first.ID, matchapp.JobRunning)
+	second, err := basicMatchService.Submit(ctx, setup)
+	assertNoError(t, err)
+	_, err = basicMatchService.CancelJob(ctx, second.ID)
+	assertNoError(t, err)
+
+	// when its retention passes before the worker reaches it
+	time.Sleep(10 * setting.JobRetention)
+
+	// then it is kept until the worker skips it
+	job, err := basicMatchService.FindJob(ctx, second.ID)
+	assertNoError(t, err)
+	if job.Status != matchapp.JobCancelled {
+		t.Errorf("the second job must be cancelled, but got: %+v", job)
+	}
+	// and the service waits for the worker when it is closed
+	close(blocking.release)
+	assertNoError(t, basicMatchService.Close())
+	// and new jobs are refused
+	if _, err := basicMatchService.Submit(ctx, setup); err != matchapp.ErrMatchServiceClosed {
+		t.Errorf("error %q was expected, but got: %v", matchapp.ErrMatchServiceClosed, err)
+	}
+}
+
+// waitForJob waits until the job has the given status and returns it.
+func waitForJob(t *testing.T, service matchapp.MatchService, jobID domain.Key, status matchapp.JobStatus) matchapp.MatchJob {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		job, err := service.FindJob(context.TODO(), jobID)
+		assertNoError(t, err)
+		if job.Status == status {
+			return job
+		}
+	}
+	t.Fatalf("job %q was not %s after 5 seconds", jobID, status)
+	return matchapp.MatchJob{}
+}
+
 func assertNoError(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
@@ -83,3 +555,30 @@ func assertAfterMatchPlayerState(t *testing.T, initialWins, initiaLosse int, pla
 		}
 	}
 }
+
+// savePlayer stores a player who has already played matches, the service only sets its
+// statistics when it plays.
+func savePlayer(t *testing.T, repo domain.PlayerRepository, names string, wins, losses int) domain.Key {
+	t.Helper()
+	player := domain.NewPlayerWithStatistics(names, wins, losses)
+	assertNoError(t, repo.Save(context.TODO(), player))
+	return player.ID
+}
+
+// savedMatches remembers the ids of the matches saved on the repository it wraps.
+type savedMatches struct {
+	domain.MatchRepository
+	saved []domain.Key
+}
+
+func newMatchRepository(t *testing.T, players domain.PlayerRepository) *savedMatches {
+	t.Helper()
+	matches, err := repository.NewMatchRepositoryOn(players)
+	assertNoError(t, err)
+	return &savedMatches{MatchRepository: matches}
+}
+
+func (s *savedMatches) Save(ctx context.Context, match *domain.MatchReport) error {
+	s.saved = append(s.saved, match.ID)
+	return s.MatchRepository.Save(ctx, match)
+}
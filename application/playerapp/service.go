@@ -3,27 +3,69 @@ package playerapp
 import (
 	"context"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/fernandoocampo/thepingthepong/domain"
 	"github.com/pkg/errors"
 )
 
+var (
+	// ErrInvalidPlayer is returned when a player is updated with data that is not valid.
+	ErrInvalidPlayer = errors.New("player is not valid")
+	// ErrInvalidQuery is returned when players are found with a query that is not valid.
+	ErrInvalidQuery = errors.New("player query is not valid")
+	// ErrUnsafeRebuild is returned when the statistics log may not have every match of the
+	// players, so a rebuild would lose their statistics.
+	ErrUnsafeRebuild = errors.New("statistics cannot be rebuilt safely, it must be forced")
+)
+
+// statisticsCannotBeSet is why a player cannot be created, updated or imported with wins
+// or losses, they only come from the matches it plays.
+const statisticsCannotBeSet = "wins and losses come from the matches played, they cannot be set"
+
 // PlayerStatistics groups all the statistics for winner and loser
 type PlayerStatistics struct {
+	MatchID           domain.Key // match the statistics come from, if any
 	WinnerID, LoserID domain.Key
 	Wins, Losses      int
 }
 
 // PlayerService defines standard behavior for player capabilities.
 type PlayerService interface {
-	// Create creates a player with the given data and return id or and error
+	// Create creates a player with the given data and return id or and error, wins and
+	// losses other than zero are not valid
 	Create(ctx context.Context, names string, wins, losses int) (domain.Key, error)
+	// CreateWithProfile creates a player with the given data and profile and return id or
+	// and error, wins and losses other than zero are not valid
+	CreateWithProfile(ctx context.Context, names string, wins, losses int, profile domain.PlayerProfile) (domain.Key, error)
 	// FindByID finds a player by id
 	FindByID(ctx context.Context, key domain.Key) (domain.Player, error)
-	// FindAll get all the players
-	FindAll(ctx context.Context, sorted bool) ([]domain.Player, error)
+	// FindAll get the page of the players selected by the query
+	FindAll(ctx context.Context, query domain.PlayerQuery) (domain.PlayerPage, error)
+	// Search finds the players whose names match the text, the best matches first. A zero
+	// limit returns domain.DefaultSearchLimit players at most.
+	Search(ctx context.Context, text string, limit int) ([]domain.SearchResult, error)
 	// UpdateStatistics updates the winner and loser counter for winner and loser players
 	UpdateStatistics(ctx context.Context, statistics PlayerStatistics) error
+	// Update changes the player with the given id with the change function and returns it,
+	// the changed player must be valid and keep its wins and losses. Archived players are
+	// not found. The change function can return domain.ErrVersionConflict when the player
+	// is not on the version it expects.
+	Update(ctx context.Context, id domain.Key, change func(player *domain.Player) error) (domain.Player, error)
+	// Delete archives the player with the given id, it keeps the statistics of its matches.
+	Delete(ctx context.Context, id domain.Key) error
+	// Import creates the valid players of the input and reports the lines that are not
+	// valid, nothing is stored on a dry run.
+	Import(ctx context.Context, input io.Reader, format TransferFormat, dryRun bool) (ImportReport, error)
+	// Export writes every player that is not archived to the output.
+	Export(ctx context.Context, output io.Writer, format TransferFormat) error
+	// RebuildStatistics stores the wins and losses of the statistics log on every player,
+	// a log on memory or without entries is only rebuilt when it is forced.
+	RebuildStatistics(ctx context.Context, force bool) (RebuildReport, error)
+	// SeedStatistics appends the wins and losses of every player to an empty statistics
+	// log and returns how many players were appended.
+	SeedStatistics(ctx context.Context) (int, error)
 }
 
 // NewPlayerStatistics builds a stats data.
@@ -39,25 +81,53 @@ func NewPlayerStatistics(winnerID, loserID domain.Key, wins, losses int) *Player
 // basicPlayerService implements the player service.
 type basicPlayerService struct {
 	repository domain.PlayerRepository
+	bus        domain.EventBus
+	statistics domain.StatisticsLog
 }
 
 // NewBasicPlayerService build a basic implementation for playerservice.
 func NewBasicPlayerService(repository *domain.PlayerRepository) PlayerService {
+	return NewBasicPlayerServiceWithBus(repository, domain.NewEventBus())
+}
+
+// NewBasicPlayerServiceWithBus build a basic implementation for playerservice that
+// publishes the changes of the players on the given bus. The statistics log is kept on
+// memory.
+func NewBasicPlayerServiceWithBus(repository *domain.PlayerRepository, bus domain.EventBus) PlayerService {
+	return NewBasicPlayerServiceWithStatistics(repository, bus, domain.NewMemoryStatisticsLog())
+}
+
+// NewBasicPlayerServiceWithStatistics build a basic implementation for playerservice
+// that publishes the changes of the players on the given bus and appends every match
+// result to the given statistics log.
+func NewBasicPlayerServiceWithStatistics(repository *domain.PlayerRepository, bus domain.EventBus, statistics domain.StatisticsLog) PlayerService {
 	log.Info("creating basic player service")
 	return &basicPlayerService{
 		repository: *repository,
+		bus:        bus,
+		statistics: statistics,
 	}
 }
 
 // Create creates a player
 func (b basicPlayerService) Create(ctx context.Context, names string, wins, losses int) (domain.Key, error) {
-	log.Infof("creating player with names: '%s', wins: %d, losses: %d", names, wins, losses)
+	return b.CreateWithProfile(ctx, names, wins, losses, domain.PlayerProfile{})
+}
+
+// CreateWithProfile creates a player with a playing style, handedness and grip
+func (b basicPlayerService) CreateWithProfile(ctx context.Context, names string, wins, losses int, profile domain.PlayerProfile) (domain.Key, error) {
+	log.Infof("creating player with names: '%s', wins: %d, losses: %d, profile: %+v", names, wins, losses, profile)
+	if wins != 0 || losses != 0 {
+		log.Infof("player %q cannot be created with %d wins and %d losses", names, wins, losses)
+		return "", errors.Wrap(ErrInvalidPlayer, statisticsCannotBeSet)
+	}
 	// check that the given parameter is valid
-	player := domain.NewPlayerWithStatistics(names, wins, losses)
+	player := domain.NewPlayer(names)
+	player.PlayerProfile = profile
 	ok, errvalidation := domain.ValidatePlayer(*player)
 	if !ok {
 		log.Infof("Player %v is not valid, returning from service.", player)
-		return "", errvalidation
+		return "", errors.Wrap(ErrInvalidPlayer, errvalidation.Error())
 	}
 	log.Infof("getting ready to save player %v on repository", player)
 	errsave := b.repository.Save(ctx, player)
@@ -66,6 +136,9 @@ func (b basicPlayerService) Create(ctx context.Context, names string, wins, loss
 		return "", errors.Wrap(errsave, "Player cannot be stored")
 	}
 	log.Infof("player stored with ID: %s", player.ID)
+	if err := b.bus.Publish(ctx, domain.PlayerCreated{Player: *player}); err != nil { // just the logs
+		log.Errorf("creation of player %s cannot be published because: %s", player.ID, err.Error())
+	}
 	return player.ID, nil
 }
 
@@ -90,31 +163,194 @@ func (b basicPlayerService) FindByID(ctx context.Context, id domain.Key) (domain
 	return result, nil
 }
 
-// FindAll get all the players
-func (b basicPlayerService) FindAll(ctx context.Context, sorted bool) ([]domain.Player, error) {
-	log.Infof("getting ready to find all players with sorted: %t", sorted)
-	result, err := b.repository.FindAll(ctx, sorted)
+// FindAll get the page of the players selected by the query
+func (b basicPlayerService) FindAll(ctx context.Context, query domain.PlayerQuery) (domain.PlayerPage, error) {
+	log.Infof("getting ready to find all players with query: %+v", query)
+	if ok, errvalidation := domain.ValidatePlayerQuery(query); !ok {
+		log.Infof("query %+v is not valid, returning from service.", query)
+		return domain.PlayerPage{}, errors.Wrap(ErrInvalidQuery, errvalidation.Error())
+	}
+	result, err := b.repository.FindAll(ctx, query)
 	log.Debugf("after finding all players, got %+v", result)
 	if err != nil {
 		log.Errorf("something goes wrong trying to find all players: %s", err.Error())
-		return nil, errors.Wrap(err, "all players could not be searched")
+		return domain.PlayerPage{}, errors.Wrap(err, "all players could not be searched")
 	}
+	return result, nil
+}
+
+// Search finds the players whose names match the text, the best matches first.
+func (b basicPlayerService) Search(ctx context.Context, text string, limit int) ([]domain.SearchResult, error) {
+	log.Infof("getting ready to search players with text: %q and limit: %d", text, limit)
+	if ok, errvalidation := domain.ValidateSearch(text, limit); !ok {
+		log.Infof("search %q is not valid, returning from service.", text)
+		return nil, errors.Wrap(ErrInvalidQuery, errvalidation.Error())
+	}
+	if limit == 0 {
+		limit = domain.DefaultSearchLimit
+	}
+	result, err := b.repository.Search(ctx, text, limit)
+	if err != nil {
+		log.Errorf("something goes wrong trying to search players: %s", err.Error())
+		return nil, errors.Wrap(err, "players could not be searched")
+	}
+	log.Debugf("after searching players, got %+v", result)
+	return result, nil
+}
 
+// Update changes the player with the given id with the change function in a transaction,
+// so the player doesn't change between it is found and updated. The id, creation date,
+// archived flag and version of the player cannot be changed, and changes of its wins or
+// losses are not valid.
+func (b basicPlayerService) Update(ctx context.Context, id domain.Key, change func(player *domain.Player) error) (domain.Player, error) {
+	log.Infof("getting ready to update player with id: %s", id)
+	var result domain.Player
+	err := domain.RunInTransaction(ctx, b.repository, func(ctx context.Context) error {
+		player, err := b.activePlayer(ctx, id)
+		if err != nil {
+			return err
+		}
+		updated := player
+		if err := change(&updated); err != nil {
+			return err
+		}
+		updated.ID, updated.Created, updated.Archived, updated.Version = player.ID, player.Created, player.Archived, player.Version
+		if updated.Wins != player.Wins || updated.Losses != player.Losses {
+			log.Infof("wins and losses of player %s cannot change from %d and %d to %d and %d", id, player.Wins, player.Losses, updated.Wins, updated.Losses)
+			return errors.Wrap(ErrInvalidPlayer, statisticsCannotBeSet)
+		}
+		if ok, errvalidation := domain.ValidatePlayer(updated); !ok {
+			log.Infof("Player %v is not valid, returning from service.", updated)
+			return errors.Wrap(ErrInvalidPlayer, errvalidation.Error())
+		}
+		updated.Updated = time.Now()
+		if err := b.repository.Update(ctx, &updated); err != nil {
+			log.Errorf("player %v cannot be updated because: %s", updated, err.Error())
+			return errors.Wrap(err, "player could not be updated")
+		}
+		result = updated
+		b.playerChanged(ctx, updated)
+		return nil
+	})
+	if err != nil {
+		return domain.Player{}, err
+	}
+	log.Infof("player %s was updated", id)
 	return result, nil
 }
 
-// UpdateStatistics updates the winner and loser counter for winner and loser players
+// Delete archives the player with the given id.
+func (b basicPlayerService) Delete(ctx context.Context, id domain.Key) error {
+	log.Infof("getting ready to archive player with id: %s", id)
+	return domain.RunInTransaction(ctx, b.repository, func(ctx context.Context) error {
+		if _, err := b.activePlayer(ctx, id); err != nil {
+			return err
+		}
+		if err := b.repository.Archive(ctx, id); err != nil {
+			log.Errorf("player %s cannot be archived because: %s", id, err.Error())
+			return errors.Wrap(err, "player could not be deleted")
+		}
+		log.Infof("player %s was archived", id)
+		if archived, err := b.repository.FindByID(ctx, id); err == nil {
+			b.playerChanged(ctx, archived)
+		}
+		return nil
+	})
+}
+
+// playerChanged publishes the given changed player, subscribers inside the transaction
+// of the context run before it is committed.
+func (b basicPlayerService) playerChanged(ctx context.Context, player domain.Player) {
+	if err := b.bus.Publish(ctx, domain.PlayerUpdated{Player: player}); err != nil { // just the logs
+		log.Errorf("change of player %s cannot be published because: %s", player.ID, err.Error())
+	}
+}
+
+// activePlayer finds the player with the given id, it returns ErrPlayerNotFound if it
+// doesn't exist or it is archived.
+func (b basicPlayerService) activePlayer(ctx context.Context, id domain.Key) (domain.Player, error) {
+	player, err := b.repository.FindByID(ctx, id)
+	if err != nil {
+		log.Errorf("something was going wrong searching player with id: %s, because: %s", id, err.Error())
+		return domain.Player{}, errors.Wrap(err, fmt.Sprintf("player with id %s could not be searched", id))
+	}
+	if player.ID == "" || player.Archived {
+		log.Infof("player with id %s doesn't exist or it is archived", id)
+		return domain.Player{}, domain.ErrPlayerNotFound
+	}
+	return player, nil
+}
+
+// UpdateStatistics updates the winner and loser counter for winner and loser players,
+// and their ratings when both played the match. The match result is appended to the
+// statistics log in the same transaction, so it fails if the result cannot be appended.
 func (b basicPlayerService) UpdateStatistics(ctx context.Context, stats PlayerStatistics) error {
 	log.Infof("getting ready to update statistics for players: %v", stats)
-	err := b.repository.UpdateWins(ctx, stats.WinnerID, stats.Wins)
+	// both players are updated at once, so a failure doesn't leave a half recorded match
+	err := domain.RunInTransaction(ctx, b.repository, func(ctx context.Context) error {
+		err := b.repository.RecordMatchResult(ctx, stats.WinnerID, stats.LoserID, stats.Wins, stats.Losses)
+		if err != nil {
+			return err
+		}
+		if stats.WinnerID != "" && stats.LoserID != "" {
+			if err := b.updateRatings(ctx, stats.WinnerID, stats.LoserID); err != nil {
+				return err
+			}
+		}
+		return b.recordStatistics(ctx, domain.NewMatchResultEntry(stats.MatchID, stats.WinnerID, stats.LoserID, stats.Wins, stats.Losses))
+	})
+	if err != nil {
+		log.Errorf("statistics of players %s and %s cannot be updated because: %s", stats.WinnerID, stats.LoserID, err.Error())
+		return errors.Wrap(err, "players could not be updated")
+	}
+	b.playersUpdated(ctx, stats.WinnerID, stats.LoserID)
+	return nil
+}
+
+// updateRatings moves the rating points the winner takes from the loser of a match.
+func (b basicPlayerService) updateRatings(ctx context.Context, winnerID, loserID domain.Key) error {
+	winner, err := b.repository.FindByID(ctx, winnerID)
 	if err != nil {
-		log.Errorf("player %s cannot be update wins because: %s", stats.WinnerID, err.Error())
-		return errors.Wrap(err, "winner player could not be updated")
+		return err
 	}
-	err = b.repository.UpdateDefeats(ctx, stats.LoserID, stats.Losses)
+	loser, err := b.repository.FindByID(ctx, loserID)
 	if err != nil {
-		log.Errorf("player %s cannot be update wins because: %s", stats.LoserID, err.Error())
-		return errors.Wrap(err, "loser player could not be updated")
+		return err
+	}
+	points := domain.RatingChange(winner, loser)
+	log.Infof("player %s takes %d rating points from player %s", winnerID, points, loserID)
+	winner.Rating += points
+	loser.Rating -= points
+	if err := b.repository.Update(ctx, &winner); err != nil {
+		return err
+	}
+	return b.repository.Update(ctx, &loser)
+}
+
+// playersUpdated publishes the updated data of the given players.
+func (b basicPlayerService) playersUpdated(ctx context.Context, playerIDs ...domain.Key) {
+	for _, playerID := range playerIDs {
+		player, err := b.repository.FindByID(ctx, playerID)
+		if err != nil { // just the logs
+			log.Errorf("updated player %s cannot be found because: %s", playerID, err.Error())
+			continue
+		}
+		if err := b.bus.Publish(ctx, domain.StatisticsUpdated{Player: player}); err != nil { // just the logs
+			log.Errorf("statistics of player %s cannot be published because: %s", playerID, err.Error())
+		}
+	}
+}
+
+// StatisticsHandler returns the event handler that adds the result of every played
+// match to the statistics of its players.
+func StatisticsHandler(service PlayerService) domain.EventHandler {
+	return func(ctx context.Context, event domain.Event) error {
+		played, ok := event.(domain.MatchPlayed)
+		if !ok {
+			return fmt.Errorf("statistics cannot be updated with event %q", event.EventName())
+		}
+		stats := NewPlayerStatistics(played.Match.Winner.ID, played.Match.Loser.ID, 1, 1)
+		stats.MatchID = played.Match.ID
+		return service.UpdateStatistics(ctx, *stats)
 	}
-	return nil
 }
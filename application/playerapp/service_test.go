@@ -7,6 +7,7 @@ import (
 	"github.com/fernandoocampo/thepingthepong/application/playerapp"
 	"github.com/fernandoocampo/thepingthepong/domain"
 	"github.com/fernandoocampo/thepingthepong/infra/repository"
+	"github.com/pkg/errors"
 )
 
 func TestSaveValidPlayer(t *testing.T) {
@@ -15,8 +16,8 @@ func TestSaveValidPlayer(t *testing.T) {
 	service := playerapp.NewBasicPlayerService(&repo)
 	// Given a player to save
 	newplayername := "Ma Lin"
-	newplayerwins := 4
-	newplayerlosses := 1
+	newplayerwins := 0
+	newplayerlosses := 0
 
 	// When we want to store the new player
 	newid, err := service.Create(ctx, newplayername, newplayerwins, newplayerlosses)
@@ -93,17 +94,192 @@ func TestFindAll(t *testing.T) {
 	service := playerapp.NewBasicPlayerService(&repo)
 
 	// When we want to find the player using the given id
-	result, err := service.FindAll(ctx, false)
+	result, err := service.FindAll(ctx, domain.PlayerQuery{})
 
 	// Then we check that there is not an error
 	if err != nil {
 		t.Errorf("The players could be searched because: %s", err.Error())
 	}
 
-	for _, player := range result {
+	for _, player := range result.Players {
 		if _, ok := expectedresult[player.Names]; !ok {
 			t.Errorf("The player (%s) was expected in the findAll result but was not found", player.Names)
 		}
 	}
 
 }
+
+func TestFindAllByProfile(t *testing.T) {
+	ctx := context.Background()
+	// Given this repo and service
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+	chopper := domain.PlayerProfile{Style: domain.Chopper, Handedness: domain.RightHanded, Grip: domain.ShakehandGrip}
+	looper := domain.PlayerProfile{Style: domain.OffensiveLooper, Handedness: domain.LeftHanded, Grip: domain.ShakehandGrip}
+	players := map[string]domain.PlayerProfile{
+		"Joo Sae-hyuk": chopper,
+		"Ding Ning":    chopper,
+		"Timo Boll":    looper,
+	}
+	for names, profile := range players {
+		_, err := service.CreateWithProfile(ctx, names, 0, 0, profile)
+		if err != nil {
+			t.Fatalf("the player %s could not be created because: %s", names, err)
+		}
+	}
+
+	// When we want to find the choppers
+	page, err := service.FindAll(ctx, domain.PlayerQuery{Profile: domain.PlayerProfile{Style: domain.Chopper}})
+	result := page.Players
+
+	// Then we check that there is not an error and only choppers were found
+	if err != nil {
+		t.Fatalf("The players could be searched because: %s", err.Error())
+	}
+	if len(result) != 2 {
+		t.Errorf("two choppers were expected, but got: %+v", result)
+	}
+	for _, player := range result {
+		if player.PlayerProfile != chopper {
+			t.Errorf("The player (%s) is not a chopper: %+v", player.Names, player.PlayerProfile)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	// Given a stored player
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+	player := domain.NewPlayerWithStatistics("Ma Long", 3, 1)
+	if err := repo.Save(ctx, player); err != nil {
+		t.Fatalf("the player could not be saved because: %s", err)
+	}
+	id := player.ID
+	stored, _ := repo.FindByID(ctx, id)
+
+	// When its names are changed, trying to change its id too
+	result, err := service.Update(ctx, id, func(player *domain.Player) error {
+		player.ID = "another id"
+		player.Names = "Xu Xin"
+		return nil
+	})
+
+	// Then the player keeps its id and creation date with the new data
+	if err != nil {
+		t.Fatalf("The player could not be updated because: %s", err.Error())
+	}
+	got, _ := repo.FindByID(ctx, id)
+	if result.Names != got.Names || got.ID != id || got.Names != "Xu Xin" || got.Wins != 3 || got.Losses != 1 || !got.Created.Equal(stored.Created) {
+		t.Errorf("player %s updated to Xu Xin with its statistics was expected, but got: %+v and %+v", id, result, got)
+	}
+
+	// And data that is not valid is not stored, neither are statistics that don't come from matches
+	for _, change := range []func(player *domain.Player){
+		func(player *domain.Player) { player.Names = "" },
+		func(player *domain.Player) { player.Wins = 5 },
+	} {
+		_, err = service.Update(ctx, id, func(player *domain.Player) error {
+			change(player)
+			return nil
+		})
+		if errors.Cause(err) != playerapp.ErrInvalidPlayer {
+			t.Errorf("error %q was expected, but got: %v", playerapp.ErrInvalidPlayer, err)
+		}
+	}
+	if got, _ := repo.FindByID(ctx, id); got.Names != "Xu Xin" || got.Wins != 3 {
+		t.Errorf("a player that is not valid must not be stored, but got: %+v", got)
+	}
+
+	// And an unknown player is not found
+	_, err = service.Update(ctx, domain.GenerateUUIDKey(), func(player *domain.Player) error { return nil })
+	if errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("error %q was expected, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	// Given two stored players
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	bus := domain.NewEventBus()
+	var updated []domain.Player
+	bus.Subscribe(domain.PlayerUpdatedEvent, func(ctx context.Context, event domain.Event) error {
+		updated = append(updated, event.(domain.PlayerUpdated).Player)
+		return nil
+	})
+	service := playerapp.NewBasicPlayerServiceWithBus(&repo, bus)
+	player := domain.NewPlayerWithStatistics("Ma Long", 3, 1)
+	if err := repo.Save(ctx, player); err != nil {
+		t.Fatalf("the player could not be saved because: %s", err)
+	}
+	id := player.ID
+	if _, err := service.Create(ctx, "Xu Xin", 0, 0); err != nil {
+		t.Fatalf("the player could not be created because: %s", err)
+	}
+
+	// When one of them is deleted
+	err := service.Delete(ctx, id)
+
+	// Then it is archived with its statistics and it is not listed
+	if err != nil {
+		t.Fatalf("The player could not be deleted because: %s", err.Error())
+	}
+	got, _ := service.FindByID(ctx, id)
+	if !got.Archived || got.Wins != 3 || got.Losses != 1 {
+		t.Errorf("player %s was expected to be archived with its statistics, but got: %+v", id, got)
+	}
+	if len(updated) != 1 || !updated[0].Archived {
+		t.Errorf("the archived player was expected to be published, but got: %+v", updated)
+	}
+	all, _ := service.FindAll(ctx, domain.PlayerQuery{})
+	if len(all.Players) != 1 || all.Players[0].Names != "Xu Xin" {
+		t.Errorf("only Xu Xin was expected, but got: %+v", all)
+	}
+
+	// And it cannot be deleted nor updated again
+	if err := service.Delete(ctx, id); errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("error %q was expected, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+	_, err = service.Update(ctx, id, func(player *domain.Player) error { return nil })
+	if errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("error %q was expected, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	// Given players with similar names, one of them archived
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+	for _, names := range []string{"Fan Zhendong", "Zhang Jike", "Ma Long"} {
+		if _, err := service.Create(ctx, names, 0, 0); err != nil {
+			t.Fatalf("the player could not be created because: %s", err)
+		}
+	}
+	archived, err := service.Create(ctx, "Zhang Yining", 0, 0)
+	if err != nil {
+		t.Fatalf("the player could not be created because: %s", err)
+	}
+	if err := service.Delete(ctx, archived); err != nil {
+		t.Fatalf("the player could not be deleted because: %s", err)
+	}
+
+	// When they are searched with a typo
+	result, err := service.Search(ctx, "zhnag", 0)
+
+	// Then only the active player is found
+	if err != nil {
+		t.Fatalf("The players could not be searched because: %s", err.Error())
+	}
+	if len(result) != 1 || result[0].Player.Names != "Zhang Jike" {
+		t.Errorf("only Zhang Jike was expected, but got: %+v", result)
+	}
+
+	// And searches without text or with a bad limit are not valid
+	for text, limit := range map[string]int{"": 0, "zhang": domain.MaxPageSize + 1} {
+		if _, err := service.Search(ctx, text, limit); errors.Cause(err) != playerapp.ErrInvalidQuery {
+			t.Errorf("error %q was expected for %q and limit %d, but got: %v", playerapp.ErrInvalidQuery, text, limit, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package playerapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// RebuildReport tells what a rebuild of the statistics of the players did.
+type RebuildReport struct {
+	Entries int `json:"entries"` // entries of the statistics log that were replayed
+	Players int `json:"players"` // players whose statistics changed
+}
+
+// errReplayStopped stops a replay of the statistics log at its first entry.
+var errReplayStopped = errors.New("replay of the statistics log was stopped")
+
+// RebuildStatistics replays the statistics log and stores the wins and losses of every
+// player, archived ones included, that don't match them. Players without entries in the
+// log have no wins nor losses. It runs in a transaction, so every player is rebuilt from
+// the same entries or none is. Unless it is forced, a log on memory, that lost the entries
+// appended before the service started, or a log without entries is not rebuilt.
+func (b basicPlayerService) RebuildStatistics(ctx context.Context, force bool) (RebuildReport, error) {
+	log.Infof("getting ready to rebuild the statistics of the players, forced: %t", force)
+	if !force && domain.IsStatisticsLogOnMemory(b.statistics) {
+		log.Warn("statistics log on memory is not rebuilt without force")
+		return RebuildReport{}, errors.Wrap(ErrUnsafeRebuild, "statistics log is kept on memory, it only has the matches played since the service started")
+	}
+	var report RebuildReport
+	err := domain.RunInTransaction(ctx, b.repository, func(ctx context.Context) error {
+		projection := make(domain.StatisticsProjection)
+		err := b.statistics.Replay(ctx, func(entry domain.StatisticsEntry) error {
+			projection.Apply(entry)
+			report.Entries++
+			return nil
+		})
+		if err != nil {
+			log.Errorf("statistics log cannot be replayed because: %s", err.Error())
+			return errors.Wrap(err, "statistics log could not be replayed")
+		}
+		if !force && report.Entries == 0 {
+			log.Warn("statistics log without entries is not rebuilt without force")
+			return errors.Wrap(ErrUnsafeRebuild, "statistics log has no entries")
+		}
+		var changed []domain.Player
+		err = b.eachPlayer(ctx, func(player domain.Player) {
+			if statistics := projection[player.ID]; statistics.Wins != player.Wins || statistics.Losses != player.Losses {
+				log.Infof("statistics of player %s were %d wins and %d losses, they are rebuilt to %+v", player.ID, player.Wins, player.Losses, statistics)
+				player.Wins, player.Losses = statistics.Wins, statistics.Losses
+				changed = append(changed, player)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		for _, player := range changed {
+			player.Updated = time.Now()
+			if err := b.repository.Update(ctx, &player); err != nil {
+				log.Errorf("statistics of player %s cannot be rebuilt because: %s", player.ID, err.Error())
+				return errors.Wrapf(err, "statistics of player %s could not be rebuilt", player.ID)
+			}
+			b.playersUpdated(ctx, player.ID)
+		}
+		report.Players = len(changed)
+		return nil
+	})
+	if err != nil {
+		return RebuildReport{}, err
+	}
+	log.Infof("statistics were rebuilt from %d entries, %d players changed", report.Entries, report.Players)
+	return report, nil
+}
+
+// SeedStatistics appends a baseline entry with the wins and losses of every player that
+// has any, archived ones included, to a statistics log without entries, so the statistics
+// stored before the log was enabled survive a rebuild. A log with entries is not changed.
+func (b basicPlayerService) SeedStatistics(ctx context.Context) (int, error) {
+	log.Info("getting ready to seed the statistics log")
+	var seeded []domain.Player
+	err := domain.RunInTransaction(ctx, b.repository, func(ctx context.Context) error {
+		err := b.statistics.Replay(ctx, func(entry domain.StatisticsEntry) error {
+			return errReplayStopped
+		})
+		if errors.Cause(err) == errReplayStopped {
+			log.Info("statistics log has entries, it is not seeded")
+			return nil
+		}
+		if err != nil {
+			log.Errorf("statistics log cannot be replayed because: %s", err.Error())
+			return errors.Wrap(err, "statistics log could not be replayed")
+		}
+		err = b.eachPlayer(ctx, func(player domain.Player) {
+			if player.Wins != 0 || player.Losses != 0 {
+				seeded = append(seeded, player)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		for _, player := range seeded {
+			if err := b.recordStatistics(ctx, domain.NewBaselineEntry(player.ID, player.Wins, player.Losses)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("statistics log was seeded with %d players", len(seeded))
+	return len(seeded), nil
+}
+
+// recordStatistics appends the entry to the statistics log right before the transaction
+// of the context is committed, while it still holds the players it changed, so entries
+// are appended in the order their changes are committed. The transaction is rolled back
+// if the entry cannot be appended.
+func (b basicPlayerService) recordStatistics(ctx context.Context, entry *domain.StatisticsEntry) error {
+	return domain.BeforeCommit(ctx, func() error {
+		if err := b.statistics.Append(ctx, entry); err != nil {
+			log.Errorf("statistics entry %+v cannot be appended to the log because: %s", entry, err.Error())
+			return errors.Wrap(err, "statistics entry could not be appended to the log")
+		}
+		return nil
+	})
+}
+
+// eachPlayer calls fn with every player, archived ones included, reading them by pages.
+func (b basicPlayerService) eachPlayer(ctx context.Context, fn func(player domain.Player)) error {
+	query := domain.PlayerQuery{IncludeArchived: true, Sort: []domain.SortKey{{Field: domain.SortByCreated}}, Limit: domain.MaxPageSize}
+	for {
+		page, err := b.repository.FindAll(ctx, query)
+		if err != nil {
+			log.Errorf("players cannot be read because: %s", err.Error())
+			return errors.Wrap(err, "players could not be read")
+		}
+		for _, player := range page.Players {
+			fn(player)
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,224 @@
+package playerapp_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/application/playerapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+	"github.com/pkg/errors"
+)
+
+func TestRebuildStatistics(t *testing.T) {
+	ctx := context.Background()
+	// Given players who played matches
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	statistics := domain.NewMemoryStatisticsLog()
+	service := playerapp.NewBasicPlayerServiceWithStatistics(&repo, domain.NewEventBus(), statistics)
+	malong, err := service.Create(ctx, "Ma Long", 0, 0)
+	assertNoServiceError(t, err)
+	fan, err := service.Create(ctx, "Fan Zhendong", 0, 0)
+	assertNoServiceError(t, err)
+	for index, stats := range []*playerapp.PlayerStatistics{
+		playerapp.NewPlayerStatistics(fan, malong, 1, 1),
+		playerapp.NewPlayerStatistics(malong, fan, 1, 1),
+	} {
+		stats.MatchID = domain.Key(fmt.Sprintf("match%d", index+1))
+		assertNoServiceError(t, service.UpdateStatistics(ctx, *stats))
+	}
+	// and a match that is rolled back
+	err = domain.RunInTransaction(ctx, repo, func(ctx context.Context) error {
+		assertNoServiceError(t, service.UpdateStatistics(ctx, *playerapp.NewPlayerStatistics(malong, fan, 1, 1)))
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("transaction was expected to be rolled back")
+	}
+	// and stored statistics that don't come from the matches of the log
+	tampered, err := repo.FindByID(ctx, malong)
+	assertNoServiceError(t, err)
+	tampered.Wins = 99
+	assertNoServiceError(t, repo.Update(ctx, &tampered))
+	legacy := domain.NewPlayerWithStatistics("Xu Xin", 3, 1)
+	assertNoServiceError(t, repo.Save(ctx, legacy))
+
+	// When the statistics are rebuilt from the log on memory with force
+	report, err := service.RebuildStatistics(ctx, true)
+
+	// Then every match but the rolled back one is replayed and the other statistics are fixed
+	assertNoServiceError(t, err)
+	if report.Entries != 2 || report.Players != 2 {
+		t.Errorf("2 entries and 2 players changed were expected, but got: %+v", report)
+	}
+	for id, want := range map[domain.Key]domain.Statistics{malong: {Wins: 1, Losses: 1}, fan: {Wins: 1, Losses: 1}, legacy.ID: {}} {
+		got, err := service.FindByID(ctx, id)
+		assertNoServiceError(t, err)
+		if got.Wins != want.Wins || got.Losses != want.Losses {
+			t.Errorf("player %s was expected with %+v, but got: %+v", got.Names, want, got)
+		}
+	}
+	var matches []string
+	assertNoServiceError(t, statistics.Replay(ctx, func(entry domain.StatisticsEntry) error {
+		matches = append(matches, string(entry.Kind)+":"+string(entry.MatchID))
+		return nil
+	}))
+	if strings.Join(matches, " ") != "match:match1 match:match2" {
+		t.Errorf("entries of the matches were expected, but got: %v", matches)
+	}
+}
+
+func TestSeededStatisticsSurviveRebuilds(t *testing.T) {
+	ctx := context.Background()
+	// Given a player with statistics stored before the log was enabled
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	legacy := domain.NewPlayerWithStatistics("Xu Xin", 3, 1)
+	assertNoServiceError(t, repo.Save(ctx, legacy))
+	// and a player without them
+	rookie := domain.NewPlayer("Lin Shidong")
+	assertNoServiceError(t, repo.Save(ctx, rookie))
+	statistics, err := repository.NewStatisticsLogOnFile(filepath.Join(t.TempDir(), "statistics.log"))
+	assertNoServiceError(t, err)
+	defer statistics.(io.Closer).Close()
+	service := playerapp.NewBasicPlayerServiceWithStatistics(&repo, domain.NewEventBus(), statistics)
+
+	// When the empty log is rebuilt without force
+	_, errempty := service.RebuildStatistics(ctx, false)
+	// and it is seeded twice
+	seeded, err := service.SeedStatistics(ctx)
+	assertNoServiceError(t, err)
+	reseeded, err := service.SeedStatistics(ctx)
+	assertNoServiceError(t, err)
+	// and a match is played
+	assertNoServiceError(t, service.UpdateStatistics(ctx, *playerapp.NewPlayerStatistics(legacy.ID, rookie.ID, 1, 1)))
+	// and the statistics are rebuilt without force
+	report, err := service.RebuildStatistics(ctx, false)
+
+	// Then the empty log is not rebuilt
+	if errors.Cause(errempty) != playerapp.ErrUnsafeRebuild {
+		t.Errorf("error %q was expected, but got: %v", playerapp.ErrUnsafeRebuild, errempty)
+	}
+	// and only the player with statistics is seeded once
+	if seeded != 1 || reseeded != 0 {
+		t.Errorf("1 player seeded and then none were expected, but got: %d and %d", seeded, reseeded)
+	}
+	// and the rebuild keeps the statistics of the seed and the match
+	assertNoServiceError(t, err)
+	if report.Entries != 2 || report.Players != 0 {
+		t.Errorf("2 entries and no player changed were expected, but got: %+v", report)
+	}
+	for id, want := range map[domain.Key]domain.Statistics{legacy.ID: {Wins: 4, Losses: 1}, rookie.ID: {Losses: 1}} {
+		got, err := service.FindByID(ctx, id)
+		assertNoServiceError(t, err)
+		if got.Wins != want.Wins || got.Losses != want.Losses {
+			t.Errorf("player %s was expected with %+v, but got: %+v", got.Names, want, got)
+		}
+	}
+}
+
+func TestStatisticsOnMemoryAreNotRebuiltWithoutForce(t *testing.T) {
+	ctx := context.Background()
+	// Given a player who played a match and a log on memory
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+	malong, err := service.Create(ctx, "Ma Long", 0, 0)
+	assertNoServiceError(t, err)
+	fan, err := service.Create(ctx, "Fan Zhendong", 0, 0)
+	assertNoServiceError(t, err)
+	assertNoServiceError(t, service.UpdateStatistics(ctx, *playerapp.NewPlayerStatistics(malong, fan, 1, 1)))
+
+	// When the statistics are rebuilt without force
+	_, err = service.RebuildStatistics(ctx, false)
+
+	// Then they are not rebuilt
+	if errors.Cause(err) != playerapp.ErrUnsafeRebuild {
+		t.Errorf("error %q was expected, but got: %v", playerapp.ErrUnsafeRebuild, err)
+	}
+}
+
+func TestStatisticsOnlyComeFromMatches(t *testing.T) {
+	ctx := context.Background()
+	// Given a player
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	statistics := domain.NewMemoryStatisticsLog()
+	service := playerapp.NewBasicPlayerServiceWithStatistics(&repo, domain.NewEventBus(), statistics)
+	malong, err := service.Create(ctx, "Ma Long", 0, 0)
+	assertNoServiceError(t, err)
+
+	// When a player is created with wins
+	_, errcreate := service.Create(ctx, "Fan Zhendong", 3, 0)
+	// and the losses of a player are changed
+	_, errupdate := service.Update(ctx, malong, func(player *domain.Player) error {
+		player.Losses = 4
+		return nil
+	})
+	// and a player with wins is imported
+	report, errimport := service.Import(ctx, strings.NewReader("names,wins,losses\nXu Xin,3,1\nWang Hao,0,0\n"), playerapp.CSVFormat, false)
+
+	// Then they are not valid
+	for name, err := range map[string]error{"create": errcreate, "update": errupdate} {
+		if errors.Cause(err) != playerapp.ErrInvalidPlayer {
+			t.Errorf("%s: error %q was expected, but got: %v", name, playerapp.ErrInvalidPlayer, err)
+		}
+	}
+	assertNoServiceError(t, errimport)
+	assertImportReport(t, report, false, 1, []int{2})
+	// and the statistics log is empty
+	if got, err := domain.ProjectStatistics(ctx, statistics); err != nil || len(got) != 0 {
+		t.Errorf("statistics log was expected empty, but got: %+v, %v", got, err)
+	}
+	if got, err := service.FindByID(ctx, malong); err != nil || got.Losses != 0 {
+		t.Errorf("player %s was expected without losses, but got: %+v, %v", malong, got, err)
+	}
+}
+
+func TestMatchIsNotRecordedWithoutItsEntry(t *testing.T) {
+	ctx := context.Background()
+	// Given two players and a statistics log that cannot be appended
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	failure := errors.New("disk is full")
+	service := playerapp.NewBasicPlayerServiceWithStatistics(&repo, domain.NewEventBus(), failingStatisticsLog{failure})
+	malong, err := service.Create(ctx, "Ma Long", 0, 0)
+	assertNoServiceError(t, err)
+	fan, err := service.Create(ctx, "Fan Zhendong", 0, 0)
+	assertNoServiceError(t, err)
+
+	// When they play a match
+	err = service.UpdateStatistics(ctx, *playerapp.NewPlayerStatistics(malong, fan, 1, 1))
+
+	// Then it fails and neither their statistics nor their ratings change
+	if errors.Cause(err) != failure {
+		t.Errorf("error %q was expected, but got: %v", failure, err)
+	}
+	for _, id := range []domain.Key{malong, fan} {
+		got, err := service.FindByID(ctx, id)
+		assertNoServiceError(t, err)
+		if got.Wins != 0 || got.Losses != 0 || got.Rating != domain.DefaultRating {
+			t.Errorf("player %s must not change, but got: %+v", got.Names, got)
+		}
+	}
+}
+
+// failingStatisticsLog is a statistics log whose entries cannot be appended.
+type failingStatisticsLog struct {
+	err error
+}
+
+func (f failingStatisticsLog) Append(ctx context.Context, entry *domain.StatisticsEntry) error {
+	return f.err
+}
+
+func (f failingStatisticsLog) Replay(ctx context.Context, fn func(entry domain.StatisticsEntry) error) error {
+	return nil
+}
+
+func assertNoServiceError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("no error was expected, but got: %s", err)
+	}
+}
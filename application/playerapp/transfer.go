@@ -0,0 +1,304 @@
+package playerapp
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// TransferFormat is a format players are imported and exported in.
+type TransferFormat string
+
+// Formats players are imported and exported in.
+const (
+	CSVFormat    TransferFormat = "csv"    // comma separated values with a header
+	NDJSONFormat TransferFormat = "ndjson" // a json object on every line
+)
+
+var (
+	// ErrUnknownFormat is returned when players are imported or exported in a format that
+	// is not csv nor ndjson.
+	ErrUnknownFormat = errors.New("format is not known, it must be csv or ndjson")
+	// ErrInvalidImport is returned when the players to import cannot be read at all, e.g.
+	// a csv file without the names column.
+	ErrInvalidImport = errors.New("players cannot be imported")
+)
+
+// exportColumns are the columns of an exported csv file, the ones import doesn't read are
+// ignored so an exported file can be imported again. Players with wins or losses are not
+// imported, because they only come from the matches played.
+var exportColumns = []string{"id", "names", "wins", "losses", "rating", "style", "handedness", "grip", "created", "updated", "version"}
+
+// ImportReport tells how many players were imported and why the rest were not.
+type ImportReport struct {
+	DryRun   bool          `json:"dryRun"`           // nothing was stored, players were only validated
+	Imported int           `json:"imported"`         // players stored, or that would be stored on a dry run
+	Failed   int           `json:"failed"`           // lines that cannot be imported
+	Errors   []ImportError `json:"errors,omitempty"` // why every failed line cannot be imported
+}
+
+// ImportError is a line of the imported file that cannot be imported.
+type ImportError struct {
+	Line  int    `json:"line"` // line of the file, the header of a csv file is the line 1
+	Error string `json:"error"`
+}
+
+// playerRow is the data of a player read from an imported line.
+type playerRow struct {
+	Names  string `json:"names"`
+	Wins   int    `json:"wins"`   // read to refuse the lines that set them
+	Losses int    `json:"losses"` // read to refuse the lines that set them
+	domain.PlayerProfile
+}
+
+// importLine is a line of an imported file with the player read from it, or why it
+// cannot be read.
+type importLine struct {
+	number int
+	row    playerRow
+	err    error
+}
+
+// rowReader reads the next line of an imported file, it returns io.EOF at the end of the
+// file and other errors when the rest of the file cannot be read.
+type rowReader func() (importLine, error)
+
+// ParseTransferFormat returns the format with the given name.
+func ParseTransferFormat(name string) (TransferFormat, error) {
+	switch format := TransferFormat(strings.ToLower(strings.TrimSpace(name))); format {
+	case CSVFormat, NDJSONFormat:
+		return format, nil
+	}
+	return "", errors.Wrapf(ErrUnknownFormat, "format %q cannot be used", name)
+}
+
+// Import creates the players of the given csv or ndjson input, every line is validated
+// as a new player and the lines that are not valid are reported and skipped. The valid
+// players are stored in a single transaction, nothing is stored on a dry run.
+func (b basicPlayerService) Import(ctx context.Context, input io.Reader, format TransferFormat, dryRun bool) (ImportReport, error) {
+	log.Infof("getting ready to import players in format %s, dry run: %t", format, dryRun)
+	next, err := newRowReader(input, format)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	report := ImportReport{DryRun: dryRun}
+	// every line is read and validated before the transaction, so it is only held to store them
+	var created []domain.Player
+	for {
+		line, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImportReport{}, errors.Wrap(ErrInvalidImport, err.Error())
+		}
+		if line.err == nil && (line.row.Wins != 0 || line.row.Losses != 0) {
+			line.err = errors.New(statisticsCannotBeSet)
+		}
+		if line.err == nil {
+			player := domain.NewPlayer(line.row.Names)
+			player.PlayerProfile = line.row.PlayerProfile
+			if _, line.err = domain.ValidatePlayer(*player); line.err == nil {
+				created = append(created, *player)
+			}
+		}
+		if line.err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, ImportError{Line: line.number, Error: strings.ReplaceAll(line.err.Error(), "\n", "; ")})
+			continue
+		}
+		report.Imported++
+	}
+	if dryRun || len(created) == 0 {
+		log.Infof("import finished with %d players valid and %d lines failed, nothing was stored", report.Imported, report.Failed)
+		return report, nil
+	}
+	err = domain.RunInTransaction(ctx, b.repository, func(ctx context.Context) error {
+		for index := range created {
+			player := &created[index]
+			if err := b.repository.Save(ctx, player); err != nil {
+				log.Errorf("imported player %v cannot be stored because: %s", player, err.Error())
+				return errors.Wrapf(err, "player %s cannot be stored", player.Names)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportReport{}, err
+	}
+	for _, player := range created {
+		if err := b.bus.Publish(ctx, domain.PlayerCreated{Player: player}); err != nil { // just the logs
+			log.Errorf("creation of player %s cannot be published because: %s", player.ID, err.Error())
+		}
+	}
+	log.Infof("import finished with %d players imported and %d lines failed", report.Imported, report.Failed)
+	return report, nil
+}
+
+// Export writes every player that is not archived in the given format, in the order they
+// were created. Players are read and written by pages, so they are never all in memory.
+func (b basicPlayerService) Export(ctx context.Context, output io.Writer, format TransferFormat) error {
+	log.Infof("getting ready to export players in format %s", format)
+	var write func(players []domain.Player) error
+	switch format {
+	case CSVFormat:
+		writer := csv.NewWriter(output)
+		if err := writer.Write(exportColumns); err != nil {
+			return errors.Wrap(err, "players cannot be exported")
+		}
+		write = func(players []domain.Player) error {
+			for _, player := range players {
+				if err := writer.Write(csvRecord(player)); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+	case NDJSONFormat:
+		encoder := json.NewEncoder(output)
+		write = func(players []domain.Player) error {
+			for _, player := range players {
+				if err := encoder.Encode(player); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		return errors.Wrapf(ErrUnknownFormat, "format %q cannot be used", format)
+	}
+	query := domain.PlayerQuery{Sort: []domain.SortKey{{Field: domain.SortByCreated}}, Limit: domain.MaxPageSize}
+	exported := 0
+	for {
+		page, err := b.repository.FindAll(ctx, query)
+		if err != nil {
+			log.Errorf("players cannot be exported because: %s", err.Error())
+			return errors.Wrap(err, "players cannot be exported")
+		}
+		if err := write(page.Players); err != nil {
+			return errors.Wrap(err, "players cannot be exported")
+		}
+		exported += len(page.Players)
+		if page.NextCursor == "" {
+			log.Infof("%d players were exported", exported)
+			return nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// newRowReader returns the reader of the lines of the input in the given format.
+func newRowReader(input io.Reader, format TransferFormat) (rowReader, error) {
+	switch format {
+	case CSVFormat:
+		return newCSVReader(input)
+	case NDJSONFormat:
+		return newNDJSONReader(input), nil
+	}
+	return nil, errors.Wrapf(ErrUnknownFormat, "format %q cannot be used", format)
+}
+
+// newCSVReader reads the header of the csv input and returns the reader of the rest of
+// its lines. The names column is required, columns that are not known are ignored.
+func newCSVReader(input io.Reader) (rowReader, error) {
+	reader := csv.NewReader(input)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidImport, "csv header cannot be read: %s", err)
+	}
+	columns := make(map[string]int, len(header))
+	for index, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+	if _, ok := columns["names"]; !ok {
+		return nil, errors.Wrap(ErrInvalidImport, "csv header must have the names column")
+	}
+	return func() (importLine, error) {
+		record, err := reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return importLine{number: parseErr.StartLine, err: parseErr.Err}, nil
+		}
+		if err != nil {
+			return importLine{}, err
+		}
+		number, _ := reader.FieldPos(0)
+		row, err := csvRow(record, columns)
+		return importLine{number: number, row: row, err: err}, nil
+	}, nil
+}
+
+// csvRow reads a player from the fields of a csv line.
+func csvRow(record []string, columns map[string]int) (playerRow, error) {
+	field := func(name string) string {
+		if index, ok := columns[name]; ok {
+			return strings.TrimSpace(record[index])
+		}
+		return ""
+	}
+	row := playerRow{
+		Names: field("names"),
+		PlayerProfile: domain.PlayerProfile{
+			Style:      domain.PlayingStyle(field("style")),
+			Handedness: domain.Handedness(field("handedness")),
+			Grip:       domain.Grip(field("grip")),
+		},
+	}
+	for name, target := range map[string]*int{"wins": &row.Wins, "losses": &row.Losses} {
+		if value := field(name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return playerRow{}, fmt.Errorf("%s %q must be a number", name, value)
+			}
+			*target = number
+		}
+	}
+	return row, nil
+}
+
+// newNDJSONReader returns the reader of the json objects of every line of the input,
+// blank lines are skipped.
+func newNDJSONReader(input io.Reader) rowReader {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	number := 0
+	return func() (importLine, error) {
+		for scanner.Scan() {
+			number++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var row playerRow
+			if err := json.Unmarshal([]byte(text), &row); err != nil {
+				return importLine{number: number, err: fmt.Errorf("player cannot be read: %s", err)}, nil
+			}
+			return importLine{number: number, row: row}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return importLine{}, err
+		}
+		return importLine{}, io.EOF
+	}
+}
+
+// csvRecord returns the fields of the exported csv line of the player.
+func csvRecord(player domain.Player) []string {
+	return []string{
+		string(player.ID), player.Names, strconv.Itoa(player.Wins), strconv.Itoa(player.Losses),
+		strconv.Itoa(player.Rating), string(player.Style), string(player.Handedness), string(player.Grip),
+		player.Created.UTC().Format(time.RFC3339Nano), player.Updated.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(player.Version),
+	}
+}
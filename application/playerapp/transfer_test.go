@@ -0,0 +1,219 @@
+package playerapp_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/application/playerapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+	"github.com/pkg/errors"
+)
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	// Given a csv file with valid and invalid players
+	input := "names,wins,losses,style,unknown\n" +
+		"Ma Long,0,0,penhold-attacker,x\n" +
+		" ,0,0,,\n" +
+		"Fan Zhendong,many,0,,\n" +
+		"Xu Xin,3,-1,,\n" +
+		"Lin Gaoyuan,4\n" +
+		"\"Wang, Chuqin\",0,,,\n"
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+
+	// When it is imported on a dry run
+	report, err := service.Import(ctx, strings.NewReader(input), playerapp.CSVFormat, true)
+
+	// Then the lines are validated but nothing is stored
+	if err != nil {
+		t.Fatalf("The players could not be imported because: %s", err)
+	}
+	expectedLines := []int{3, 4, 5, 6}
+	assertImportReport(t, report, true, 2, expectedLines)
+	assertPlayersCount(t, service, 0)
+
+	// When it is imported
+	report, err = service.Import(ctx, strings.NewReader(input), playerapp.CSVFormat, false)
+
+	// Then the valid players are stored
+	if err != nil {
+		t.Fatalf("The players could not be imported because: %s", err)
+	}
+	assertImportReport(t, report, false, 2, expectedLines)
+	page := assertPlayersCount(t, service, 2)
+	if got := page.Players[0]; got.Names != "Ma Long" || got.Wins != 0 || got.Losses != 0 || got.Style != domain.PenholdAttacker {
+		t.Errorf("Ma Long with penhold attacker style was expected, but got: %+v", got)
+	}
+	if !strings.Contains(report.Errors[0].Error, "Player names cannot") || !strings.Contains(report.Errors[1].Error, "wins \"many\"") ||
+		!strings.Contains(report.Errors[2].Error, "cannot be set") {
+		t.Errorf("the reasons of every line were expected, but got: %+v", report.Errors)
+	}
+}
+
+func TestImportValidatesBeforeTheTransaction(t *testing.T) {
+	ctx := context.Background()
+	// Given a csv file with a valid and an invalid player
+	input := "names\nMa Long\n \n"
+	counting := &beginCounter{PlayerRepository: repository.NewPlayerRepositoryOnMemory(5)}
+	var repo domain.PlayerRepository = counting
+	service := playerapp.NewBasicPlayerService(&repo)
+
+	// When it is imported on a dry run
+	report, err := service.Import(ctx, strings.NewReader(input), playerapp.CSVFormat, true)
+
+	// Then the lines are validated without beginning a transaction
+	if err != nil {
+		t.Fatalf("The players could not be imported because: %s", err)
+	}
+	assertImportReport(t, report, true, 1, []int{3})
+	if counting.begun != 0 {
+		t.Errorf("no transaction was expected on a dry run, but %d were begun", counting.begun)
+	}
+
+	// When it is imported
+	report, err = service.Import(ctx, strings.NewReader(input), playerapp.CSVFormat, false)
+
+	// Then a single transaction stores the valid player
+	if err != nil {
+		t.Fatalf("The players could not be imported because: %s", err)
+	}
+	assertImportReport(t, report, false, 1, []int{3})
+	if counting.begun != 1 {
+		t.Errorf("a single transaction was expected, but %d were begun", counting.begun)
+	}
+	assertPlayersCount(t, service, 1)
+}
+
+func TestImportNDJSON(t *testing.T) {
+	ctx := context.Background()
+	// Given a ndjson file with a blank line and a line that is not json
+	input := `{"names": "Timo Boll", "handedness": "left"}
+
+{"names": "Dimitrij Ovtcharov"
+{"names": "", "wins": 1}
+`
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+
+	// When it is imported
+	report, err := service.Import(ctx, strings.NewReader(input), playerapp.NDJSONFormat, false)
+
+	// Then the valid player is stored and the lines are counted with the blank one
+	if err != nil {
+		t.Fatalf("The players could not be imported because: %s", err)
+	}
+	assertImportReport(t, report, false, 1, []int{3, 4})
+	page := assertPlayersCount(t, service, 1)
+	if got := page.Players[0]; got.Names != "Timo Boll" || got.Handedness != domain.LeftHanded {
+		t.Errorf("Timo Boll left handed was expected, but got: %+v", got)
+	}
+}
+
+func TestImportInvalidFile(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+	tests := map[string]struct {
+		input  string
+		format playerapp.TransferFormat
+		want   error
+	}{
+		"without names": {input: "wins,losses\n1,2\n", format: playerapp.CSVFormat, want: playerapp.ErrInvalidImport},
+		"empty":         {input: "", format: playerapp.CSVFormat, want: playerapp.ErrInvalidImport},
+		"unknown":       {input: "names\nMa Long\n", format: "xml", want: playerapp.ErrUnknownFormat},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := service.Import(context.Background(), strings.NewReader(test.input), test.format, false)
+			if errors.Cause(err) != test.want {
+				t.Errorf("error %q was expected, but got: %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	// Given more players than a page, one who has played matches and an archived one
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	service := playerapp.NewBasicPlayerService(&repo)
+	for i := 0; i < domain.MaxPageSize+5; i++ {
+		if _, err := service.Create(ctx, "Player "+strings.Repeat("x", i+1), 0, 0); err != nil {
+			t.Fatalf("the player could not be created because: %s", err)
+		}
+	}
+	if err := repo.Save(ctx, domain.NewPlayerWithStatistics("Ma Long", 3, 1)); err != nil {
+		t.Fatalf("the player could not be saved because: %s", err)
+	}
+	archived, err := service.Create(ctx, "Zhang Yining", 0, 0)
+	if err != nil {
+		t.Fatalf("the player could not be created because: %s", err)
+	}
+	if err := service.Delete(ctx, archived); err != nil {
+		t.Fatalf("the player could not be deleted because: %s", err)
+	}
+
+	// and the last line of every format
+	lastLines := map[playerapp.TransferFormat]int{
+		playerapp.CSVFormat:    domain.MaxPageSize + 7,
+		playerapp.NDJSONFormat: domain.MaxPageSize + 6,
+	}
+	for format, last := range lastLines {
+		// When they are exported
+		var output bytes.Buffer
+		if err := service.Export(ctx, &output, format); err != nil {
+			t.Fatalf("The players could not be exported as %s because: %s", format, err)
+		}
+
+		// Then the export is imported again with the same active players, but the one with
+		// statistics, which only come from the matches played
+		if strings.Contains(output.String(), "Zhang Yining") {
+			t.Errorf("archived players must not be exported as %s", format)
+		}
+		other := repository.NewPlayerRepositoryOnMemory(5)
+		imported := playerapp.NewBasicPlayerService(&other)
+		report, err := imported.Import(ctx, &output, format, false)
+		if err != nil {
+			t.Fatalf("The %s export could not be imported because: %s", format, err)
+		}
+		assertImportReport(t, report, false, domain.MaxPageSize+5, []int{last})
+	}
+}
+
+func assertImportReport(t *testing.T, report playerapp.ImportReport, dryRun bool, imported int, failedLines []int) {
+	t.Helper()
+	if report.DryRun != dryRun || report.Imported != imported || report.Failed != len(failedLines) || len(report.Errors) != len(failedLines) {
+		t.Fatalf("report with dry run %t, %d imported and failed lines %v was expected, but got: %+v", dryRun, imported, failedLines, report)
+	}
+	for i, line := range failedLines {
+		if report.Errors[i].Line != line {
+			t.Errorf("line %d was expected to fail, but got: %+v", line, report.Errors[i])
+		}
+	}
+}
+
+func assertPlayersCount(t *testing.T, service playerapp.PlayerService, count int) domain.PlayerPage {
+	t.Helper()
+	page, err := service.FindAll(context.Background(), domain.PlayerQuery{Sort: []domain.SortKey{{Field: domain.SortByCreated}}})
+	if err != nil {
+		t.Fatalf("The players could not be found because: %s", err)
+	}
+	if page.Total != count {
+		t.Fatalf("%d players were expected, but got: %d", count, page.Total)
+	}
+	return page
+}
+
+// beginCounter counts the transactions begun on the repository it wraps.
+type beginCounter struct {
+	domain.PlayerRepository
+	begun int
+}
+
+func (b *beginCounter) Begin(ctx context.Context) (domain.Transaction, error) {
+	b.begun++
+	return b.PlayerRepository.Begin(ctx)
+}
@@ -0,0 +1,4 @@
+// Package webhookapp implements the webhook subscriptions of the application.
+// It delivers the events of the feed to the subscribed urls, signing every
+// payload and retrying failed deliveries.
+package webhookapp
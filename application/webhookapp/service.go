@@ -0,0 +1,448 @@
+package webhookapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/application/feedapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times an event is sent before it is a dead letter
+	DefaultMaxAttempts = 5
+	// DefaultBackoff is the wait after the first failed attempt, it doubles after every attempt
+	DefaultBackoff = time.Second
+	// DefaultTimeout is how long a receiver has to respond to a delivery
+	DefaultTimeout = 5 * time.Second
+	// DefaultDeliveryLog is the number of latest deliveries kept for every subscription
+	DefaultDeliveryLog = 50
+	// DefaultDeadLetters is the number of latest dead letters kept
+	DefaultDeadLetters = 100
+	// DefaultQueue is the number of events that can wait to be delivered to every subscription
+	DefaultQueue = 100
+
+	// EventHeader contains the type of the delivered event
+	EventHeader = "X-Pingpong-Event"
+	// DeliveryHeader contains the id of the delivered event, it is the same on every attempt
+	DeliveryHeader = "X-Pingpong-Delivery"
+	// SignatureHeader contains the HMAC-SHA256 of the payload with the subscription secret
+	SignatureHeader = "X-Pingpong-Signature"
+)
+
+// ErrSubscriptionNotFound is returned when there is no subscription with the given ID.
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+// WebhookService defines behavior to manage webhook subscriptions and deliver events to them.
+type WebhookService interface {
+	// Create creates a subscription and returns it with its secret
+	Create(ctx context.Context, subscription Subscription) (Subscription, error)
+	// FindByID finds a subscription by id
+	FindByID(ctx context.Context, id domain.Key) (Subscription, error)
+	// FindAll get all the subscriptions
+	FindAll(ctx context.Context) ([]Subscription, error)
+	// Update changes the url and events of a subscription, and its secret if it is given
+	Update(ctx context.Context, subscription Subscription) (Subscription, error)
+	// Delete deletes a subscription and its deliveries
+	Delete(ctx context.Context, id domain.Key) error
+	// Deliveries returns the latest delivery attempts of a subscription
+	Deliveries(ctx context.Context, id domain.Key) ([]Delivery, error)
+	// DeadLetters returns the latest events that could not be delivered
+	DeadLetters(ctx context.Context) ([]DeadLetter, error)
+	// Dispatch delivers the event to every subscription interested in it
+	Dispatch(event feedapp.Event)
+	// Follow dispatches the events of the feed until the context is done, then the
+	// deliveries stop
+	Follow(ctx context.Context, feed feedapp.FeedService)
+}
+
+// subscriptionRecord contains a subscription, its latest deliveries and the events
+// waiting to be delivered to it.
+type subscriptionRecord struct {
+	subscription Subscription
+	deliveries   []Delivery
+	queue        chan queuedEvent
+	cancel       context.CancelFunc // stops the worker of the subscription
+}
+
+// queuedEvent is an event waiting to be delivered with its encoded payload.
+type queuedEvent struct {
+	event   feedapp.Event
+	payload []byte
+}
+
+// basicWebhookService implements the webhook service keeping subscriptions on memory.
+type basicWebhookService struct {
+	setting     domain.WebhookSetting
+	client      *http.Client
+	ctx         context.Context    // the workers stop when it is done
+	stop        context.CancelFunc // stops every worker once the feed is no longer followed
+	mu          sync.Mutex
+	records     map[domain.Key]*subscriptionRecord
+	deadLetters []DeadLetter
+}
+
+// NewBasicWebhookService build a basic implementation for webhookservice with the
+// given setting, missing values are replaced with defaults.
+func NewBasicWebhookService(setting domain.WebhookSetting) WebhookService {
+	log.Info("creating basic webhook service")
+	if setting.MaxAttempts < 1 {
+		setting.MaxAttempts = DefaultMaxAttempts
+	}
+	if setting.Backoff <= 0 {
+		setting.Backoff = DefaultBackoff
+	}
+	if setting.Timeout <= 0 {
+		setting.Timeout = DefaultTimeout
+	}
+	if setting.DeliveryLog < 1 {
+		setting.DeliveryLog = DefaultDeliveryLog
+	}
+	if setting.DeadLetters < 1 {
+		setting.DeadLetters = DefaultDeadLetters
+	}
+	if setting.Queue < 1 {
+		setting.Queue = DefaultQueue
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &basicWebhookService{
+		setting: setting,
+		client:  &http.Client{Timeout: setting.Timeout},
+		ctx:     ctx,
+		stop:    stop,
+		records: make(map[domain.Key]*subscriptionRecord),
+	}
+}
+
+// Create creates a subscription, generating its secret if it is empty, and starts the
+// worker that delivers its events.
+func (b *basicWebhookService) Create(ctx context.Context, subscription Subscription) (Subscription, error) {
+	log.Infof("creating webhook subscription for url: %q and events: %v", subscription.URL, subscription.Events)
+	if ok, err := ValidateSubscription(subscription); !ok {
+		log.Infof("subscription %v is not valid, returning from service.", subscription)
+		return Subscription{}, err
+	}
+	if subscription.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			log.Errorf("secret for subscription cannot be generated because: %s", err.Error())
+			return Subscription{}, errors.Wrap(err, "subscription secret could not be generated")
+		}
+		subscription.Secret = secret
+	}
+	subscription.ID = domain.GenerateUUIDKey()
+	subscription.Created = time.Now()
+	subscription.Updated = subscription.Created
+	ctx, cancel := context.WithCancel(b.ctx)
+	record := &subscriptionRecord{
+		subscription: subscription,
+		queue:        make(chan queuedEvent, b.setting.Queue),
+		cancel:       cancel,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records[subscription.ID] = record
+	go b.work(ctx, subscription.ID, record.queue)
+	log.Infof("webhook subscription stored with ID: %s", subscription.ID)
+	return subscription, nil
+}
+
+// FindByID finds a subscription by id without its secret.
+func (b *basicWebhookService) FindByID(ctx context.Context, id domain.Key) (Subscription, error) {
+	log.Infof("finding webhook subscription with id: %s", id)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	record, ok := b.records[id]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return record.subscription.withoutSecret(), nil
+}
+
+// FindAll get all the subscriptions without their secrets, the oldest first.
+func (b *basicWebhookService) FindAll(ctx context.Context) ([]Subscription, error) {
+	log.Info("finding all webhook subscriptions")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]Subscription, 0, len(b.records))
+	for _, record := range b.records {
+		result = append(result, record.subscription.withoutSecret())
+	}
+	sortByCreation(result)
+	return result, nil
+}
+
+// Update changes the url and events of a subscription, and its secret if it is given.
+func (b *basicWebhookService) Update(ctx context.Context, subscription Subscription) (Subscription, error) {
+	log.Infof("updating webhook subscription with id: %s", subscription.ID)
+	if ok, err := ValidateSubscription(subscription); !ok {
+		log.Infof("subscription %v is not valid, returning from service.", subscription)
+		return Subscription{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	record, ok := b.records[subscription.ID]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	record.subscription.URL = subscription.URL
+	record.subscription.Events = subscription.Events
+	if subscription.Secret != "" {
+		record.subscription.Secret = subscription.Secret
+	}
+	record.subscription.Updated = time.Now()
+	return record.subscription.withoutSecret(), nil
+}
+
+// Delete deletes a subscription and its deliveries, the delivery in progress stops and
+// the queued events are discarded.
+func (b *basicWebhookService) Delete(ctx context.Context, id domain.Key) error {
+	log.Infof("deleting webhook subscription with id: %s", id)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	record, ok := b.records[id]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	delete(b.records, id)
+	record.cancel() // the queued events are discarded with the worker
+	return nil
+}
+
+// Deliveries returns the latest delivery attempts of a subscription, the newest first.
+func (b *basicWebhookService) Deliveries(ctx context.Context, id domain.Key) ([]Delivery, error) {
+	log.Infof("finding deliveries of webhook subscription with id: %s", id)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	record, ok := b.records[id]
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+	result := make([]Delivery, len(record.deliveries))
+	for i, delivery := range record.deliveries {
+		result[len(result)-1-i] = delivery
+	}
+	return result, nil
+}
+
+// DeadLetters returns the latest events that could not be delivered, the newest first.
+func (b *basicWebhookService) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	log.Info("finding webhook dead letters")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]DeadLetter, len(b.deadLetters))
+	for i, letter := range b.deadLetters {
+		result[len(result)-1-i] = letter
+	}
+	return result, nil
+}
+
+// Dispatch queues the event to every subscription interested in it. Every subscription
+// has its own worker, so a slow receiver doesn't delay the others, and receives the
+// events in order. The event is a dead letter for a subscription whose queue is full.
+func (b *basicWebhookService) Dispatch(event feedapp.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("event %d cannot be encoded: %s", event.ID, err.Error())
+		return
+	}
+	var dropped []DeadLetter
+	b.mu.Lock()
+	for _, record := range b.records {
+		if !record.subscription.wants(event.Type) {
+			continue
+		}
+		log.Debugf("dispatching event %d to subscription %s", event.ID, record.subscription.ID)
+		select {
+		case record.queue <- queuedEvent{event: event, payload: payload}:
+		default:
+			dropped = append(dropped, DeadLetter{
+				SubscriptionID: record.subscription.ID,
+				URL:            record.subscription.URL,
+				EventID:        event.ID,
+				EventType:      event.Type,
+				LastError:      fmt.Sprintf("delivery queue of %d events is full", b.setting.Queue),
+				Payload:        string(payload),
+				Created:        time.Now(),
+			})
+		}
+	}
+	b.mu.Unlock()
+	for _, letter := range dropped {
+		b.addDeadLetter(letter)
+	}
+}
+
+// work delivers the queued events of the subscription one by one, so they are received
+// in order, until it is deleted or the context is done.
+func (b *basicWebhookService) work(ctx context.Context, subscriptionID domain.Key, queue <-chan queuedEvent) {
+	for {
+		var queued queuedEvent
+		select {
+		case <-ctx.Done():
+			log.Debugf("worker of webhook subscription %s stopped: %s", subscriptionID, ctx.Err())
+			return
+		case queued = <-queue:
+		}
+		b.mu.Lock()
+		record, ok := b.records[subscriptionID]
+		var subscription Subscription
+		if ok {
+			subscription = record.subscription
+		}
+		b.mu.Unlock()
+		if !ok { // deleted while the event was queued
+			continue
+		}
+		b.deliver(ctx, subscription, queued.event, queued.payload)
+	}
+}
+
+// Follow dispatches the events of the feed until the context is done, then the workers
+// stop, the deliveries waiting to be retried included. It should start with the
+// application, otherwise the events kept in the feed are dispatched again.
+func (b *basicWebhookService) Follow(ctx context.Context, feed feedapp.FeedService) {
+	log.Info("following the feed to dispatch webhooks")
+	subscriber := feed.Subscribe(0)
+	for {
+		event, ok := subscriber.Next(ctx)
+		if !ok {
+			log.Info("stop following the feed to dispatch webhooks")
+			b.stop()
+			return
+		}
+		b.Dispatch(event)
+	}
+}
+
+// deliver sends the signed payload to the subscription, waiting an exponential backoff
+// between failed attempts. The event is a dead letter when every attempt fails, but not
+// when the context is done before.
+func (b *basicWebhookService) deliver(ctx context.Context, subscription Subscription, event feedapp.Event, payload []byte) {
+	signature := Sign(subscription.Secret, payload)
+	backoff := b.setting.Backoff
+	var delivery Delivery
+	for attempt := 1; attempt <= b.setting.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				log.Infof("delivery of event %d to subscription %s stopped before attempt %d: %s", event.ID, subscription.ID, attempt, ctx.Err())
+				return
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+		delivery = b.send(ctx, subscription, event, payload, signature)
+		delivery.Attempt = attempt
+		b.addDelivery(subscription.ID, delivery)
+		if delivery.Error == "" {
+			log.Debugf("event %d delivered to subscription %s at attempt %d", event.ID, subscription.ID, attempt)
+			return
+		}
+		if ctx.Err() != nil {
+			log.Infof("delivery of event %d to subscription %s stopped at attempt %d: %s", event.ID, subscription.ID, attempt, ctx.Err())
+			return
+		}
+		log.Warnf("event %d cannot be delivered to subscription %s at attempt %d: %s",
+			event.ID, subscription.ID, attempt, delivery.Error)
+	}
+	b.addDeadLetter(DeadLetter{
+		SubscriptionID: subscription.ID,
+		URL:            subscription.URL,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Attempts:       b.setting.MaxAttempts,
+		LastError:      delivery.Error,
+		Payload:        string(payload),
+		Created:        time.Now(),
+	})
+}
+
+// send makes one attempt to deliver the payload, any response but 2xx is a failure.
+func (b *basicWebhookService) send(ctx context.Context, subscription Subscription, event feedapp.Event, payload []byte, signature string) Delivery {
+	delivery := Delivery{
+		ID:        domain.GenerateUUIDKey(),
+		EventID:   event.ID,
+		EventType: event.Type,
+		Created:   time.Now(),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(payload))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(event.ID, 10))
+	req.Header.Set(SignatureHeader, signature)
+	resp, err := b.client.Do(req)
+	delivery.Duration = time.Since(delivery.Created)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		delivery.Error = fmt.Sprintf("receiver responded %s", resp.Status)
+	}
+	return delivery
+}
+
+// addDelivery adds the delivery to the log of the subscription, if it still exists.
+func (b *basicWebhookService) addDelivery(subscriptionID domain.Key, delivery Delivery) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	record, ok := b.records[subscriptionID]
+	if !ok {
+		return
+	}
+	record.deliveries = append(record.deliveries, delivery)
+	if extra := len(record.deliveries) - b.setting.DeliveryLog; extra > 0 {
+		record.deliveries = record.deliveries[extra:]
+	}
+}
+
+func (b *basicWebhookService) addDeadLetter(letter DeadLetter) {
+	log.Errorf("event %d is a dead letter for subscription %s: %s", letter.EventID, letter.SubscriptionID, letter.LastError)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadLetters = append(b.deadLetters, letter)
+	if extra := len(b.deadLetters) - b.setting.DeadLetters; extra > 0 {
+		b.deadLetters = b.deadLetters[extra:]
+	}
+}
+
+// Sign returns the value of the signature header for the given payload, receivers
+// compute it with their secret to check the payload comes from this service.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func (s Subscription) withoutSecret() Subscription {
+	s.Secret = ""
+	return s
+}
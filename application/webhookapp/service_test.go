@@ -0,0 +1,320 @@
+package webhookapp_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/application/feedapp"
+	"github.com/fernandoocampo/thepingthepong/application/webhookapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// receiver records the requests of the webhook deliveries and responds with the
+// given status codes in order, the last one is repeated.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func newReceiver(statuses ...int) *receiver {
+	return &receiver{statuses: statuses, received: make(chan struct{}, 100)}
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	r.mu.Unlock()
+	w.WriteHeader(status)
+	r.received <- struct{}{}
+}
+
+func (r *receiver) wait(t *testing.T, requests int) {
+	t.Helper()
+	for i := 0; i < requests; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d requests were expected, but got: %d", requests, i)
+		}
+	}
+}
+
+func TestDeliverSignedEvent(t *testing.T) {
+	// given
+	target := newReceiver(http.StatusOK)
+	server := httptest.NewServer(target)
+	defer server.Close()
+	service := webhookapp.NewBasicWebhookService(domain.WebhookSetting{})
+	ctx := context.TODO()
+	subscription, err := service.Create(ctx, webhookapp.Subscription{
+		URL:    server.URL,
+		Events: []string{feedapp.MatchCompletedEvent},
+	})
+	assertNoError(t, err)
+	// when
+	service.Dispatch(feedapp.Event{ID: 1, Type: feedapp.PlayerCreatedEvent})
+	service.Dispatch(feedapp.Event{ID: 2, Type: feedapp.MatchCompletedEvent})
+	target.wait(t, 1)
+	// then
+	target.mu.Lock()
+	defer target.mu.Unlock()
+	if len(target.requests) != 1 {
+		t.Fatalf("only the subscribed event must be delivered, but got %d requests", len(target.requests))
+	}
+	req, body := target.requests[0], target.bodies[0]
+	if got := req.Header.Get(webhookapp.EventHeader); got != feedapp.MatchCompletedEvent {
+		t.Errorf("event header %q was expected, but got: %q", feedapp.MatchCompletedEvent, got)
+	}
+	if got := req.Header.Get(webhookapp.DeliveryHeader); got != "2" {
+		t.Errorf("delivery header %q was expected, but got: %q", "2", got)
+	}
+	want := webhookapp.Sign(subscription.Secret, body)
+	if got := req.Header.Get(webhookapp.SignatureHeader); got != want {
+		t.Errorf("signature %q was expected, but got: %q", want, got)
+	}
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	// given
+	target := newReceiver(http.StatusInternalServerError, http.StatusOK, http.StatusServiceUnavailable)
+	server := httptest.NewServer(target)
+	defer server.Close()
+	service := webhookapp.NewBasicWebhookService(domain.WebhookSetting{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+	})
+	ctx := context.TODO()
+	subscription, err := service.Create(ctx, webhookapp.Subscription{
+		URL:    server.URL,
+		Events: []string{feedapp.PlayerCreatedEvent},
+	})
+	assertNoError(t, err)
+	// when the first event succeeds at the second attempt and the second one always fails
+	service.Dispatch(feedapp.Event{ID: 1, Type: feedapp.PlayerCreatedEvent})
+	target.wait(t, 2)
+	waitFor(t, func() bool {
+		deliveries, _ := service.Deliveries(ctx, subscription.ID)
+		return len(deliveries) == 2
+	})
+	service.Dispatch(feedapp.Event{ID: 2, Type: feedapp.PlayerCreatedEvent})
+	target.wait(t, 3)
+	// then
+	waitFor(t, func() bool {
+		letters, _ := service.DeadLetters(ctx)
+		return len(letters) > 0
+	})
+	letters, err := service.DeadLetters(ctx)
+	assertNoError(t, err)
+	if len(letters) != 1 || letters[0].EventID != 2 || letters[0].Attempts != 3 {
+		t.Fatalf("event 2 must be a dead letter after 3 attempts, but got: %+v", letters)
+	}
+	deliveries, err := service.Deliveries(ctx, subscription.ID)
+	assertNoError(t, err)
+	if len(deliveries) != 5 {
+		t.Fatalf("5 delivery attempts were expected, but got: %+v", deliveries)
+	}
+	first := deliveries[len(deliveries)-1]
+	if first.EventID != 1 || first.Attempt != 1 || first.StatusCode != http.StatusInternalServerError || first.Error == "" {
+		t.Errorf("the first attempt must fail with status 500, but got: %+v", first)
+	}
+	second := deliveries[len(deliveries)-2]
+	if second.EventID != 1 || second.Attempt != 2 || second.StatusCode != http.StatusOK || second.Error != "" {
+		t.Errorf("the second attempt must succeed, but got: %+v", second)
+	}
+}
+
+func TestRetryStopsWhenDeletedOrNotFollowed(t *testing.T) {
+	for name, stop := range map[string]func(service webhookapp.WebhookService, id domain.Key, cancel context.CancelFunc){
+		"deleted": func(service webhookapp.WebhookService, id domain.Key, cancel context.CancelFunc) {
+			assertNoError(t, service.Delete(context.TODO(), id))
+		},
+		"not followed": func(service webhookapp.WebhookService, id domain.Key, cancel context.CancelFunc) {
+			cancel()
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// given a subscription whose receiver always fails and a service following the feed
+			target := newReceiver(http.StatusInternalServerError)
+			server := httptest.NewServer(target)
+			defer server.Close()
+			service := webhookapp.NewBasicWebhookService(domain.WebhookSetting{
+				MaxAttempts: 2,
+				Backoff:     200 * time.Millisecond,
+			})
+			subscription, err := service.Create(context.TODO(), webhookapp.Subscription{
+				URL:    server.URL,
+				Events: []string{feedapp.PlayerCreatedEvent},
+			})
+			assertNoError(t, err)
+			feed := feedapp.NewRingFeed(10)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go service.Follow(ctx, feed)
+			// when the first attempt fails
+			feed.Publish(feedapp.PlayerCreatedEvent, domain.NewPlayer("Ma Long"))
+			target.wait(t, 1)
+			waitFor(t, func() bool {
+				deliveries, _ := service.Deliveries(context.TODO(), subscription.ID)
+				return len(deliveries) == 1
+			})
+			// and the delivery is stopped while it waits to be retried
+			stop(service, subscription.ID, cancel)
+			time.Sleep(400 * time.Millisecond)
+			// then it is neither retried nor a dead letter
+			target.mu.Lock()
+			requests := len(target.requests)
+			target.mu.Unlock()
+			if requests != 1 {
+				t.Errorf("only the first attempt was expected, but got %d requests", requests)
+			}
+			if letters, _ := service.DeadLetters(context.TODO()); len(letters) != 0 {
+				t.Errorf("no dead letter was expected, but got: %+v", letters)
+			}
+		})
+	}
+}
+
+func TestDeliverInOrderAndDropWhenQueueIsFull(t *testing.T) {
+	// given a receiver that holds the first delivery
+	arrived, release := make(chan string, 10), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		arrived <- req.Header.Get(webhookapp.DeliveryHeader)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	service := webhookapp.NewBasicWebhookService(domain.WebhookSetting{Queue: 1})
+	ctx := context.TODO()
+	subscription, err := service.Create(ctx, webhookapp.Subscription{
+		URL:    server.URL,
+		Events: []string{feedapp.PlayerCreatedEvent},
+	})
+	assertNoError(t, err)
+	service.Dispatch(feedapp.Event{ID: 1, Type: feedapp.PlayerCreatedEvent})
+	if got := <-arrived; got != "1" {
+		t.Fatalf("event 1 was expected first, but got: %s", got)
+	}
+
+	// when two more events are dispatched while it is held
+	service.Dispatch(feedapp.Event{ID: 2, Type: feedapp.PlayerCreatedEvent})
+	service.Dispatch(feedapp.Event{ID: 3, Type: feedapp.PlayerCreatedEvent})
+
+	// then the one that doesn't fit in the queue is a dead letter
+	letters, err := service.DeadLetters(ctx)
+	assertNoError(t, err)
+	if len(letters) != 1 || letters[0].EventID != 3 || letters[0].SubscriptionID != subscription.ID {
+		t.Fatalf("event 3 must be a dead letter, but got: %+v", letters)
+	}
+	// and the queued one is delivered after the first one
+	release <- struct{}{}
+	select {
+	case got := <-arrived:
+		if got != "2" {
+			t.Errorf("event 2 was expected after event 1, but got: %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event 2 was not delivered")
+	}
+}
+
+func TestSubscriptionCRUD(t *testing.T) {
+	service := webhookapp.NewBasicWebhookService(domain.WebhookSetting{})
+	ctx := context.TODO()
+
+	_, err := service.Create(ctx, webhookapp.Subscription{URL: "ftp://bots", Events: []string{"tournament.started"}})
+	if err == nil {
+		t.Errorf("a subscription with an ftp url and an unknown event must not be created")
+	}
+	reserved, err := service.Create(ctx, webhookapp.Subscription{
+		URL:    "http://bots.local/tournaments",
+		Events: []string{feedapp.TournamentFinishedEvent},
+	})
+	assertNoError(t, err)
+	assertNoError(t, service.Delete(ctx, reserved.ID))
+	created, err := service.Create(ctx, webhookapp.Subscription{
+		URL:    "http://bots.local/hook",
+		Events: []string{feedapp.PlayerCreatedEvent},
+	})
+	assertNoError(t, err)
+	if created.ID == "" || created.Secret == "" {
+		t.Fatalf("a subscription with id and generated secret was expected, but got: %+v", created)
+	}
+
+	created.Events = []string{feedapp.MatchCompletedEvent}
+	created.Secret = ""
+	updated, err := service.Update(ctx, created)
+	assertNoError(t, err)
+	found, err := service.FindByID(ctx, created.ID)
+	assertNoError(t, err)
+	if len(found.Events) != 1 || found.Events[0] != feedapp.MatchCompletedEvent || found.Secret != "" {
+		t.Errorf("the updated subscription without secret was expected, but got: %+v", found)
+	}
+	if !updated.Updated.After(created.Created) && !updated.Updated.Equal(created.Created) {
+		t.Errorf("update date %s must not be before creation date %s", updated.Updated, created.Created)
+	}
+	all, err := service.FindAll(ctx)
+	assertNoError(t, err)
+	if len(all) != 1 {
+		t.Errorf("one subscription was expected, but got: %+v", all)
+	}
+
+	assertNoError(t, service.Delete(ctx, created.ID))
+	if _, err := service.FindByID(ctx, created.ID); err != webhookapp.ErrSubscriptionNotFound {
+		t.Errorf("a deleted subscription must not be found, but got: %v", err)
+	}
+	if err := service.Delete(ctx, created.ID); err != webhookapp.ErrSubscriptionNotFound {
+		t.Errorf("a deleted subscription cannot be deleted again, but got: %v", err)
+	}
+}
+
+func TestFollowFeed(t *testing.T) {
+	// given
+	target := newReceiver(http.StatusNoContent)
+	server := httptest.NewServer(target)
+	defer server.Close()
+	feed := feedapp.NewRingFeed(10)
+	service := webhookapp.NewBasicWebhookService(domain.WebhookSetting{})
+	_, err := service.Create(context.TODO(), webhookapp.Subscription{
+		URL:    server.URL,
+		Events: []string{feedapp.PlayerCreatedEvent},
+	})
+	assertNoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.Follow(ctx, feed)
+	// when
+	feed.Publish(feedapp.PlayerCreatedEvent, domain.NewPlayer("Ma Long"))
+	// then
+	target.wait(t, 1)
+}
+
+// waitFor waits until the condition is true, the deliveries are recorded in background.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	for start := time.Now(); !condition(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("condition was not met after 5 seconds")
+		}
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("error was not expected, but: %s", err)
+	}
+}
@@ -0,0 +1,108 @@
+package webhookapp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/application/feedapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// Subscription contains the url where the events of the given types are delivered.
+type Subscription struct {
+	ID      domain.Key `json:"id,omitempty"`
+	URL     string     `json:"url"`              // receiver of the events
+	Events  []string   `json:"events"`           // types of the events to deliver, e.g. match.completed
+	Secret  string     `json:"secret,omitempty"` // key to sign the payloads, only returned when created
+	Created time.Time  `json:"created"`
+	Updated time.Time  `json:"updated"`
+}
+
+// Delivery contains the result of an attempt to deliver an event to a subscription.
+type Delivery struct {
+	ID         domain.Key    `json:"id"`
+	EventID    uint64        `json:"eventID"`
+	EventType  string        `json:"eventType"`
+	Attempt    int           `json:"attempt"`              // from 1 to the configured attempts
+	StatusCode int           `json:"statusCode,omitempty"` // response of the receiver, if any
+	Error      string        `json:"error,omitempty"`      // why the attempt failed
+	Duration   time.Duration `json:"duration"`
+	Created    time.Time     `json:"created"`
+}
+
+// DeadLetter contains an event that could not be delivered after every attempt.
+type DeadLetter struct {
+	SubscriptionID domain.Key `json:"subscriptionID"`
+	URL            string     `json:"url"`
+	EventID        uint64     `json:"eventID"`
+	EventType      string     `json:"eventType"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"lastError"`
+	Payload        string     `json:"payload"` // the signed body that was sent
+	Created        time.Time  `json:"created"`
+}
+
+// eventTypes contains the types of the events that can be subscribed, reserved ones
+// included, so bots can subscribe to them before they are published
+var eventTypes = []string{
+	feedapp.MatchCompletedEvent,
+	feedapp.PlayerCreatedEvent,
+	feedapp.PlayerUpdatedEvent,
+	feedapp.TournamentFinishedEvent,
+}
+
+// ValidateSubscription checks that the given subscription has an http url and known event types.
+func ValidateSubscription(subscription Subscription) (bool, error) {
+	var result []string
+	log.Debugf("validating subscription %v", subscription)
+	target, err := url.Parse(subscription.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		result = append(result, fmt.Sprintf("Subscription url %q must be an absolute http or https url", subscription.URL))
+	}
+	if len(subscription.Events) == 0 {
+		result = append(result, "Subscription events cannot be empty")
+	}
+	for _, event := range subscription.Events {
+		if !knownEventType(event) {
+			result = append(result, fmt.Sprintf("Subscription event %q is not valid, it must be one of: %s",
+				event, strings.Join(eventTypes, ", ")))
+		}
+	}
+
+	if len(result) > 0 {
+		strresult := strings.Join(result, "\n")
+		log.Debugf("subscription %v is not valid, because: %s \n", subscription, strresult)
+		return false, errors.New(strresult)
+	}
+	return true, nil
+}
+
+func knownEventType(eventType string) bool {
+	for _, known := range eventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// wants returns true if the subscription is interested in the given event type.
+func (s Subscription) wants(eventType string) bool {
+	for _, event := range s.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByCreation sorts the given subscriptions from the oldest to the newest.
+func sortByCreation(subscriptions []Subscription) {
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Created.Before(subscriptions[j].Created)
+	})
+}
@@ -0,0 +1,77 @@
+// Command enginebalance checks the calibration of the match engine. It generates
+// synthetic pools of players, simulates matches for every pairing through the domain
+// engine and prints calibration tables as text or CSV. It runs completely offline.
+//
+// Usage:
+//
+//	go run ./cmd/enginebalance -players 8 -matches 1000 -format csv
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// options contains the parameters given in the command line.
+type options struct {
+	pools     int   // number of synthetic pools
+	players   int   // players per pool
+	matches   int   // matches simulated per pairing
+	minRating int   // lowest rating of the synthetic players
+	maxRating int   // highest rating of the synthetic players
+	gapStep   int   // width of the rating gap buckets
+	workers   int   // workers simulating matches in parallel
+	seed      int64 // seed to generate the synthetic pools
+	format    string
+}
+
+func main() {
+	opts := options{}
+	flag.IntVar(&opts.pools, "pools", 2, "number of synthetic player pools")
+	flag.IntVar(&opts.players, "players", 8, "number of players per pool")
+	flag.IntVar(&opts.matches, "matches", 500, "number of matches simulated per pairing")
+	flag.IntVar(&opts.minRating, "min-rating", 1000, "lowest rating of the synthetic players")
+	flag.IntVar(&opts.maxRating, "max-rating", 2200, "highest rating of the synthetic players")
+	flag.IntVar(&opts.gapStep, "gap-step", 100, "width of the rating gap buckets")
+	flag.IntVar(&opts.workers, "workers", runtime.NumCPU(), "number of workers simulating matches")
+	flag.Int64Var(&opts.seed, "seed", 1, "seed used to generate the synthetic pools")
+	flag.StringVar(&opts.format, "format", "text", "output format: text or csv")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "enginebalance: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	if opts.pools < 1 || opts.players < 2 || opts.matches < 1 || opts.workers < 1 {
+		return fmt.Errorf("pools, matches and workers must be greater than zero and players greater than one")
+	}
+	if opts.gapStep < 1 || opts.minRating < 0 || opts.maxRating < opts.minRating {
+		return fmt.Errorf("gap-step must be greater than zero and ratings must be a valid range")
+	}
+	if opts.format != "text" && opts.format != "csv" {
+		return fmt.Errorf("unknown format %q, expected text or csv", opts.format)
+	}
+	// the engine logs through the domain logger
+	domain.InitLog(domain.LogData{Level: "warn", Format: "text"})
+
+	random := rand.New(rand.NewSource(opts.seed))
+	report := newBalanceReport(opts.gapStep, domain.DefaultGamesToWin)
+	for i := 0; i < opts.pools; i++ {
+		pool := newPlayerPool(random, opts.players, opts.minRating, opts.maxRating)
+		simulatePool(pool, opts.matches, opts.workers, report)
+	}
+
+	if opts.format == "csv" {
+		return report.writeCSV(os.Stdout)
+	}
+	report.writeText(os.Stdout)
+	return nil
+}
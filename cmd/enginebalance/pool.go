@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+var (
+	styles     = []domain.PlayingStyle{domain.OffensiveLooper, domain.PenholdAttacker, domain.Chopper, domain.AllRounder}
+	handedness = []domain.Handedness{domain.RightHanded, domain.LeftHanded}
+)
+
+// pairing contains two players of a pool that face each other.
+type pairing struct {
+	player1, player2 domain.Player
+}
+
+// newPlayerPool generates players with random ratings in the given range and random
+// playing styles.
+func newPlayerPool(random *rand.Rand, size, minRating, maxRating int) []domain.Player {
+	pool := make([]domain.Player, size)
+	for i := range pool {
+		player := domain.NewPlayer(fmt.Sprintf("Synthetic %d", i+1))
+		player.Rating = minRating + random.Intn(maxRating-minRating+1)
+		player.Style = styles[random.Intn(len(styles))]
+		player.Handedness = handedness[random.Intn(len(handedness))]
+		player.Grip = domain.ShakehandGrip
+		if player.Style == domain.PenholdAttacker {
+			player.Grip = domain.PenholdGrip
+		}
+		pool[i] = *player
+	}
+	return pool
+}
+
+// simulatePool simulates the given number of matches for every pairing of the pool on a
+// pool of workers and adds the results to the report.
+func simulatePool(pool []domain.Player, matches, workers int, report *balanceReport) {
+	settings := domain.DefaultMatchSettings()
+	settings.Quiet = true
+	jobs := make(chan pairing)
+	results := make(chan matchResult, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				match, err := domain.SimulateMatchContext(context.Background(), job.player1, job.player2, settings)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "enginebalance: match between %q and %q was stopped: %s\n", job.player1.Names, job.player2.Names, err)
+					continue
+				}
+				results <- newMatchResult(job, match)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; i < len(pool); i++ {
+			for j := i + 1; j < len(pool); j++ {
+				for m := 0; m < matches; m++ {
+					jobs <- pairing{player1: pool[i], player2: pool[j]}
+				}
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	for result := range results {
+		report.add(result)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// matchResult contains the outcome of a simulated match from the point of view of the
+// player with the highest rating, the favorite.
+type matchResult struct {
+	gap         int  // rating of the favorite minus rating of the underdog
+	favoriteWon bool // true if the favorite won the match
+	loserGames  int  // games won by the loser of the match
+	rallies     int  // points played
+	shots       int  // balls returned in all rallies
+}
+
+// gapBucket accumulates the results of matches whose rating gap is in the same bucket.
+type gapBucket struct {
+	from, to     int
+	matches      int
+	favoriteWins int
+	rallies      int
+	shots        int
+	loserGames   map[int]int // matches by games won by the loser
+}
+
+// balanceReport groups the simulated matches by rating gap.
+type balanceReport struct {
+	gapStep    int
+	gamesToWin int
+	buckets    map[int]*gapBucket
+	total      *gapBucket
+}
+
+func newMatchResult(job pairing, match *domain.MatchReport) matchResult {
+	favorite, underdog := job.player1, job.player2
+	if underdog.Rating > favorite.Rating {
+		favorite, underdog = underdog, favorite
+	}
+	loserGames := match.Score.Player1
+	if match.Score.Player2 < loserGames {
+		loserGames = match.Score.Player2
+	}
+	return matchResult{
+		gap:         favorite.Rating - underdog.Rating,
+		favoriteWon: match.Winner.ID == favorite.ID,
+		loserGames:  loserGames,
+		rallies:     match.Rallies,
+		shots:       match.Shots,
+	}
+}
+
+func newBalanceReport(gapStep, gamesToWin int) *balanceReport {
+	return &balanceReport{
+		gapStep:    gapStep,
+		gamesToWin: gamesToWin,
+		buckets:    make(map[int]*gapBucket),
+		total:      newGapBucket(0, 0),
+	}
+}
+
+func newGapBucket(from, to int) *gapBucket {
+	return &gapBucket{
+		from:       from,
+		to:         to,
+		loserGames: make(map[int]int),
+	}
+}
+
+// add adds the result to its rating gap bucket and to the totals.
+func (b *balanceReport) add(result matchResult) {
+	index := result.gap / b.gapStep
+	bucket, ok := b.buckets[index]
+	if !ok {
+		bucket = newGapBucket(index*b.gapStep, (index+1)*b.gapStep-1)
+		b.buckets[index] = bucket
+	}
+	bucket.add(result)
+	b.total.add(result)
+	if result.gap > b.total.to {
+		b.total.to = result.gap
+	}
+}
+
+func (g *gapBucket) add(result matchResult) {
+	g.matches++
+	if result.favoriteWon {
+		g.favoriteWins++
+	}
+	g.rallies += result.rallies
+	g.shots += result.shots
+	g.loserGames[result.loserGames]++
+}
+
+// winRate returns the share of matches won by the favorite.
+func (g *gapBucket) winRate() float64 {
+	return float64(g.favoriteWins) / float64(g.matches)
+}
+
+// expectedWinRate returns the win rate an Elo model expects for the middle of the bucket.
+func (g *gapBucket) expectedWinRate() float64 {
+	middle := float64(g.from+g.to) / 2
+	return 1 / (1 + math.Pow(10, -middle/400))
+}
+
+// rallyLength returns the average number of balls returned in a rally.
+func (g *gapBucket) rallyLength() float64 {
+	if g.rallies == 0 {
+		return 0
+	}
+	return float64(g.shots) / float64(g.rallies)
+}
+
+// ralliesPerMatch returns the average number of points played in a match.
+func (g *gapBucket) ralliesPerMatch() float64 {
+	return float64(g.rallies) / float64(g.matches)
+}
+
+// scoreRate returns the share of matches where the loser won the given games.
+func (g *gapBucket) scoreRate(loserGames int) float64 {
+	return float64(g.loserGames[loserGames]) / float64(g.matches)
+}
+
+// sortedBuckets returns the buckets from the smallest to the biggest rating gap.
+func (b *balanceReport) sortedBuckets() []*gapBucket {
+	indexes := make([]int, 0, len(b.buckets))
+	for index := range b.buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	buckets := make([]*gapBucket, 0, len(indexes))
+	for _, index := range indexes {
+		buckets = append(buckets, b.buckets[index])
+	}
+	return buckets
+}
+
+// scoreLabels returns the possible final scores from the winner point of view.
+func (b *balanceReport) scoreLabels() []string {
+	labels := make([]string, b.gamesToWin)
+	for loserGames := range labels {
+		labels[loserGames] = fmt.Sprintf("%d-%d", b.gamesToWin, loserGames)
+	}
+	return labels
+}
+
+// writeText prints the calibration tables as aligned text.
+func (b *balanceReport) writeText(out io.Writer) {
+	if b.total.matches == 0 {
+		fmt.Fprintln(out, "no matches were simulated")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(out, "Win rate vs rating gap (%d matches)\n\n", b.total.matches)
+	fmt.Fprintln(w, "rating gap\tmatches\tfavorite win rate\telo expected\tavg rally length\tavg rallies\t")
+	for _, bucket := range append(b.sortedBuckets(), b.total) {
+		fmt.Fprintf(w, "%s\t%d\t%.3f\t%.3f\t%.2f\t%.1f\t\n", bucket.label(b.total),
+			bucket.matches, bucket.winRate(), bucket.expectedWinRate(),
+			bucket.rallyLength(), bucket.ralliesPerMatch())
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\nGame-score distribution (winner-loser)\n\n")
+	fmt.Fprint(w, "rating gap\t")
+	for _, label := range b.scoreLabels() {
+		fmt.Fprintf(w, "%s\t", label)
+	}
+	fmt.Fprintln(w)
+	for _, bucket := range append(b.sortedBuckets(), b.total) {
+		fmt.Fprintf(w, "%s\t", bucket.label(b.total))
+		for loserGames := 0; loserGames < b.gamesToWin; loserGames++ {
+			fmt.Fprintf(w, "%.3f\t", bucket.scoreRate(loserGames))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+// writeCSV prints one row per rating gap bucket with all the calibration columns.
+func (b *balanceReport) writeCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	header := []string{"gap_from", "gap_to", "matches", "favorite_win_rate", "elo_expected",
+		"avg_rally_length", "avg_rallies"}
+	for _, label := range b.scoreLabels() {
+		header = append(header, "score_"+label)
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, bucket := range b.sortedBuckets() {
+		row := []string{
+			strconv.Itoa(bucket.from),
+			strconv.Itoa(bucket.to),
+			strconv.Itoa(bucket.matches),
+			formatFloat(bucket.winRate()),
+			formatFloat(bucket.expectedWinRate()),
+			formatFloat(bucket.rallyLength()),
+			formatFloat(bucket.ralliesPerMatch()),
+		}
+		for loserGames := 0; loserGames < b.gamesToWin; loserGames++ {
+			row = append(row, formatFloat(bucket.scoreRate(loserGames)))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// label returns the rating gap range of the bucket, totals are labeled as "all".
+func (g *gapBucket) label(total *gapBucket) string {
+	if g == total {
+		return "all"
+	}
+	return fmt.Sprintf("%d-%d", g.from, g.to)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 4, 64)
+}
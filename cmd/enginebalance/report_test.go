@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBalanceReportBuckets(t *testing.T) {
+	report := newBalanceReport(100, 3)
+	report.add(matchResult{gap: 50, favoriteWon: true, loserGames: 0, rallies: 40, shots: 400})
+	report.add(matchResult{gap: 99, favoriteWon: false, loserGames: 2, rallies: 60, shots: 500})
+	report.add(matchResult{gap: 250, favoriteWon: true, loserGames: 1, rallies: 50, shots: 450})
+
+	buckets := report.sortedBuckets()
+	if len(buckets) != 2 {
+		t.Fatalf("two rating gap buckets were expected, but got: %d", len(buckets))
+	}
+	if buckets[0].from != 0 || buckets[0].to != 99 || buckets[0].matches != 2 {
+		t.Errorf("the first bucket must contain two matches with gap 0-99, but got: %+v", buckets[0])
+	}
+	if got := buckets[0].winRate(); got != 0.5 {
+		t.Errorf("the favorite of the first bucket must win half of the matches, but got: %f", got)
+	}
+	if got := buckets[0].rallyLength(); got != 9 {
+		t.Errorf("the average rally length of the first bucket must be 9, but got: %f", got)
+	}
+	if got := report.total.scoreRate(1); got != 1.0/3 {
+		t.Errorf("a third of the matches must end 3-1, but got: %f", got)
+	}
+
+	var out bytes.Buffer
+	if err := report.writeCSV(&out); err != nil {
+		t.Fatalf("error was not expected, but got: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "gap_from,gap_to,matches") {
+		t.Errorf("a csv with a header and two rows was expected, but got: %s", out.String())
+	}
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+const (
+	// TimePerShot is the virtual time a ball takes to cross the table
+	TimePerShot = 1200 * time.Millisecond
+	// TimeBetweenPoints is the virtual time between the end of a rally and the next serve
+	TimeBetweenPoints = 10 * time.Second
+	// TimeBetweenGames is the virtual time of the break between two games
+	TimeBetweenGames = time.Minute
+	// DefaultExpediteAfter is the time of a game after which the expedite system applies
+	DefaultExpediteAfter = 10 * time.Minute
+	// ExpediteReturns is the number of returns the receiver needs to win a point under
+	// the expedite system
+	ExpediteReturns = 13
+)
+
+// MatchEvent models something that happened in a match and when it happened.
+type MatchEvent struct {
+	Elapsed     time.Duration `json:"elapsed"`     // virtual time since the match began
+	Description string        `json:"description"` // what happened
+}
+
+// matchClock advances the virtual time of a match.
+type matchClock struct {
+	elapsed   time.Duration // virtual time since the match began
+	gameStart time.Duration // virtual time when the current game began
+}
+
+// gameTime returns the virtual time played in the current game.
+func (c *matchClock) gameTime() time.Duration {
+	return c.elapsed - c.gameStart
+}
+
+// nextPoint advances the clock to the next serve of the game.
+func (c *matchClock) nextPoint() {
+	c.elapsed += TimeBetweenPoints
+}
+
+// nextGame advances the clock to the first serve of the next game.
+func (c *matchClock) nextGame() {
+	c.elapsed += TimeBetweenGames
+	c.gameStart = c.elapsed
+}
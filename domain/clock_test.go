@@ -0,0 +1,86 @@
+package domain_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestMatchClock(t *testing.T) {
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+
+	got := domain.SimulateMatch(*player1, *player2)
+
+	if len(got.Events) != len(got.Narrative) {
+		t.Fatalf("every sentence of the narrative must be an event, got %d events and %d sentences",
+			len(got.Events), len(got.Narrative))
+	}
+	var last time.Duration
+	for index, event := range got.Events {
+		if event.Elapsed < last {
+			t.Fatalf("event %d at %s happened before the previous event at %s", index, event.Elapsed, last)
+		}
+		last = event.Elapsed
+	}
+	if got.Duration <= 0 || got.Duration != last {
+		t.Errorf("the match duration must be the time of the last event %s, but got: %s", last, got.Duration)
+	}
+	minimum := time.Duration(got.Shots) * domain.TimePerShot
+	if got.Duration < minimum {
+		t.Errorf("the match duration must be at least %s for %d shots, but got: %s", minimum, got.Shots, got.Duration)
+	}
+}
+
+func TestExpediteSystem(t *testing.T) {
+	player1 := domain.NewPlayer("Joo Sae-hyuk")
+	player2 := domain.NewPlayer("Chen Weixing")
+	settings := domain.DefaultMatchSettings()
+	// expedite as soon as the first point is played
+	settings.Format.ExpediteAfter = time.Nanosecond
+
+	got := domain.SimulateMatchWithSettings(*player1, *player2, settings)
+
+	if !got.Expedited {
+		t.Fatalf("the expedite system must apply after %s", settings.Format.ExpediteAfter)
+	}
+	expedited := 0
+	for _, sentence := range got.Narrative {
+		if sentence == domain.ExpediteSentence {
+			expedited++
+		}
+	}
+	if expedited != 1 {
+		t.Errorf("the narrative must tell once when the expedite system applies, but got: %v", got.Narrative)
+	}
+	// once expedited no rally can be longer than the returns needed by the receiver
+	hits, started := 0, false
+	for _, sentence := range got.Narrative {
+		if sentence == domain.ExpediteSentence {
+			started = true
+		}
+		if started && strings.HasSuffix(sentence, "hit the ball") {
+			hits++
+			if hits > 2*domain.ExpediteReturns {
+				t.Fatalf("a rally under the expedite system had more than %d shots", 2*domain.ExpediteReturns)
+			}
+			continue
+		}
+		hits = 0
+	}
+}
+
+func TestExpediteSystemDisabled(t *testing.T) {
+	player1 := domain.NewPlayer("Joo Sae-hyuk")
+	player2 := domain.NewPlayer("Chen Weixing")
+	settings := domain.DefaultMatchSettings()
+	settings.Format.ExpediteAfter = 0
+
+	got := domain.SimulateMatchWithSettings(*player1, *player2, settings)
+
+	if got.Expedited {
+		t.Errorf("the expedite system must not apply when it is disabled")
+	}
+}
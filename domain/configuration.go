@@ -2,6 +2,7 @@ package domain
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -28,6 +29,8 @@ type LogSetting struct {
 	Authapp    LogData // Log configuration for AuthApp module
 	Matchapp   LogData // Log configuration for MatchApp module
 	Playerapp  LogData // Log configuration for PlayerApp module
+	Feedapp    LogData // Log configuration for FeedApp module
+	Webhookapp LogData // Log configuration for WebhookApp module
 	Repository LogData // Log configuration for Repository module
 }
 
@@ -36,10 +39,57 @@ type ServerSetting struct {
 	Port string // Web server port
 }
 
+// MatchSetting contains the configuration parameters for matches.
+type MatchSetting struct {
+	PreviewSimulations int                    // number of matches simulated to preview a match
+	PreviewWorkers     int                    // number of workers simulating matches in parallel
+	Competitions       map[string]MatchFormat // match format of every competition by name
+	LivePacing         string                 // default pacing of live matches: realtime, accelerated or instant
+	LiveAcceleration   int                    // how many times faster an accelerated live match is streamed
+	LiveRetention      time.Duration          // how long a finished live match can still be followed
+	LiveMatches        int                    // number of live matches that can be played at the same time
+	LiveHistory        int                    // number of latest messages of a live match kept for late spectators
+	JobWorkers         int                    // number of workers playing matches in background
+	JobQueue           int                    // number of match jobs that can wait for a worker
+	JobTimeout         time.Duration          // how long a match job can be played
+	JobRetention       time.Duration          // how long a finished match job can be queried
+}
+
+// FeedSetting contains the configuration parameters for the feed of events.
+type FeedSetting struct {
+	Capacity int // number of latest events kept to resume subscriptions
+}
+
+// WebhookSetting contains the configuration parameters for webhook deliveries.
+type WebhookSetting struct {
+	MaxAttempts int           // number of times an event is sent before it is a dead letter
+	Backoff     time.Duration // wait after the first failed attempt, it doubles after every attempt
+	Timeout     time.Duration // how long a receiver has to respond
+	DeliveryLog int           // number of latest deliveries kept for every subscription
+	DeadLetters int           // number of latest dead letters kept
+	Queue       int           // number of events that can wait to be delivered to every subscription
+}
+
+// StorageSetting contains the configuration parameters for the storage of the players.
+type StorageSetting struct {
+	Backend          string        // where players are stored: memory, sqlite or bolt
+	SQLitePath       string        // file of the sqlite database
+	BoltPath         string        // file of the bbolt database
+	SnapshotPath     string        // file with the snapshot of the players on memory, empty disables snapshots
+	SnapshotInterval time.Duration // how often the players on memory are written to the snapshot
+	StatisticsLog    string        // file of the append-only log of the statistics of the players, empty keeps it on memory
+	CacheSize        int           // number of players found by id kept in memory, zero disables the cache
+	CacheTTL         time.Duration // how long a cached player is used before it is read again
+}
+
 // Setting contains general configuration data for the application.
 type Setting struct {
-	Log       LogSetting    // configuration data for log
-	Webserver ServerSetting // configuration data for server
+	Log       LogSetting     // configuration data for log
+	Webserver ServerSetting  // configuration data for server
+	Match     MatchSetting   // configuration data for matches
+	Feed      FeedSetting    // configuration data for the feed of events
+	Webhook   WebhookSetting // configuration data for webhooks
+	Storage   StorageSetting // configuration data for the storage of the players
 }
 
 // LoadConfiguration creates a new configuration
@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// PlayerCreatedEvent is the name of the event published with every new player
+	PlayerCreatedEvent = "player.created"
+	// MatchPlayedEvent is the name of the event published with every finished match
+	MatchPlayedEvent = "match.played"
+	// StatisticsUpdatedEvent is the name of the event published with every player whose statistics changed
+	StatisticsUpdatedEvent = "statistics.updated"
+	// PlayerUpdatedEvent is the name of the event published with every player changed or archived
+	PlayerUpdatedEvent = "player.updated"
+
+	// asyncQueueSize is the number of events an asynchronous subscriber can have pending
+	asyncQueueSize = 100
+)
+
+// Event is something that happened in the domain.
+type Event interface {
+	// EventName returns the name subscribers use to receive the event
+	EventName() string
+}
+
+// PlayerCreated is published when a player is created.
+type PlayerCreated struct {
+	Player Player
+}
+
+// MatchPlayed is published when a match finishes.
+type MatchPlayed struct {
+	Match MatchReport
+}
+
+// StatisticsUpdated is published when the wins or losses of a player change.
+type StatisticsUpdated struct {
+	Player Player
+}
+
+// PlayerUpdated is published when the data of a player is changed or it is archived.
+type PlayerUpdated struct {
+	Player Player
+}
+
+// EventName returns the name of the player created event.
+func (PlayerCreated) EventName() string { return PlayerCreatedEvent }
+
+// EventName returns the name of the match played event.
+func (MatchPlayed) EventName() string { return MatchPlayedEvent }
+
+// EventName returns the name of the statistics updated event.
+func (StatisticsUpdated) EventName() string { return StatisticsUpdatedEvent }
+
+// EventName returns the name of the player updated event.
+func (PlayerUpdated) EventName() string { return PlayerUpdatedEvent }
+
+// EventHandler reacts to an event, the error is logged and doesn't stop other handlers.
+type EventHandler func(ctx context.Context, event Event) error
+
+// EventBus defines behavior to publish domain events and subscribe to them.
+type EventBus interface {
+	// Subscribe calls the handler with every event of the given name before Publish returns.
+	Subscribe(eventName string, handler EventHandler)
+	// SubscribeAsync calls the handler with every event of the given name in background,
+	// in the order they were published.
+	SubscribeAsync(eventName string, handler EventHandler)
+	// Publish delivers the event to its subscribers and returns the errors of the
+	// synchronous ones.
+	Publish(ctx context.Context, event Event) error
+}
+
+// asyncEvent is an event waiting for an asynchronous subscriber
+type asyncEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+// subscription contains a handler and, for asynchronous subscribers, its queue.
+type subscription struct {
+	handler EventHandler
+	queue   chan asyncEvent // nil for synchronous subscribers
+}
+
+// inProcessBus implements an event bus inside the process.
+type inProcessBus struct {
+	mu            sync.RWMutex
+	subscriptions map[string][]subscription
+}
+
+// NewEventBus creates an event bus that delivers events inside the process.
+func NewEventBus() EventBus {
+	return &inProcessBus{
+		subscriptions: make(map[string][]subscription),
+	}
+}
+
+// Subscribe calls the handler with every event of the given name before Publish returns.
+func (b *inProcessBus) Subscribe(eventName string, handler EventHandler) {
+	log.Debugf("subscribing handler to event %q", eventName)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[eventName] = append(b.subscriptions[eventName], subscription{handler: handler})
+}
+
+// SubscribeAsync calls the handler with every event of the given name in its own
+// goroutine. Publish waits only when the handler has too many pending events.
+func (b *inProcessBus) SubscribeAsync(eventName string, handler EventHandler) {
+	log.Debugf("subscribing asynchronous handler to event %q", eventName)
+	queue := make(chan asyncEvent, asyncQueueSize)
+	go func() {
+		for pending := range queue {
+			if err := handle(pending.ctx, handler, pending.event); err != nil {
+				log.Errorf("asynchronous handler of event %q failed: %s", eventName, err)
+			}
+		}
+	}()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[eventName] = append(b.subscriptions[eventName], subscription{handler: handler, queue: queue})
+}
+
+// Publish delivers the event to its subscribers. A failing subscriber doesn't stop the
+// others; the errors of the synchronous ones are returned together.
+func (b *inProcessBus) Publish(ctx context.Context, event Event) error {
+	log.Debugf("publishing event %q", event.EventName())
+	b.mu.RLock()
+	subscriptions := b.subscriptions[event.EventName()]
+	b.mu.RUnlock()
+	var result []string
+	for _, subscription := range subscriptions {
+		if subscription.queue != nil {
+			// the request that published the event may finish before the handler runs
+			subscription.queue <- asyncEvent{ctx: context.Background(), event: event}
+			continue
+		}
+		if err := handle(ctx, subscription.handler, event); err != nil {
+			log.Errorf("handler of event %q failed: %s", event.EventName(), err)
+			result = append(result, err.Error())
+		}
+	}
+	if len(result) > 0 {
+		return fmt.Errorf("%d handlers of event %q failed: %s", len(result), event.EventName(), strings.Join(result, "\n"))
+	}
+	return nil
+}
+
+// handle calls the handler turning a panic into an error.
+func handle(ctx context.Context, handler EventHandler, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, event)
+}
@@ -0,0 +1,105 @@
+package domain_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestPublishToSynchronousSubscribers(t *testing.T) {
+	// given
+	bus := domain.NewEventBus()
+	var got []string
+	bus.Subscribe(domain.PlayerCreatedEvent, func(ctx context.Context, event domain.Event) error {
+		got = append(got, "first "+event.(domain.PlayerCreated).Player.Names)
+		return nil
+	})
+	bus.Subscribe(domain.PlayerCreatedEvent, func(ctx context.Context, event domain.Event) error {
+		got = append(got, "second "+event.(domain.PlayerCreated).Player.Names)
+		return nil
+	})
+	bus.Subscribe(domain.MatchPlayedEvent, func(ctx context.Context, event domain.Event) error {
+		got = append(got, "match")
+		return nil
+	})
+	// when
+	err := bus.Publish(context.TODO(), domain.PlayerCreated{Player: *domain.NewPlayer("Ma Long")})
+	// then
+	if err != nil {
+		t.Fatalf("error was not expected, but: %s", err)
+	}
+	want := []string{"first Ma Long", "second Ma Long"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("handlers %v were expected in order, but got: %v", want, got)
+	}
+}
+
+func TestPublishToAsynchronousSubscribers(t *testing.T) {
+	// given
+	bus := domain.NewEventBus()
+	received := make(chan domain.Key, 2)
+	bus.SubscribeAsync(domain.StatisticsUpdatedEvent, func(ctx context.Context, event domain.Event) error {
+		received <- event.(domain.StatisticsUpdated).Player.ID
+		return nil
+	})
+	player1, player2 := domain.NewPlayer("Ma Long"), domain.NewPlayer("Xu Xin")
+	player1.ID, player2.ID = "1", "2"
+	// when
+	ctx, cancel := context.WithCancel(context.Background())
+	assertNoEventError(t, bus.Publish(ctx, domain.StatisticsUpdated{Player: *player1}))
+	assertNoEventError(t, bus.Publish(ctx, domain.StatisticsUpdated{Player: *player2}))
+	// the handler must not depend on the context of the publisher
+	cancel()
+	// then
+	for _, want := range []domain.Key{"1", "2"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("player %q was expected, but got: %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("player %q was not received", want)
+		}
+	}
+}
+
+func TestSubscribersAreIsolated(t *testing.T) {
+	// given
+	bus := domain.NewEventBus()
+	var called int
+	bus.Subscribe(domain.MatchPlayedEvent, func(ctx context.Context, event domain.Event) error {
+		return errors.New("achievements are not available")
+	})
+	bus.Subscribe(domain.MatchPlayedEvent, func(ctx context.Context, event domain.Event) error {
+		panic("ratings are broken")
+	})
+	bus.Subscribe(domain.MatchPlayedEvent, func(ctx context.Context, event domain.Event) error {
+		called++
+		return nil
+	})
+	// when
+	err := bus.Publish(context.TODO(), domain.MatchPlayed{})
+	// then
+	if called != 1 {
+		t.Errorf("the last handler must be called once, but it was called %d times", called)
+	}
+	if err == nil {
+		t.Fatalf("the errors of the failing handlers were expected")
+	}
+	for _, want := range []string{"achievements are not available", "ratings are broken"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error must contain %q, but got: %s", want, err)
+		}
+	}
+}
+
+func assertNoEventError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("error was not expected, but: %s", err)
+	}
+}
@@ -1,8 +1,11 @@
 package domain
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -13,25 +16,93 @@ const (
 	PlayerWonSentence = "Player %q won"
 	// PlayerFailSentence sets narrative when a player fail a ball
 	PlayerFailSentence = "%q fail the ball"
-	// FatalNumber is the number that if a referee randon number is equals to it, that
-	// player loses the match
-	FatalNumber = 13
+	// GameWonSentence sets narrative when a player wins a game
+	GameWonSentence = "%q won the game %d-%d"
+	// ExpediteSentence sets narrative when the expedite system applies
+	ExpediteSentence = "Expedite system applies for the rest of the match"
+	// ExpediteFailSentence sets narrative when a server loses a point under the expedite system
+	ExpediteFailSentence = "%q could not win the point in 13 returns"
+	// BaseFailRate is the chance, in per mille, that a player fails a neutral ball. Since
+	// rallies are points instead of whole matches, it keeps rallies about ten shots long
+	BaseFailRate = 100
+	// MinFailRate is the lowest chance, in per mille, that a player fails any ball
+	MinFailRate = 1
+	// MaxRallyShots is the number of shots after which a rally is stopped
+	MaxRallyShots = 1000
+	// MaxRallies is the number of rallies after which a match is stopped
+	MaxRallies = 10000
 )
 
-// referee defines the winner of the match randomly
-var referee *rand.Rand
+var (
+	// ErrRallyTooLong is returned when a rally reaches MaxRallyShots
+	ErrRallyTooLong = errors.New("rally reached the maximum number of shots")
+	// ErrMatchTooLong is returned when a match reaches MaxRallies
+	ErrMatchTooLong = errors.New("match reached the maximum number of rallies")
+)
+
+// seeder generates the seeds of the referees, so matches played at the same time
+// don't share a random generator.
+var seeder = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
 
 // MatchReport models a report of a match played between two ping pong players
 type MatchReport struct {
-	ID        Key       `json:"id,omitempty"`     // internal id
-	Narrative []string  `json:"narrative"`        // match narrative
-	Winner    *Player   `json:"winner,omitempty"` // player who wins
-	Loser     *Player   `json:"loser,omitempty"`  // player who loses
-	Created   time.Time `json:"created"`          // The creation date
+	ID        Key             `json:"id,omitempty"`        // internal id
+	Player1ID Key             `json:"player1ID,omitempty"` // first player of the match
+	Player2ID Key             `json:"player2ID,omitempty"` // second player of the match
+	Narrative []string        `json:"narrative"`           // match narrative
+	Events    []MatchEvent    `json:"events"`              // match narrative with the elapsed time
+	Winner    *Player         `json:"winner,omitempty"`    // player who wins
+	Loser     *Player         `json:"loser,omitempty"`     // player who loses
+	Score     MatchScore      `json:"score"`               // games and points of the match
+	Rallies   int             `json:"rallies"`             // number of points played
+	Shots     int             `json:"shots"`               // number of balls returned in all rallies
+	Duration  time.Duration   `json:"duration"`            // virtual time the match lasted
+	Expedited bool            `json:"expedited,omitempty"` // true if the expedite system applied
+	Tactics   []TacticsReport `json:"tactics,omitempty"`   // tactics effectiveness per player
+	Created   time.Time       `json:"created"`             // The creation date
+}
+
+// MatchSettings groups everything, besides the players, that shapes a match.
+type MatchSettings struct {
+	Player1Tactics Tactics
+	Player2Tactics Tactics
+	Format         MatchFormat
+	Quiet          bool             // true to skip the narrative, e.g. to simulate many matches
+	Observer       func(MatchEvent) // optional, receives every event as soon as it is played
+}
+
+// ball models the ball travelling across the table between two players.
+type ball struct {
+	hits     int           // number of times the ball was hit
+	pressure int           // extra error risk, in per mille, for the receiver
+	long     bool          // true if the ball is long
+	tactics  uint8         // bits of the tactic kinds the hitter applied to this ball
+	at       time.Duration // virtual time when the ball was hit
+	expedite bool          // true if the expedite system applies
+}
+
+// side contains a player of the match with its tactics and sentences, which are
+// built once instead of on every shot.
+type side struct {
+	player       *Player
+	tracker      *tacticsTracker
+	hitSentence  string
+	failSentence string
 }
 
-func init() {
-	referee = createReferee()
+// engine plays a match shot by shot in the goroutine of the caller.
+type engine struct {
+	ctx      context.Context
+	match    *MatchReport
+	quiet    bool
+	observer func(MatchEvent)
+	referee  *rand.Rand
+	sides    [2]side
+	board    *scoreBoard
+	clock    matchClock
 }
 
 // NewMatchReport creates a new match report with a ID and Created date
@@ -53,72 +124,227 @@ func NewMatchReportWithData(winner, loser Player, narrative []string) *MatchRepo
 	}
 }
 
-// SimulateMatch simulates a ping pong match between player1 and player2
+// DefaultMatchSettings returns default tactics for both players and the default match format.
+func DefaultMatchSettings() MatchSettings {
+	return MatchSettings{
+		Player1Tactics: DefaultTactics(),
+		Player2Tactics: DefaultTactics(),
+		Format:         DefaultMatchFormat(),
+	}
+}
+
+// SimulateMatch simulates a ping pong match between player1 and player2 using default tactics
 func SimulateMatch(player1, player2 Player) *MatchReport {
-	match := NewMatchReport()
-	table := make(chan int)
-	narrative := make(chan string, 2)
-	player1Won := make(chan bool)
-	player2Won := make(chan bool)
-	finishNarrative := make(chan bool)
-	go player1.move(narrative, table, player1Won)
-	go player2.move(narrative, table, player2Won)
-	go match.addSentenceToNarrative(narrative, finishNarrative)
-	table <- 1
-	select {
-	case <-player1Won:
-		match.setWinnerAndLoser(&player1, &player2)
-	case <-player2Won:
-		match.setWinnerAndLoser(&player2, &player1)
-	}
-	<-finishNarrative
-	if log.LevelLabel == "debug" {
-		for i, val := range match.Narrative {
+	return SimulateMatchWithSettings(player1, player2, DefaultMatchSettings())
+}
+
+// SimulateMatchWithTactics simulates a ping pong match between player1 and player2 where
+// each player follows the tactics given by its manager.
+func SimulateMatchWithTactics(player1, player2 Player, tactics1, tactics2 Tactics) *MatchReport {
+	settings := DefaultMatchSettings()
+	settings.Player1Tactics = tactics1
+	settings.Player2Tactics = tactics2
+	return SimulateMatchWithSettings(player1, player2, settings)
+}
+
+// SimulateMatchWithSettings simulates a ping pong match between player1 and player2 with
+// the given tactics and format. If the match is stopped by the rally guards, the error is
+// logged and the report has no winner.
+func SimulateMatchWithSettings(player1, player2 Player, settings MatchSettings) *MatchReport {
+	match, err := SimulateMatchContext(context.Background(), player1, player2, settings)
+	if err != nil {
+		log.Errorf("match between %q and %q was stopped: %s", player1.ID, player2.ID, err)
+	}
+	return match
+}
+
+// SimulateMatchContext simulates a ping pong match between player1 and player2 with the
+// given settings. The umpire serves every point and keeps the score and the virtual clock
+// until a player wins the needed games. It stops when the context is done or a rally
+// guard is reached, returning the report played so far and the error.
+func SimulateMatchContext(ctx context.Context, player1, player2 Player, settings MatchSettings) (*MatchReport, error) {
+	e := newEngine(ctx, &player1, &player2, settings)
+	err := e.play()
+	if err == nil && log.LevelLabel == "debug" {
+		for i, val := range e.match.Narrative {
 			fmt.Printf("%d - %s\n", i, val)
 		}
 	}
-	return match
+	return e.match, err
 }
 
-func (m *MatchReport) setWinnerAndLoser(winner, losser *Player) {
-	m.Winner = winner
-	m.Loser = losser
+func newEngine(ctx context.Context, player1, player2 *Player, settings MatchSettings) *engine {
+	referee := createReferee()
+	match := NewMatchReport()
+	match.Player1ID, match.Player2ID = player1.ID, player2.ID
+	tracker1 := newTacticsTracker(player1.ID, settings.Player1Tactics, referee)
+	tracker1.matchup = MatchupRisk(player1.PlayerProfile, player2.PlayerProfile) + RatingRisk(*player1, *player2)
+	tracker2 := newTacticsTracker(player2.ID, settings.Player2Tactics, referee)
+	tracker2.matchup = MatchupRisk(player2.PlayerProfile, player1.PlayerProfile) + RatingRisk(*player2, *player1)
+	return &engine{
+		ctx:      ctx,
+		match:    match,
+		quiet:    settings.Quiet,
+		observer: settings.Observer,
+		referee:  referee,
+		sides:    [2]side{newSide(player1, tracker1), newSide(player2, tracker2)},
+		board:    newScoreBoard(settings.Format, referee.Intn(2) == 0),
+	}
 }
 
-// addSentenceToNarrative adds sentences about the narrative of the match
-func (m *MatchReport) addSentenceToNarrative(sentences chan string, finish chan<- bool) {
-	for sentence := range sentences {
-		m.Narrative = append(m.Narrative, sentence)
+func newSide(player *Player, tracker *tacticsTracker) side {
+	return side{
+		player:       player,
+		tracker:      tracker,
+		hitSentence:  fmt.Sprintf(PlayerHitSentence, player.Names),
+		failSentence: fmt.Sprintf(PlayerFailSentence, player.Names),
 	}
-	finish <- true
 }
 
-// move defines a player behavior regarding to a match, here the match is narrated
-// and identifies if the player wins or loses the game.
-func (p Player) move(narrative chan<- string, table chan int, winner chan bool) {
-	for {
-		ball, ok := <-table
-		if !ok {
-			// if the channel is closed, we win
-			narrative <- fmt.Sprintf(PlayerWonSentence, p.Names)
-			close(narrative)
-			winner <- true
-			return
+// play plays rallies until a player wins the needed games.
+func (e *engine) play() error {
+	for !e.board.finished() {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+		if e.match.Rallies >= MaxRallies {
+			return ErrMatchTooLong
+		}
+		server := 1
+		if e.board.player1Serves() {
+			server = 0
 		}
-		if referee.Intn(100) == FatalNumber {
-			narrative <- fmt.Sprintf(PlayerFailSentence, p.Names)
-			close(table)
-			return
+		loser, err := e.rally(server)
+		if err != nil {
+			return err
 		}
-		narrative <- fmt.Sprintf(PlayerHitSentence, p.Names)
-		ball++
-		table <- ball
+		e.match.Rallies++
+		if !e.board.point(loser == 1) {
+			e.clock.nextPoint()
+			if e.board.startExpedite(e.clock.gameTime()) {
+				e.narrate(e.clock.elapsed, ExpediteSentence)
+			}
+			continue
+		}
+		game := e.board.score.Games[len(e.board.score.Games)-1]
+		gameWinner := e.sides[0].player.Names
+		if game.Player2 > game.Player1 {
+			gameWinner = e.sides[1].player.Names
+		}
+		e.narrate(e.clock.elapsed, fmt.Sprintf(GameWonSentence, gameWinner, game.Player1, game.Player2))
+		if !e.board.finished() {
+			e.clock.nextGame()
+		}
+	}
+	e.match.Score = e.board.score
+	e.match.Duration = e.clock.elapsed
+	e.match.Expedited = e.board.expedite
+	if e.board.score.Player1 > e.board.score.Player2 {
+		e.match.setWinnerAndLoser(e.sides[0].player, e.sides[1].player)
+	} else {
+		e.match.setWinnerAndLoser(e.sides[1].player, e.sides[0].player)
+	}
+	e.narrate(e.clock.elapsed, fmt.Sprintf(PlayerWonSentence, e.match.Winner.Names))
+	e.match.Tactics = []TacticsReport{e.sides[0].tracker.report(), e.sides[1].tracker.report()}
+	return nil
+}
+
+// rally plays a point served by the given side and returns the side that lost it.
+// Players hit the ball in turns until one of them fails.
+func (e *engine) rally(server int) (int, error) {
+	incoming := ball{at: e.clock.elapsed, expedite: e.board.expedite}
+	for hitter := server; ; hitter = 1 - hitter {
+		if incoming.hits >= MaxRallyShots {
+			return 0, ErrRallyTooLong
+		}
+		own, opponent := &e.sides[hitter], &e.sides[1-hitter]
+		// only the server gets back balls returned an even number of times
+		if incoming.expedite && incoming.hits >= 2*ExpediteReturns {
+			opponent.tracker.decide(incoming.tactics, true)
+			e.endRally(incoming, incoming.at, fmt.Sprintf(ExpediteFailSentence, own.player.Names))
+			return hitter, nil
+		}
+		risk, outgoing := own.tracker.shot(incoming)
+		if e.referee.Intn(1000) < risk {
+			own.tracker.decide(outgoing.tactics, false)
+			opponent.tracker.decide(incoming.tactics, true)
+			e.endRally(incoming, outgoing.at, own.failSentence)
+			return hitter, nil
+		}
+		e.narrate(outgoing.at, own.hitSentence)
+		incoming = outgoing
+	}
+}
+
+// endRally narrates the end of the rally and advances the clock to its end.
+func (e *engine) endRally(last ball, end time.Duration, sentence string) {
+	e.narrate(end, sentence)
+	e.match.Shots += last.hits
+	e.clock.elapsed = end
+}
+
+// narrate sends an event to the observer and adds it to the narrative of the match,
+// unless the match is quiet.
+func (e *engine) narrate(elapsed time.Duration, description string) {
+	event := MatchEvent{Elapsed: elapsed, Description: description}
+	if e.observer != nil {
+		e.observer(event)
+	}
+	if e.quiet {
+		return
+	}
+	e.match.Narrative = append(e.match.Narrative, description)
+	e.match.Events = append(e.match.Events, event)
+}
+
+func (m *MatchReport) setWinnerAndLoser(winner, losser *Player) {
+	m.Winner = winner
+	m.Loser = losser
+}
+
+// shot applies the player tactics, matchup and rating to the incoming ball and returns the error risk, in
+// per mille, of hitting it and the ball sent to the opponent.
+func (t *tacticsTracker) shot(incoming ball) (int, ball) {
+	risk := BaseFailRate + t.matchup
+	outgoing := ball{
+		hits:     incoming.hits + 1,
+		long:     t.referee.Intn(3) == 0,
+		at:       incoming.at + TimePerShot,
+		expedite: incoming.expedite,
+	}
+	apply := func(kind, own, pressure int) {
+		t.use(kind)
+		outgoing.tactics |= 1 << kind
+		risk += own
+		outgoing.pressure += pressure
+	}
+	switch {
+	case incoming.hits == 0:
+		own, pressure := t.tactics.serveRisk()
+		apply(serveTactic, own, pressure)
+	case incoming.pressure > 0:
+		own, pressure := t.tactics.defenseRisk(incoming.pressure)
+		apply(defenseTactic, own, pressure)
+	case incoming.long:
+		risk += incoming.pressure
+		own, pressure := t.tactics.longBallRisk()
+		apply(longBallsTactic, own, pressure)
+	default:
+		risk += incoming.pressure
+	}
+	own, pressure := t.tactics.aggressionRisk()
+	apply(aggressionTactic, own, pressure)
+	if risk < MinFailRate {
+		risk = MinFailRate
 	}
+	return risk, outgoing
 }
 
 // createReferee creates a referee that is an int random generator
-// to compare with the FatalNumbere
+// to compare with the failure risk of every shot
 func createReferee() *rand.Rand {
-	sourceForRandom := rand.NewSource(time.Now().UnixNano())
+	seeder.Lock()
+	defer seeder.Unlock()
+	sourceForRandom := rand.NewSource(seeder.Int63())
 	return rand.New(sourceForRandom)
 }
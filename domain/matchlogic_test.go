@@ -0,0 +1,104 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestSimulateMatchContextCancelled(t *testing.T) {
+	// given
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// when
+	got, err := domain.SimulateMatchContext(ctx, *player1, *player2, domain.DefaultMatchSettings())
+	// then
+	if err != context.Canceled {
+		t.Fatalf("a cancelled match must return %v, but got: %v", context.Canceled, err)
+	}
+	if got.Winner != nil || got.Rallies != 0 {
+		t.Errorf("a cancelled match must not be played, but got winner %v after %d rallies", got.Winner, got.Rallies)
+	}
+}
+
+func TestSimulateMatchContextTooLong(t *testing.T) {
+	// given
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	settings := domain.DefaultMatchSettings()
+	settings.Format.PointsToWinGame = 10 * domain.MaxRallies
+	settings.Format.ExpediteAfter = 0
+	// when
+	got, err := domain.SimulateMatchContext(context.Background(), *player1, *player2, settings)
+	// then
+	if err != domain.ErrMatchTooLong {
+		t.Fatalf("a match without end must return %v, but got: %v", domain.ErrMatchTooLong, err)
+	}
+	if got.Rallies != domain.MaxRallies {
+		t.Errorf("the match must stop after %d rallies, but got: %d", domain.MaxRallies, got.Rallies)
+	}
+	if got.Winner != nil {
+		t.Errorf("a stopped match must not have a winner, but got: %v", got.Winner)
+	}
+}
+
+func TestSimulateMatchQuiet(t *testing.T) {
+	// given
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	settings := domain.DefaultMatchSettings()
+	settings.Quiet = true
+	// when
+	got, err := domain.SimulateMatchContext(context.Background(), *player1, *player2, settings)
+	// then
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.Winner == nil || got.Loser == nil {
+		t.Errorf("a quiet match must have a winner and a loser, but got: %v and %v", got.Winner, got.Loser)
+	}
+	if len(got.Narrative) > 0 || len(got.Events) > 0 {
+		t.Errorf("a quiet match must not have narrative, but got %d sentences", len(got.Narrative))
+	}
+}
+
+func BenchmarkSimulateMatch(b *testing.B) {
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		domain.SimulateMatch(*player1, *player2)
+	}
+}
+
+func BenchmarkSimulateMatchQuiet(b *testing.B) {
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	settings := domain.DefaultMatchSettings()
+	settings.Quiet = true
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		domain.SimulateMatchContext(ctx, *player1, *player2, settings)
+	}
+}
+
+func BenchmarkSimulateMatchParallel(b *testing.B) {
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	settings := domain.DefaultMatchSettings()
+	settings.Quiet = true
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			domain.SimulateMatchContext(ctx, *player1, *player2, settings)
+		}
+	})
+}
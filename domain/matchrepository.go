@@ -0,0 +1,14 @@
+package domain
+
+import "context"
+
+// MatchRepository stores the reports of the played matches, its operations run inside the
+// transaction the context carries when it was begun by the player repository of the same
+// backend, so a match is stored together with the changes of its players or not at all.
+type MatchRepository interface {
+	// Save stores the report of a played match
+	Save(ctx context.Context, match *MatchReport) error
+	// FindByID searches the report of the match with the given id, it returns an empty
+	// report if there is not such match.
+	FindByID(ctx context.Context, id Key) (MatchReport, error)
+}
@@ -17,8 +17,13 @@ type Player struct {
 	Names   string    `json:"names,omitempty"` // player names
 	Wins    int       `json:"wins"`            // the number of wins of this player
 	Losses  int       `json:"losses"`          // the number of losses of this player
+	Rating  int       `json:"rating"`          // the strength of this player
 	Created time.Time `json:"created"`         // The creation date
 	Updated time.Time `json:"updated"`         // the update date
+	Version int       `json:"version"`         // it increases with every change, so stale changes are rejected
+	// archived players are not listed nor play matches, but they are kept with their statistics
+	Archived bool `json:"archived,omitempty"`
+	PlayerProfile
 }
 
 // GenerateUUIDKey generates a uuid key
@@ -39,13 +44,15 @@ func NewPlayerWithStatistics(names string, wins, losses int) *Player {
 		Names:   names,
 		Wins:    wins,
 		Losses:  losses,
+		Rating:  DefaultRating,
 		Created: time.Now(),
 		Updated: time.Now(),
+		Version: 1,
 	}
 }
 
-// ValidatePlayer checks that the given player has not empty names and wins and losses
-// are not negative.
+// ValidatePlayer checks that the given player has not empty names, wins, losses and
+// rating are not negative and its profile contains known values.
 func ValidatePlayer(player Player) (bool, error) {
 	var result []string
 	log.Debugf("validating player %v", player)
@@ -73,6 +80,13 @@ func ValidatePlayer(player Player) (bool, error) {
 		log.Debugf("player %s has not valid losses because it is negative: %d", player.Names, player.Losses)
 		result = append(result, "Player losses cannot be less than zero")
 	}
+	// check that rating value cannot be negative
+	if player.Rating < 0 {
+		log.Debugf("player %s has not valid rating because it is negative: %d", player.Names, player.Rating)
+		result = append(result, "Player rating cannot be less than zero")
+	}
+	// check that the profile contains known values
+	result = append(result, player.PlayerProfile.validate()...)
 
 	if len(result) > 0 {
 		strresult := strings.Join(result, "\n")
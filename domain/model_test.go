@@ -112,6 +112,56 @@ var givenData = []data{
 		result: false,
 		err:    errors.New("Player names cannot be empty"),
 	},
+	{
+		param: domain.Player{
+			ID:     "sfssf-2342-sdfs-fssdsd-sfssds",
+			Names:  "Xu Xin",
+			Wins:   0,
+			Losses: 0,
+			PlayerProfile: domain.PlayerProfile{
+				Style:      domain.PenholdAttacker,
+				Handedness: domain.LeftHanded,
+				Grip:       domain.PenholdGrip,
+			},
+			Created: time.Now(),
+			Updated: time.Now(),
+		},
+		result: true,
+		err:    nil,
+	},
+	{
+		param: domain.Player{
+			ID:     "sfssf-2342-sdfs-fssdsd-sfssds",
+			Names:  "Xu Xin",
+			Wins:   0,
+			Losses: 0,
+			PlayerProfile: domain.PlayerProfile{
+				Style:      "smasher",
+				Handedness: "both",
+				Grip:       "seemiller",
+			},
+			Created: time.Now(),
+			Updated: time.Now(),
+		},
+		result: false,
+		err:    errors.New("Player style \"smasher\" is not valid\nPlayer handedness \"both\" is not valid\nPlayer grip \"seemiller\" is not valid"),
+	},
+	{
+		param: domain.Player{
+			ID:     "sfssf-2342-sdfs-fssdsd-sfssds",
+			Names:  "Xu Xin",
+			Wins:   0,
+			Losses: 0,
+			PlayerProfile: domain.PlayerProfile{
+				Style: domain.PenholdAttacker,
+				Grip:  domain.ShakehandGrip,
+			},
+			Created: time.Now(),
+			Updated: time.Now(),
+		},
+		result: false,
+		err:    errors.New("Player with penhold-attacker style must use a penhold grip"),
+	},
 }
 
 func TestValidatePlayer(t *testing.T) {
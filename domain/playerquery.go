@@ -0,0 +1,299 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxPageSize is the biggest number of players a page can have.
+const MaxPageSize = 100
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded or it was created for
+// another sort order.
+var ErrInvalidCursor = errors.New("cursor is not valid")
+
+// SortField is a field of the players they can be sorted by.
+type SortField string
+
+// Fields the players can be sorted by.
+const (
+	SortByNames    SortField = "names"
+	SortByWins     SortField = "wins"
+	SortByLosses   SortField = "losses"
+	SortByRating   SortField = "rating"
+	SortByWinRatio SortField = "winratio"
+	SortByCreated  SortField = "created"
+	SortByUpdated  SortField = "updated"
+)
+
+// SortKey sorts the players by a field in ascending or descending order.
+type SortKey struct {
+	Field      SortField
+	Descending bool
+}
+
+// PlayerQuery selects, sorts and pages the players. Empty filters select every player,
+// players with the same values on every sort key are sorted by id, so pages are stable.
+type PlayerQuery struct {
+	MinWins, MaxWins         *int          // number of wins, both inclusive
+	MinWinRatio, MaxWinRatio *float64      // wins divided by played matches, both inclusive
+	CreatedFrom              time.Time     // players created at this time or later
+	CreatedTo                time.Time     // players created before this time
+	NamesPrefix              string        // names starting with this text, case sensitive
+	Profile                  PlayerProfile // not empty attributes the profile must match
+	IncludeArchived          bool          // archived players are left out unless it is true
+	Sort                     []SortKey     // sort keys in order of precedence
+	Limit                    int           // players per page, zero returns all of them
+	Cursor                   string        // position after which the page starts, empty for the first page
+}
+
+// PlayerPage is a page of the players selected by a query.
+type PlayerPage struct {
+	Players    []Player `json:"players"`
+	Total      int      `json:"total"`                // number of players matching the filters on every page
+	NextCursor string   `json:"nextCursor,omitempty"` // cursor of the next page, empty on the last one
+}
+
+// cursor is the position of the last player of a page, encoded as base64 json.
+type cursor struct {
+	Sort   string `json:"sort"`   // sort order the position belongs to
+	Player Player `json:"player"` // last player of the page
+}
+
+// WinRatio returns the wins of the player divided by its played matches, zero if it
+// didn't play any match.
+func (p Player) WinRatio() float64 {
+	if p.Wins+p.Losses == 0 {
+		return 0
+	}
+	return float64(p.Wins) / float64(p.Wins+p.Losses)
+}
+
+// ParseSort reads sort keys from a comma separated list of fields, the fields with a
+// minus sign before are sorted in descending order, e.g. "-wins,names".
+func ParseSort(value string) ([]SortKey, error) {
+	var result []SortKey
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key := SortKey{Field: SortField(strings.TrimPrefix(field, "-")), Descending: strings.HasPrefix(field, "-")}
+		if !key.Field.valid() {
+			return nil, fmt.Errorf("players cannot be sorted by %q", key.Field)
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// FormatSort returns the sort keys the way ParseSort reads them.
+func FormatSort(keys []SortKey) string {
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.Descending {
+			fields = append(fields, "-"+string(key.Field))
+			continue
+		}
+		fields = append(fields, string(key.Field))
+	}
+	return strings.Join(fields, ",")
+}
+
+// ValidatePlayerQuery checks that the filters, sort keys, limit and cursor of the query
+// are valid.
+func ValidatePlayerQuery(query PlayerQuery) (bool, error) {
+	var result []string
+	if query.MinWins != nil && query.MaxWins != nil && *query.MinWins > *query.MaxWins {
+		result = append(result, "Minimum wins cannot be greater than maximum wins")
+	}
+	for _, ratio := range []*float64{query.MinWinRatio, query.MaxWinRatio} {
+		if ratio != nil && (*ratio < 0 || *ratio > 1) {
+			result = append(result, "Win ratio must be between 0 and 1")
+			break
+		}
+	}
+	if !query.CreatedFrom.IsZero() && !query.CreatedTo.IsZero() && !query.CreatedFrom.Before(query.CreatedTo) {
+		result = append(result, "Creation range must start before it ends")
+	}
+	for _, key := range query.Sort {
+		if !key.Field.valid() {
+			result = append(result, fmt.Sprintf("Players cannot be sorted by %q", key.Field))
+		}
+	}
+	if query.Limit < 0 || query.Limit > MaxPageSize {
+		result = append(result, fmt.Sprintf("Limit must be between 1 and %d", MaxPageSize))
+	}
+	if _, _, err := query.After(); err != nil {
+		result = append(result, err.Error())
+	}
+	if len(result) > 0 {
+		strresult := strings.Join(result, "\n")
+		log.Debugf("player query %+v is not valid, because: %s", query, strresult)
+		return false, errors.New(strresult)
+	}
+	return true, nil
+}
+
+// Matches checks that the player passes the filters of the query.
+func (q PlayerQuery) Matches(player Player) bool {
+	switch {
+	case player.Archived && !q.IncludeArchived:
+		return false
+	case q.MinWins != nil && player.Wins < *q.MinWins:
+		return false
+	case q.MaxWins != nil && player.Wins > *q.MaxWins:
+		return false
+	case q.MinWinRatio != nil && player.WinRatio() < *q.MinWinRatio:
+		return false
+	case q.MaxWinRatio != nil && player.WinRatio() > *q.MaxWinRatio:
+		return false
+	case !q.CreatedFrom.IsZero() && player.Created.Before(q.CreatedFrom):
+		return false
+	case !q.CreatedTo.IsZero() && !player.Created.Before(q.CreatedTo):
+		return false
+	case !strings.HasPrefix(player.Names, q.NamesPrefix):
+		return false
+	}
+	return q.Profile.Matches(player.PlayerProfile)
+}
+
+// Compare returns a negative number if player a comes before player b in the order of
+// the query, a positive number if it comes after and zero if both are the same player.
+func (q PlayerQuery) Compare(a, b Player) int {
+	for _, key := range q.Sort {
+		result := key.Field.compare(a, b)
+		if key.Descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return strings.Compare(string(a.ID), string(b.ID))
+}
+
+// After returns the player the page starts after, false on the first page.
+func (q PlayerQuery) After() (Player, bool, error) {
+	if q.Cursor == "" {
+		return Player{}, false, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return Player{}, false, ErrInvalidCursor
+	}
+	var position cursor
+	if err := json.Unmarshal(data, &position); err != nil || position.Player.ID == "" {
+		return Player{}, false, ErrInvalidCursor
+	}
+	if position.Sort != FormatSort(q.Sort) {
+		return Player{}, false, fmt.Errorf("%w, it was created for sort %q", ErrInvalidCursor, position.Sort)
+	}
+	return position.Player, true, nil
+}
+
+// CursorAfter returns the cursor of the page that starts after the given player.
+func (q PlayerQuery) CursorAfter(player Player) string {
+	// only the fields players are sorted by are needed
+	position := cursor{
+		Sort: FormatSort(q.Sort),
+		Player: Player{
+			ID: player.ID, Names: player.Names, Wins: player.Wins, Losses: player.Losses,
+			Rating: player.Rating, Created: player.Created, Updated: player.Updated,
+		},
+	}
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Page selects, sorts and pages the given players, repositories without a query
+// language use it to run the query on their players.
+func (q PlayerQuery) Page(players []Player) (PlayerPage, error) {
+	after, ok, err := q.After()
+	if err != nil {
+		return PlayerPage{}, err
+	}
+	selected := make([]Player, 0, len(players))
+	for _, player := range players {
+		if q.Matches(player) {
+			selected = append(selected, player)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return q.Compare(selected[i], selected[j]) < 0
+	})
+	result := PlayerPage{Total: len(selected)}
+	if ok {
+		start := sort.Search(len(selected), func(i int) bool {
+			return q.Compare(selected[i], after) > 0
+		})
+		selected = selected[start:]
+	}
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[:q.Limit]
+		result.NextCursor = q.CursorAfter(selected[q.Limit-1])
+	}
+	result.Players = selected
+	return result, nil
+}
+
+// Value returns the value of the field for the given player.
+func (f SortField) Value(player Player) interface{} {
+	switch f {
+	case SortByNames:
+		return player.Names
+	case SortByWins:
+		return player.Wins
+	case SortByLosses:
+		return player.Losses
+	case SortByRating:
+		return player.Rating
+	case SortByWinRatio:
+		return player.WinRatio()
+	case SortByCreated:
+		return player.Created
+	case SortByUpdated:
+		return player.Updated
+	}
+	return nil
+}
+
+// valid checks that the players can be sorted by the field.
+func (f SortField) valid() bool {
+	switch f {
+	case SortByNames, SortByWins, SortByLosses, SortByRating, SortByWinRatio, SortByCreated, SortByUpdated:
+		return true
+	}
+	return false
+}
+
+// compare compares the field of both players in ascending order.
+func (f SortField) compare(a, b Player) int {
+	switch left := f.Value(a).(type) {
+	case string:
+		return strings.Compare(left, f.Value(b).(string))
+	case int:
+		return compareNumbers(float64(left), float64(f.Value(b).(int)))
+	case float64:
+		return compareNumbers(left, f.Value(b).(float64))
+	case time.Time:
+		return left.Compare(f.Value(b).(time.Time))
+	}
+	return 0
+}
+
+// compareNumbers returns -1, 0 or 1 when a is less, equal or greater than b.
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestParseSort(t *testing.T) {
+	// given a sort with many fields in both directions
+	keys, err := domain.ParseSort("-wins, names,,winratio")
+	// then every field is read in order
+	if err != nil {
+		t.Fatalf("error was not expected, but: %s", err)
+	}
+	want := []domain.SortKey{
+		{Field: domain.SortByWins, Descending: true},
+		{Field: domain.SortByNames},
+		{Field: domain.SortByWinRatio},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("sort keys %+v were expected, but got: %+v", want, keys)
+	}
+	for index := range want {
+		if keys[index] != want[index] {
+			t.Errorf("sort keys %+v were expected, but got: %+v", want, keys)
+		}
+	}
+	if got := domain.FormatSort(keys); got != "-wins,names,winratio" {
+		t.Errorf("sort %q was expected, but got: %q", "-wins,names,winratio", got)
+	}
+	// and unknown fields are not valid
+	if _, err := domain.ParseSort("-id"); err == nil {
+		t.Errorf("players cannot be sorted by id")
+	}
+}
+
+func TestValidatePlayerQuery(t *testing.T) {
+	five, four := 5, 4
+	negative := -0.1
+	cursor := domain.PlayerQuery{}.CursorAfter(*domain.NewPlayer("Ma Long"))
+	cases := map[string]struct {
+		query domain.PlayerQuery
+		want  string
+	}{
+		"empty":          {domain.PlayerQuery{}, ""},
+		"wins range":     {domain.PlayerQuery{MinWins: &five, MaxWins: &four}, "Minimum wins cannot be greater than maximum wins"},
+		"win ratio":      {domain.PlayerQuery{MinWinRatio: &negative}, "Win ratio must be between 0 and 1"},
+		"creation range": {domain.PlayerQuery{CreatedFrom: time.Now(), CreatedTo: time.Now().Add(-time.Hour)}, "Creation range must start before it ends"},
+		"sort":           {domain.PlayerQuery{Sort: []domain.SortKey{{Field: "id"}}}, `Players cannot be sorted by "id"`},
+		"limit":          {domain.PlayerQuery{Limit: domain.MaxPageSize + 1}, "Limit must be between 1 and 100"},
+		"cursor":         {domain.PlayerQuery{Cursor: cursor}, ""},
+		"broken cursor":  {domain.PlayerQuery{Cursor: "not a cursor"}, domain.ErrInvalidCursor.Error()},
+		"cursor of another sort": {
+			domain.PlayerQuery{Cursor: cursor, Sort: []domain.SortKey{{Field: domain.SortByNames}}},
+			`cursor is not valid, it was created for sort ""`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ok, err := domain.ValidatePlayerQuery(c.query)
+			if c.want == "" {
+				if !ok || err != nil {
+					t.Errorf("query must be valid, but got: %v", err)
+				}
+				return
+			}
+			if ok || err == nil || err.Error() != c.want {
+				t.Errorf("error %q was expected, but got: %v", c.want, err)
+			}
+		})
+	}
+}
+
+func TestPlayerQueryPage(t *testing.T) {
+	// given players with the same wins
+	players := []domain.Player{
+		*domain.NewPlayerWithStatistics("Ma Long", 2, 0),
+		*domain.NewPlayerWithStatistics("Xu Xin", 1, 0),
+		*domain.NewPlayerWithStatistics("Timo Boll", 2, 1),
+		*domain.NewPlayerWithStatistics("Ding Ning", 1, 1),
+	}
+	query := domain.PlayerQuery{Sort: []domain.SortKey{{Field: domain.SortByWins, Descending: true}, {Field: domain.SortByNames}}, Limit: 3}
+	// when the first page is found
+	page, err := query.Page(players)
+	// then it has the first players and the cursor of the next one
+	if err != nil {
+		t.Fatalf("error was not expected, but: %s", err)
+	}
+	assertPage(t, page, 4, "Ma Long", "Timo Boll", "Ding Ning")
+	if page.NextCursor == "" {
+		t.Fatalf("a cursor to the next page was expected")
+	}
+	// and the next page has the rest
+	query.Cursor = page.NextCursor
+	page, err = query.Page(players)
+	if err != nil {
+		t.Fatalf("error was not expected, but: %s", err)
+	}
+	assertPage(t, page, 4, "Xu Xin")
+	if page.NextCursor != "" {
+		t.Errorf("the last page cannot have a next cursor, but got: %q", page.NextCursor)
+	}
+	// and a cursor for another sort is rejected
+	query.Sort = nil
+	if _, err := query.Page(players); !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Errorf("error %q was expected, but got: %v", domain.ErrInvalidCursor, err)
+	}
+}
+
+func assertPage(t *testing.T, page domain.PlayerPage, total int, names ...string) {
+	t.Helper()
+	if page.Total != total || len(page.Players) != len(names) {
+		t.Fatalf("%d of %d players were expected, but got: %+v", len(names), total, page)
+	}
+	for index, name := range names {
+		if page.Players[index].Names != name {
+			t.Errorf("players %v were expected, but got: %+v", names, page.Players)
+		}
+	}
+}
@@ -1,17 +1,47 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"errors"
+)
 
-// PlayerRepository defines standard behavior
+var (
+	// ErrPlayerNotFound is returned when a player that doesn't exist is updated.
+	ErrPlayerNotFound = errors.New("player not found")
+	// ErrVersionConflict is returned when a player is updated from a version that is no
+	// longer the stored one, because someone else changed it in between.
+	ErrVersionConflict = errors.New("player was changed by someone else")
+)
+
+// PlayerRepository defines standard behavior, its operations run inside the transaction
+// the context carries when it was begun by the repository.
 type PlayerRepository interface {
+	Transactor
 	// Save the given player
 	Save(ctx context.Context, player *Player) error
 	// FindById searches a player record with the given Id.
 	FindByID(ctx context.Context, id Key) (Player, error)
-	// FindAll returns all the players stored in the repository.
-	FindAll(ctx context.Context, sorted bool) ([]Player, error)
+	// FindAll returns the page of the players selected by the query, it doesn't check that
+	// the query is valid but it returns ErrInvalidCursor for cursors it cannot use.
+	FindAll(ctx context.Context, query PlayerQuery) (PlayerPage, error)
+	// Search returns the players whose names match every word of the text ignoring case
+	// and accents and tolerating typos, the best matches first and at most limit of them.
+	// Archived players are not found.
+	Search(ctx context.Context, text string, limit int) ([]SearchResult, error)
 	// UpdateWins increases the value on field wins
 	UpdateWins(ctx context.Context, playerID Key, wins int) error
 	// UpdateDefeats increases the value on field loses
 	UpdateDefeats(ctx context.Context, playerID Key, defeats int) error
+	// RecordMatchResult increases the wins of the winner and the losses of the loser at
+	// once, neither changes if the other one cannot be updated. Their versions increase.
+	RecordMatchResult(ctx context.Context, winnerID, loserID Key, wins, losses int) error
+	// Update replaces the stored player with the given one keeping its creation date, it
+	// returns ErrPlayerNotFound if there is not such player and ErrVersionConflict if the
+	// version of the given player is not the stored one. The version of the given player
+	// is increased like the stored one.
+	Update(ctx context.Context, player *Player) error
+	// Archive marks the player with the given id as archived instead of removing it, so
+	// the matches it played stay intact, its version increases. It returns ErrPlayerNotFound
+	// if there is not such player.
+	Archive(ctx context.Context, id Key) error
 }
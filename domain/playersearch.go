@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultSearchLimit is the number of players a search returns when it has no limit.
+const DefaultSearchLimit = 20
+
+// SearchResult is a player found by a search, the higher the score the better its names
+// match the text of the search, 1 is an exact match of every word.
+type SearchResult struct {
+	Player Player  `json:"player"`
+	Score  float64 `json:"score"`
+}
+
+// ValidateSearch checks that the search has some text and its limit is valid.
+func ValidateSearch(text string, limit int) (bool, error) {
+	var result []string
+	if strings.TrimSpace(text) == "" {
+		result = append(result, "Search text cannot be empty")
+	}
+	if limit < 0 || limit > MaxPageSize {
+		result = append(result, fmt.Sprintf("Limit must be between 1 and %d", MaxPageSize))
+	}
+	if len(result) > 0 {
+		strresult := strings.Join(result, "\n")
+		log.Debugf("search %q with limit %d is not valid, because: %s", text, limit, strresult)
+		return false, errors.New(strresult)
+	}
+	return true, nil
+}
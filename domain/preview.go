@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+)
+
+// confidenceZ is the z value for a 95% confidence interval
+const confidenceZ = 1.96
+
+// Interval models a confidence interval of a probability.
+type Interval struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// ScoreProbability contains how likely a final score of the match is.
+type ScoreProbability struct {
+	Score        string   `json:"score"`        // games won by player 1 and player 2, e.g. "3-1"
+	Player1Games int      `json:"player1Games"` // games won by player 1
+	Player2Games int      `json:"player2Games"` // games won by player 2
+	Probability  float64  `json:"probability"`  // share of simulations ending with this score
+	Confidence   Interval `json:"confidence"`   // 95% confidence interval of the probability
+}
+
+// MatchPreview contains the estimated outcome of a match between two players.
+type MatchPreview struct {
+	Player1ID             Key                `json:"player1ID"`
+	Player2ID             Key                `json:"player2ID"`
+	Simulations           int                `json:"simulations"`           // number of simulated matches
+	Player1WinProbability float64            `json:"player1WinProbability"` // share of matches won by player 1
+	Player2WinProbability float64            `json:"player2WinProbability"` // share of matches won by player 2
+	Confidence            Interval           `json:"confidence"`            // 95% confidence interval of player 1 win probability
+	Scores                []ScoreProbability `json:"scores"`                // distribution of the final scores
+}
+
+// PreviewMatch simulates the given number of matches between player1 and player2 on a pool
+// of workers and estimates the outcome. Players are passed by value and nothing is stored,
+// so the statistics of the players are never touched.
+func PreviewMatch(ctx context.Context, player1, player2 Player, settings MatchSettings, simulations, workers int) (*MatchPreview, error) {
+	log.Debugf("previewing match between %q and %q with %d simulations and %d workers",
+		player1.ID, player2.ID, simulations, workers)
+	if simulations < 1 {
+		return nil, errors.New("Number of simulations must be greater than zero")
+	}
+	if workers < 1 {
+		return nil, errors.New("Number of workers must be greater than zero")
+	}
+	if workers > simulations {
+		workers = simulations
+	}
+	// the narrative of the simulated matches is never read
+	settings.Quiet = true
+
+	jobs := make(chan struct{})
+	scores := make(chan MatchScore, workers)
+	// keeps the first simulation stopped by the rally guards
+	failures := make(chan error, 1)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				match, err := SimulateMatchContext(ctx, player1, player2, settings)
+				if err != nil {
+					log.Errorf("simulation between %q and %q was stopped: %s", player1.ID, player2.ID, err)
+					select {
+					case failures <- err:
+					default:
+					}
+					continue
+				}
+				scores <- match.Score
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; i < simulations; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- struct{}{}:
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(scores)
+	}()
+
+	// games won by each player are used as the key of the distribution
+	counts := make(map[GameScore]int)
+	var played, player1Wins int
+	for score := range scores {
+		played++
+		if score.Player1 > score.Player2 {
+			player1Wins++
+		}
+		counts[GameScore{Player1: score.Player1, Player2: score.Player2}]++
+	}
+	if played < simulations {
+		log.Errorf("match preview was interrupted after %d simulations", played)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, <-failures
+	}
+
+	preview := MatchPreview{
+		Player1ID:             player1.ID,
+		Player2ID:             player2.ID,
+		Simulations:           played,
+		Player1WinProbability: float64(player1Wins) / float64(played),
+		Player2WinProbability: float64(played-player1Wins) / float64(played),
+		Confidence:            wilsonInterval(player1Wins, played),
+	}
+	for score, count := range counts {
+		preview.Scores = append(preview.Scores, ScoreProbability{
+			Score:        MatchScore{Player1: score.Player1, Player2: score.Player2}.String(),
+			Player1Games: score.Player1,
+			Player2Games: score.Player2,
+			Probability:  float64(count) / float64(played),
+			Confidence:   wilsonInterval(count, played),
+		})
+	}
+	// from the best to the worst score for player 1
+	sort.Slice(preview.Scores, func(i, j int) bool {
+		diffi := preview.Scores[i].Player1Games - preview.Scores[i].Player2Games
+		diffj := preview.Scores[j].Player1Games - preview.Scores[j].Player2Games
+		return diffi > diffj
+	})
+	return &preview, nil
+}
+
+// wilsonInterval returns the 95% Wilson score interval of the given successes in trials.
+func wilsonInterval(successes, trials int) Interval {
+	n := float64(trials)
+	p := float64(successes) / n
+	z2 := confidenceZ * confidenceZ
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := confidenceZ * math.Sqrt(p*(1-p)/n+z2/(4*n*n)) / (1 + z2/n)
+	return Interval{
+		Lower: math.Max(0, center-margin),
+		Upper: math.Min(1, center+margin),
+	}
+}
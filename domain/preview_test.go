@@ -0,0 +1,54 @@
+package domain_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestPreviewMatch(t *testing.T) {
+	player1 := domain.NewPlayer("Ma Long")
+	player2 := domain.NewPlayer("Fan Zhendong")
+	simulations := 200
+
+	got, err := domain.PreviewMatch(context.TODO(), *player1, *player2, domain.DefaultMatchSettings(), simulations, 4)
+
+	if err != nil {
+		t.Fatalf("error was not expected, but got: %s", err)
+	}
+	if got.Simulations != simulations {
+		t.Errorf("%d simulations were expected, but got: %d", simulations, got.Simulations)
+	}
+	if math.Abs(got.Player1WinProbability+got.Player2WinProbability-1) > 1e-9 {
+		t.Errorf("win probabilities must add up to one, but got: %f and %f",
+			got.Player1WinProbability, got.Player2WinProbability)
+	}
+	if got.Confidence.Lower > got.Player1WinProbability || got.Confidence.Upper < got.Player1WinProbability {
+		t.Errorf("the confidence interval %+v must contain the win probability %f", got.Confidence, got.Player1WinProbability)
+	}
+	var total float64
+	for _, score := range got.Scores {
+		total += score.Probability
+		if score.Player1Games != domain.DefaultGamesToWin && score.Player2Games != domain.DefaultGamesToWin {
+			t.Errorf("every final score must have a winner, but got: %s", score.Score)
+		}
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("score probabilities must add up to one, but got: %f", total)
+	}
+}
+
+func TestPreviewMatchCancelled(t *testing.T) {
+	player1 := domain.NewPlayer("Ma Long")
+	player2 := domain.NewPlayer("Fan Zhendong")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := domain.PreviewMatch(ctx, *player1, *player2, domain.DefaultMatchSettings(), 100000, 2)
+
+	if err == nil {
+		t.Errorf("a cancelled preview must return an error")
+	}
+}
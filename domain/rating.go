@@ -0,0 +1,31 @@
+package domain
+
+import "math"
+
+const (
+	// DefaultRating is the rating of a new player
+	DefaultRating = 1500
+	// ratingPointsPerRisk is the rating gap that adds one per mille of error risk
+	// to the weaker player and removes it from the stronger one
+	ratingPointsPerRisk = 25
+	// ratingFactor is the most rating points a player can win or lose in a match
+	ratingFactor = 32
+	// ratingScale is the rating gap that makes the stronger player ten times as likely
+	// to win as the weaker one
+	ratingScale = 400
+)
+
+// RatingRisk returns the extra error risk, in per mille, that the given player has
+// on every shot because of the rating gap with the opponent. It is negative when the
+// player is stronger than the opponent.
+func RatingRisk(player, opponent Player) int {
+	return (opponent.Rating - player.Rating) / ratingPointsPerRisk
+}
+
+// RatingChange returns the rating points the winner of a match takes from the loser,
+// following the Elo system: the less likely the win was, the more points it takes. The
+// loser never goes below zero.
+func RatingChange(winner, loser Player) int {
+	expected := 1 / (1 + math.Pow(10, float64(loser.Rating-winner.Rating)/ratingScale))
+	return min(int(math.Round(ratingFactor*(1-expected))), loser.Rating)
+}
@@ -0,0 +1,31 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestRatingChange(t *testing.T) {
+	tests := map[string]struct {
+		winner, loser int
+		want          int
+	}{
+		"even players":          {winner: 1500, loser: 1500, want: 16},
+		"favourite wins":        {winner: 1900, loser: 1500, want: 3},
+		"underdog wins":         {winner: 1500, loser: 1900, want: 29},
+		"loser with few points": {winner: 100, loser: 5, want: 5},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// given a winner and a loser with their ratings
+			winner, loser := domain.Player{Rating: tt.winner}, domain.Player{Rating: tt.loser}
+			// when the change of the ratings is calculated
+			got := domain.RatingChange(winner, loser)
+			// then the less likely the win was, the more points it takes
+			if got != tt.want {
+				t.Errorf("%d rating points were expected, but got: %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package repositorytest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// NewRepositories creates an empty repository of players and the repository of matches
+// of the same backend for a test, it is called once per test.
+type NewRepositories func(t *testing.T) (domain.PlayerRepository, domain.MatchRepository)
+
+// TestMatchRepository runs the conformance suite on the repositories of matches created
+// by the given function.
+func TestMatchRepository(t *testing.T, newRepositories NewRepositories) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, players domain.PlayerRepository, matches domain.MatchRepository)
+	}{
+		{"save and find", testSaveAndFindMatch},
+		{"save duplicates", testSaveDuplicatedMatch},
+		{"find missing id", testFindMissingMatch},
+		{"transaction commit", testMatchTransactionCommit},
+		{"transaction rollback", testMatchTransactionRollback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			players, matches := newRepositories(t)
+			tt.test(t, players, matches)
+		})
+	}
+}
+
+func testSaveAndFindMatch(t *testing.T, _ domain.PlayerRepository, matches domain.MatchRepository) {
+	// given a played match
+	match := playMatch(domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll"))
+	// when it is stored
+	assertNoError(t, matches.Save(context.TODO(), match))
+	got, err := matches.FindByID(context.TODO(), match.ID)
+	// then it is found with the same report
+	assertNoError(t, err)
+	if got.ID != match.ID || got.Player1ID != match.Player1ID || got.Player2ID != match.Player2ID ||
+		got.Winner == nil || got.Winner.ID != match.Winner.ID || got.Loser == nil || got.Loser.ID != match.Loser.ID {
+		t.Errorf("match %s won by %s was expected, but got: %+v", match.ID, match.Winner.ID, got)
+	}
+	if got.Score.Player1 != match.Score.Player1 || got.Score.Player2 != match.Score.Player2 ||
+		len(got.Score.Games) != len(match.Score.Games) || len(got.Narrative) != len(match.Narrative) {
+		t.Errorf("score %+v was expected, but got: %+v", match.Score, got.Score)
+	}
+	if !got.Created.Equal(match.Created) || got.Duration != match.Duration {
+		t.Errorf("match created at %s lasting %s was expected, but got: %s lasting %s", match.Created, match.Duration, got.Created, got.Duration)
+	}
+}
+
+func testSaveDuplicatedMatch(t *testing.T, _ domain.PlayerRepository, matches domain.MatchRepository) {
+	// given a stored match
+	match := playMatch(domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll"))
+	assertNoError(t, matches.Save(context.TODO(), match))
+	// when it is stored again
+	err := matches.Save(context.TODO(), match)
+	// then it is rejected
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("a match cannot be stored twice, but got: %v", err)
+	}
+}
+
+func testFindMissingMatch(t *testing.T, _ domain.PlayerRepository, matches domain.MatchRepository) {
+	// when a match that was never stored is searched
+	got, err := matches.FindByID(context.TODO(), domain.GenerateUUIDKey())
+	// then an empty report is returned
+	assertNoError(t, err)
+	if got.ID != "" {
+		t.Errorf("empty match was expected, but got: %+v", got)
+	}
+}
+
+func testMatchTransactionCommit(t *testing.T, players domain.PlayerRepository, matches domain.MatchRepository) {
+	// given two players
+	player1, player2 := domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll")
+	savePlayers(t, players, player1, player2)
+	match := playMatch(player1, player2)
+	// when the match and its result are recorded in a transaction of the players
+	err := domain.RunInTransaction(context.TODO(), players, func(ctx context.Context) error {
+		if err := matches.Save(ctx, match); err != nil {
+			return err
+		}
+		// the transaction reads its own changes
+		got, err := matches.FindByID(ctx, match.ID)
+		if err == nil && got.ID != match.ID {
+			t.Errorf("the transaction must read its own changes, but got: %+v", got)
+		}
+		if err != nil {
+			return err
+		}
+		return players.RecordMatchResult(ctx, match.Winner.ID, match.Loser.ID, 1, 1)
+	})
+	// then both are kept
+	assertNoError(t, err)
+	assertMatch(t, matches, match.ID, true)
+	assertStatistics(t, players, match.Winner.ID, 1, 0)
+}
+
+func testMatchTransactionRollback(t *testing.T, players domain.PlayerRepository, matches domain.MatchRepository) {
+	// given two players
+	player1, player2 := domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll")
+	savePlayers(t, players, player1, player2)
+	match := playMatch(player1, player2)
+	// when a transaction that stored the match and its result fails
+	failure := errors.New("ratings cannot be updated")
+	err := domain.RunInTransaction(context.TODO(), players, func(ctx context.Context) error {
+		if err := matches.Save(ctx, match); err != nil {
+			return err
+		}
+		if err := players.RecordMatchResult(ctx, match.Winner.ID, match.Loser.ID, 1, 1); err != nil {
+			return err
+		}
+		return failure
+	})
+	// then neither is kept
+	if err != failure {
+		t.Fatalf("error %q was expected, but got: %v", failure, err)
+	}
+	assertMatch(t, matches, match.ID, false)
+	assertStatistics(t, players, match.Winner.ID, 0, 0)
+	// and the match can still be stored
+	assertNoError(t, matches.Save(context.TODO(), match))
+	assertMatch(t, matches, match.ID, true)
+}
+
+// playMatch plays a match between the given players with default settings.
+func playMatch(player1, player2 *domain.Player) *domain.MatchReport {
+	return domain.SimulateMatch(*player1, *player2)
+}
+
+func assertMatch(t *testing.T, matches domain.MatchRepository, matchID domain.Key, stored bool) {
+	t.Helper()
+	got, err := matches.FindByID(context.TODO(), matchID)
+	assertNoError(t, err)
+	if stored && got.ID != matchID {
+		t.Errorf("match %s was expected to be stored, but got: %+v", matchID, got)
+	}
+	if !stored && got.ID != "" {
+		t.Errorf("match %s was not expected to be stored, but got: %+v", matchID, got)
+	}
+}
@@ -0,0 +1,739 @@
+// Package repositorytest contains the conformance suite every implementation of
+// domain.PlayerRepository must pass, so all the backends behave the same way.
+package repositorytest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// concurrentUpdates is the number of wins and the number of defeats added at the same time.
+const concurrentUpdates = 50
+
+// byNamesDescending sorts the players by names in descending order.
+var byNamesDescending = domain.PlayerQuery{Sort: []domain.SortKey{{Field: domain.SortByNames, Descending: true}}}
+
+// NewRepository creates an empty repository for a test, it is called once per test.
+type NewRepository func(t *testing.T) domain.PlayerRepository
+
+// TestPlayerRepository runs the conformance suite on the repositories created by the
+// given function.
+func TestPlayerRepository(t *testing.T, newRepository NewRepository) {
+	t.Run("save and find", func(t *testing.T) { testSaveAndFind(t, newRepository(t)) })
+	t.Run("save duplicates", func(t *testing.T) { testSaveDuplicates(t, newRepository(t)) })
+	t.Run("find missing id", func(t *testing.T) { testFindMissingID(t, newRepository(t)) })
+	t.Run("find all", func(t *testing.T) { testFindAll(t, newRepository(t)) })
+	t.Run("find all sorted", func(t *testing.T) { testFindAllSorted(t, newRepository(t)) })
+	t.Run("find all with filters", func(t *testing.T) { testFindAllWithFilters(t, newRepository(t)) })
+	t.Run("find all sorted by many keys", func(t *testing.T) { testFindAllSortedByManyKeys(t, newRepository(t)) })
+	t.Run("find all by pages", func(t *testing.T) { testFindAllByPages(t, newRepository(t)) })
+	t.Run("search", func(t *testing.T) { testSearch(t, newRepository(t)) })
+	t.Run("search follows changes", func(t *testing.T) { testSearchFollowsChanges(t, newRepository(t)) })
+	t.Run("update statistics", func(t *testing.T) { testUpdateStatistics(t, newRepository(t)) })
+	t.Run("update missing player", func(t *testing.T) { testUpdateMissingPlayer(t, newRepository(t)) })
+	t.Run("update player", func(t *testing.T) { testUpdatePlayer(t, newRepository(t)) })
+	t.Run("update stale player", func(t *testing.T) { testUpdateStalePlayer(t, newRepository(t)) })
+	t.Run("versions", func(t *testing.T) { testVersions(t, newRepository(t)) })
+	t.Run("archive player", func(t *testing.T) { testArchivePlayer(t, newRepository(t)) })
+	t.Run("record match result", func(t *testing.T) { testRecordMatchResult(t, newRepository(t)) })
+	t.Run("concurrent updates", func(t *testing.T) { testConcurrentUpdates(t, newRepository(t)) })
+	t.Run("concurrent matches", func(t *testing.T) { testConcurrentMatches(t, newRepository(t)) })
+	t.Run("cancelled context", func(t *testing.T) { testCancelledContext(t, newRepository(t)) })
+	t.Run("transaction commit", func(t *testing.T) { testTransactionCommit(t, newRepository(t)) })
+	t.Run("transaction rollback", func(t *testing.T) { testTransactionRollback(t, newRepository(t)) })
+}
+
+func testSaveAndFind(t *testing.T, repo domain.PlayerRepository) {
+	// given a player with all its data
+	player := domain.NewPlayerWithStatistics("Ma Long", 3, 1)
+	player.PlayerProfile = domain.PlayerProfile{Style: domain.OffensiveLooper, Handedness: "right", Grip: "shakehand"}
+	// when it is stored
+	savePlayers(t, repo, player)
+	got, err := repo.FindByID(context.TODO(), player.ID)
+	// then it is found with the same data
+	assertNoError(t, err)
+	if got.ID != player.ID || got.Names != player.Names || got.Wins != player.Wins ||
+		got.Losses != player.Losses || got.Rating != player.Rating || got.PlayerProfile != player.PlayerProfile {
+		t.Errorf("player %+v was expected, but got: %+v", *player, got)
+	}
+	if !got.Created.Equal(player.Created) || !got.Updated.Equal(player.Updated) {
+		t.Errorf("dates %s and %s were expected, but got: %s and %s", player.Created, player.Updated, got.Created, got.Updated)
+	}
+}
+
+func testSaveDuplicates(t *testing.T, repo domain.PlayerRepository) {
+	// given a stored player
+	player := domain.NewPlayer("Ma Long")
+	savePlayers(t, repo, player)
+	// when it is stored again with other data
+	duplicate := *player
+	duplicate.Names = "Xu Xin"
+	err := repo.Save(context.TODO(), &duplicate)
+	// then it is rejected and the stored player doesn't change
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("a player cannot be stored twice, but got: %v", err)
+	}
+	got, err := repo.FindByID(context.TODO(), player.ID)
+	assertNoError(t, err)
+	if got.Names != player.Names {
+		t.Errorf("player %q must not be replaced, but got: %q", player.Names, got.Names)
+	}
+	all := findAll(t, repo, domain.PlayerQuery{})
+	if len(all) != 1 {
+		t.Errorf("one player was expected, but got: %+v", all)
+	}
+}
+
+func testFindMissingID(t *testing.T, repo domain.PlayerRepository) {
+	// when an unknown id is found
+	got, err := repo.FindByID(context.TODO(), domain.GenerateUUIDKey())
+	// then an empty player is returned without error
+	assertNoError(t, err)
+	if got.ID != "" {
+		t.Errorf("an empty player was expected, but got: %+v", got)
+	}
+}
+
+func testFindAll(t *testing.T, repo domain.PlayerRepository) {
+	// given an empty repository
+	all := findAll(t, repo, domain.PlayerQuery{})
+	if len(all) != 0 {
+		t.Errorf("no players were expected, but got: %+v", all)
+	}
+	// when some players are stored
+	savePlayers(t, repo, domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll"), domain.NewPlayer("Xu Xin"))
+	all = findAll(t, repo, domain.PlayerQuery{})
+	// then all of them are found
+	assertNames(t, all, "Ma Long", "Timo Boll", "Xu Xin")
+}
+
+func testFindAllSorted(t *testing.T, repo domain.PlayerRepository) {
+	// given players stored in no order, two of them with the same names
+	savePlayers(t, repo,
+		domain.NewPlayer("Ma Long"),
+		domain.NewPlayer("Timo Boll"),
+		domain.NewPlayer("Jan-Ove Waldner"),
+		domain.NewPlayer("Xu Xin"),
+		domain.NewPlayer("Ma Long"),
+	)
+	// when they are found sorted
+	all := findAll(t, repo, byNamesDescending)
+	// then they are sorted by names in descending order
+	var got []string
+	for _, player := range all {
+		got = append(got, player.Names)
+	}
+	want := []string{"Xu Xin", "Timo Boll", "Ma Long", "Ma Long", "Jan-Ove Waldner"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("players %v were expected, but got: %v", want, got)
+	}
+}
+
+func testFindAllWithFilters(t *testing.T, repo domain.PlayerRepository) {
+	// given players with different statistics, creation dates and profiles, one of them archived
+	created := time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+	players := []*domain.Player{
+		domain.NewPlayerWithStatistics("Ma Long", 10, 0),
+		domain.NewPlayerWithStatistics("Ma Lin", 6, 2),
+		domain.NewPlayerWithStatistics("Timo Boll", 4, 4),
+		domain.NewPlayerWithStatistics("Xu Xin", 0, 0),
+		domain.NewPlayerWithStatistics("Jan-Ove Waldner", 8, 2),
+	}
+	for index, player := range players {
+		player.Created = created.Add(time.Duration(index) * 24 * time.Hour)
+	}
+	players[2].PlayerProfile = domain.PlayerProfile{Handedness: domain.LeftHanded}
+	savePlayers(t, repo, players...)
+	assertNoError(t, repo.Archive(context.TODO(), players[4].ID))
+	five, eight := 5, 8
+	half, most := 0.5, 0.9
+	cases := map[string]struct {
+		query domain.PlayerQuery
+		want  []string
+	}{
+		"no filters":       {domain.PlayerQuery{}, []string{"Ma Long", "Ma Lin", "Timo Boll", "Xu Xin"}},
+		"archived":         {domain.PlayerQuery{IncludeArchived: true}, []string{"Ma Long", "Ma Lin", "Timo Boll", "Xu Xin", "Jan-Ove Waldner"}},
+		"minimum wins":     {domain.PlayerQuery{MinWins: &five}, []string{"Ma Long", "Ma Lin"}},
+		"maximum wins":     {domain.PlayerQuery{MaxWins: &five}, []string{"Timo Boll", "Xu Xin"}},
+		"wins range":       {domain.PlayerQuery{MinWins: &five, MaxWins: &eight, IncludeArchived: true}, []string{"Ma Lin", "Jan-Ove Waldner"}},
+		"minimum ratio":    {domain.PlayerQuery{MinWinRatio: &half}, []string{"Ma Long", "Ma Lin", "Timo Boll"}},
+		"maximum ratio":    {domain.PlayerQuery{MaxWinRatio: &half}, []string{"Timo Boll", "Xu Xin"}},
+		"ratio range":      {domain.PlayerQuery{MinWinRatio: &half, MaxWinRatio: &most}, []string{"Ma Lin", "Timo Boll"}},
+		"created from":     {domain.PlayerQuery{CreatedFrom: created.Add(24 * time.Hour)}, []string{"Ma Lin", "Timo Boll", "Xu Xin"}},
+		"created to":       {domain.PlayerQuery{CreatedTo: created.Add(24 * time.Hour)}, []string{"Ma Long"}},
+		"created range":    {domain.PlayerQuery{CreatedFrom: created.Add(time.Hour), CreatedTo: created.Add(72 * time.Hour)}, []string{"Ma Lin", "Timo Boll"}},
+		"names prefix":     {domain.PlayerQuery{NamesPrefix: "Ma L"}, []string{"Ma Long", "Ma Lin"}},
+		"names are exact":  {domain.PlayerQuery{NamesPrefix: "ma l"}, nil},
+		"profile":          {domain.PlayerQuery{Profile: domain.PlayerProfile{Handedness: domain.LeftHanded}}, []string{"Timo Boll"}},
+		"many filters":     {domain.PlayerQuery{NamesPrefix: "Ma", MinWinRatio: &most}, []string{"Ma Long"}},
+		"nothing selected": {domain.PlayerQuery{MinWins: &eight, MaxWins: &eight}, nil},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// when the players are found with the filters
+			got := findAll(t, repo, c.query)
+			// then only the players that pass them are found
+			if len(got) != len(c.want) {
+				t.Errorf("players %v were expected, but got: %+v", c.want, got)
+				return
+			}
+			assertNames(t, got, c.want...)
+		})
+	}
+}
+
+func testFindAllSortedByManyKeys(t *testing.T, repo domain.PlayerRepository) {
+	// given players with the same wins and win ratios
+	created := time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+	players := []*domain.Player{
+		domain.NewPlayerWithStatistics("Ma Long", 6, 2),
+		domain.NewPlayerWithStatistics("Timo Boll", 6, 6),
+		domain.NewPlayerWithStatistics("Xu Xin", 3, 1),
+		domain.NewPlayerWithStatistics("Jan-Ove Waldner", 8, 2),
+		domain.NewPlayerWithStatistics("Ding Ning", 0, 0),
+	}
+	for index, player := range players {
+		// the nanoseconds check that dates are compared with all their precision
+		player.Created = created.Add(time.Duration(len(players)-index) * time.Nanosecond * 100)
+	}
+	savePlayers(t, repo, players...)
+	cases := map[string][]string{
+		"-wins,names":          {"Jan-Ove Waldner", "Ma Long", "Timo Boll", "Xu Xin", "Ding Ning"},
+		"-wins,-names":         {"Jan-Ove Waldner", "Timo Boll", "Ma Long", "Xu Xin", "Ding Ning"},
+		"winratio,-losses":     {"Ding Ning", "Timo Boll", "Ma Long", "Xu Xin", "Jan-Ove Waldner"},
+		"-winratio,names":      {"Jan-Ove Waldner", "Ma Long", "Xu Xin", "Timo Boll", "Ding Ning"},
+		"created":              {"Ding Ning", "Jan-Ove Waldner", "Xu Xin", "Timo Boll", "Ma Long"},
+		"losses,-wins,names":   {"Ding Ning", "Xu Xin", "Jan-Ove Waldner", "Ma Long", "Timo Boll"},
+		"rating,-created,wins": {"Ma Long", "Timo Boll", "Xu Xin", "Jan-Ove Waldner", "Ding Ning"},
+	}
+	for sort, want := range cases {
+		t.Run(sort, func(t *testing.T) {
+			keys, err := domain.ParseSort(sort)
+			assertNoError(t, err)
+			// when they are found sorted by many keys
+			got := findAll(t, repo, domain.PlayerQuery{Sort: keys})
+			// then the next keys sort the players with the same value on the previous ones
+			assertOrder(t, got, want...)
+		})
+	}
+}
+
+func testFindAllByPages(t *testing.T, repo domain.PlayerRepository) {
+	// given players, some of them with the same wins
+	names := []string{"Ma Long", "Timo Boll", "Xu Xin", "Jan-Ove Waldner", "Ding Ning", "Ma Lin", "Liu Guoliang"}
+	for index, name := range names {
+		savePlayers(t, repo, domain.NewPlayerWithStatistics(name, index%3, index))
+	}
+	query := domain.PlayerQuery{Sort: []domain.SortKey{{Field: domain.SortByWins, Descending: true}, {Field: domain.SortByNames}}, Limit: 3}
+	all := findAll(t, repo, domain.PlayerQuery{Sort: query.Sort})
+	// when they are found by pages following the cursors
+	var got []domain.Player
+	total := len(names)
+	for pages := 1; ; pages++ {
+		page, err := repo.FindAll(context.TODO(), query)
+		assertNoError(t, err)
+		if page.Total != total {
+			t.Errorf("total %d was expected, but got: %d", total, page.Total)
+		}
+		if len(page.Players) > query.Limit {
+			t.Fatalf("%d players per page were expected, but got: %d", query.Limit, len(page.Players))
+		}
+		got = append(got, page.Players...)
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Errorf("3 pages were expected, but got: %d", pages)
+			}
+			break
+		}
+		if pages == 1 {
+			// a player before the cursor doesn't move the next pages
+			savePlayers(t, repo, domain.NewPlayerWithStatistics("Wang Hao", 9, 0))
+			total++
+		}
+		query.Cursor = page.NextCursor
+	}
+	// then every player is found once in the same order
+	var want []string
+	for _, player := range all {
+		want = append(want, player.Names)
+	}
+	assertOrder(t, got, want...)
+	// and a cursor cannot be used with another order
+	query.Sort = []domain.SortKey{{Field: domain.SortByNames}}
+	if _, err := repo.FindAll(context.TODO(), query); !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Errorf("error %q was expected, but got: %v", domain.ErrInvalidCursor, err)
+	}
+}
+
+func testSearch(t *testing.T, repo domain.PlayerRepository) {
+	// given players with accents, hyphens and names in common
+	savePlayers(t, repo,
+		domain.NewPlayer("Fan Zhendong"), domain.NewPlayer("Ma Long"), domain.NewPlayer("Ma Lin"),
+		domain.NewPlayer("Félix Lebrun"), domain.NewPlayer("Jan-Ove Waldner"), domain.NewPlayer("Dimitrij Ovtcharov"),
+	)
+	cases := map[string]struct {
+		text  string
+		limit int
+		want  []string
+	}{
+		"one of the names":   {"zhendong", 0, []string{"Fan Zhendong"}},
+		"case and accents":   {"FELIX", 0, []string{"Félix Lebrun"}},
+		"accents in search":  {"jan-óve", 0, []string{"Jan-Ove Waldner"}},
+		"beginning of names": {"wald", 0, []string{"Jan-Ove Waldner"}},
+		"typo":               {"zhendonh", 0, []string{"Fan Zhendong"}},
+		"missing letter":     {"ovcharov", 0, []string{"Dimitrij Ovtcharov"}},
+		"swapped letters":    {"lebrnu", 0, []string{"Félix Lebrun"}},
+		"every word":         {"ma long", 0, []string{"Ma Long"}},
+		"same score by name": {"ma", 0, []string{"Ma Lin", "Ma Long"}},
+		"short words":        {"lin", 0, []string{"Ma Lin"}},
+		"limit":              {"ma", 1, []string{"Ma Lin"}},
+		"no match":           {"waldner zhendong", 0, nil},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assertOrder(t, search(t, repo, c.text, c.limit), c.want...)
+		})
+	}
+	// and only exact matches of every word score 1
+	for text, exact := range map[string]bool{"ma long": true, "ma lon": false, "ma lonh": false} {
+		results, err := repo.Search(context.TODO(), text, 0)
+		assertNoError(t, err)
+		if len(results) != 1 || (results[0].Score == 1) != exact {
+			t.Errorf("Ma Long with an exact score %t was expected for %q, but got: %+v", exact, text, results)
+		}
+	}
+}
+
+func testSearchFollowsChanges(t *testing.T, repo domain.PlayerRepository) {
+	// given a stored player
+	player := domain.NewPlayer("Ma Long")
+	savePlayers(t, repo, player)
+	assertOrder(t, search(t, repo, "long", 0), "Ma Long")
+	// when its names change
+	updated := *player
+	updated.Names = "Xu Xin"
+	assertNoError(t, repo.Update(context.TODO(), &updated))
+	// then it is found by the new names only
+	assertOrder(t, search(t, repo, "long", 0))
+	assertOrder(t, search(t, repo, "xin", 0), "Xu Xin")
+	// and it is not found once it is archived
+	assertNoError(t, repo.Archive(context.TODO(), player.ID))
+	assertOrder(t, search(t, repo, "xin", 0))
+	// and players of a rolled back transaction are never found
+	failure := errors.New("player cannot be stored")
+	err := domain.RunInTransaction(context.TODO(), repo, func(ctx context.Context) error {
+		if err := repo.Save(ctx, domain.NewPlayer("Timo Boll")); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("error %q was expected, but got: %v", failure, err)
+	}
+	assertOrder(t, search(t, repo, "boll", 0))
+	// while the ones of a committed transaction are found
+	err = domain.RunInTransaction(context.TODO(), repo, func(ctx context.Context) error {
+		return repo.Save(ctx, domain.NewPlayer("Timo Boll"))
+	})
+	assertNoError(t, err)
+	assertOrder(t, search(t, repo, "boll", 0), "Timo Boll")
+}
+
+func testUpdateStatistics(t *testing.T, repo domain.PlayerRepository) {
+	// given two players
+	winner, loser := domain.NewPlayerWithStatistics("Ma Long", 2, 1), domain.NewPlayer("Timo Boll")
+	savePlayers(t, repo, winner, loser)
+	// when the result of a match is added
+	assertNoError(t, repo.UpdateWins(context.TODO(), winner.ID, 1))
+	assertNoError(t, repo.UpdateDefeats(context.TODO(), loser.ID, 1))
+	// then only their counters change
+	assertStatistics(t, repo, winner.ID, 3, 1)
+	assertStatistics(t, repo, loser.ID, 0, 1)
+}
+
+func testUpdateMissingPlayer(t *testing.T, repo domain.PlayerRepository) {
+	// when the statistics of an unknown player are updated
+	unknown := domain.GenerateUUIDKey()
+	// then the player is not found
+	if err := repo.UpdateWins(context.TODO(), unknown, 1); errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("UpdateWins must return %q, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+	if err := repo.UpdateDefeats(context.TODO(), unknown, 1); errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("UpdateDefeats must return %q, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+	// and it is not created
+	got, err := repo.FindByID(context.TODO(), unknown)
+	assertNoError(t, err)
+	if got.ID != "" {
+		t.Errorf("an unknown player must not be created, but got: %+v", got)
+	}
+}
+
+func testUpdatePlayer(t *testing.T, repo domain.PlayerRepository) {
+	// given two stored players
+	player := domain.NewPlayerWithStatistics("Ma Long", 3, 1)
+	savePlayers(t, repo, player, domain.NewPlayer("Timo Boll"))
+	// when one of them is updated with other names, statistics and profile
+	updated := *player
+	updated.Names = "Xu Xin"
+	updated.Wins, updated.Losses, updated.Rating = 5, 2, 1600
+	updated.PlayerProfile = domain.PlayerProfile{Style: domain.OffensiveLooper, Handedness: "left", Grip: "penhold"}
+	updated.Created = player.Created.Add(time.Hour)
+	updated.Updated = player.Updated.Add(time.Minute)
+	err := repo.Update(context.TODO(), &updated)
+	// then it keeps the new data but its creation date
+	assertNoError(t, err)
+	got, err := repo.FindByID(context.TODO(), player.ID)
+	assertNoError(t, err)
+	if got.Names != updated.Names || got.Wins != 5 || got.Losses != 2 || got.Rating != 1600 || got.PlayerProfile != updated.PlayerProfile {
+		t.Errorf("player %+v was expected, but got: %+v", updated, got)
+	}
+	if !got.Created.Equal(player.Created) || !got.Updated.Equal(updated.Updated) {
+		t.Errorf("dates %s and %s were expected, but got: %s and %s", player.Created, updated.Updated, got.Created, got.Updated)
+	}
+	// and it is sorted by its new names
+	all := findAll(t, repo, byNamesDescending)
+	if len(all) != 2 || all[0].Names != "Xu Xin" || all[1].Names != "Timo Boll" {
+		t.Errorf("players Xu Xin and Timo Boll were expected, but got: %+v", all)
+	}
+	// and an unknown player cannot be updated
+	unknown := domain.NewPlayer("Jan-Ove Waldner")
+	if err := repo.Update(context.TODO(), unknown); errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("Update must return %q, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+}
+
+func testUpdateStalePlayer(t *testing.T, repo domain.PlayerRepository) {
+	// given a player that two managers read
+	player := domain.NewPlayer("Ma Long")
+	savePlayers(t, repo, player)
+	first, second := *player, *player
+	// when the first one updates it
+	first.Wins = 3
+	assertNoError(t, repo.Update(context.TODO(), &first))
+	// then its version increases
+	if first.Version != player.Version+1 {
+		t.Errorf("version %d was expected, but got: %d", player.Version+1, first.Version)
+	}
+	// and the second one cannot update it from the version it read
+	second.Losses = 4
+	if err := repo.Update(context.TODO(), &second); errors.Cause(err) != domain.ErrVersionConflict {
+		t.Errorf("Update must return %q, but got: %v", domain.ErrVersionConflict, err)
+	}
+	if second.Version != player.Version {
+		t.Errorf("version of a rejected update must not change, but got: %d", second.Version)
+	}
+	got, err := repo.FindByID(context.TODO(), player.ID)
+	assertNoError(t, err)
+	if got.Wins != 3 || got.Losses != 0 || got.Version != first.Version {
+		t.Errorf("player %+v was expected, but got: %+v", first, got)
+	}
+}
+
+func testVersions(t *testing.T, repo domain.PlayerRepository) {
+	// given two players on their first version
+	winner, loser := domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll")
+	savePlayers(t, repo, winner, loser)
+	assertVersion(t, repo, winner.ID, 1)
+	// when they play a match
+	assertNoError(t, repo.RecordMatchResult(context.TODO(), winner.ID, loser.ID, 1, 1))
+	// then both versions increase
+	assertVersion(t, repo, winner.ID, 2)
+	assertVersion(t, repo, loser.ID, 2)
+	// and archiving a player increases its version too
+	assertNoError(t, repo.Archive(context.TODO(), loser.ID))
+	assertVersion(t, repo, loser.ID, 3)
+}
+
+func testArchivePlayer(t *testing.T, repo domain.PlayerRepository) {
+	// given a stored player with statistics
+	player := domain.NewPlayerWithStatistics("Ma Long", 3, 1)
+	savePlayers(t, repo, player)
+	// when it is archived
+	err := repo.Archive(context.TODO(), player.ID)
+	// then it is kept archived with its statistics
+	assertNoError(t, err)
+	got, err := repo.FindByID(context.TODO(), player.ID)
+	assertNoError(t, err)
+	if !got.Archived || got.Names != player.Names || got.Wins != 3 || got.Losses != 1 {
+		t.Errorf("player %+v was expected to be archived, but got: %+v", *player, got)
+	}
+	assertNames(t, findAll(t, repo, domain.PlayerQuery{IncludeArchived: true}), "Ma Long")
+	// and it is left out unless archived players are included
+	assertNames(t, findAll(t, repo, byNamesDescending))
+	// and an unknown player cannot be archived
+	if err := repo.Archive(context.TODO(), domain.GenerateUUIDKey()); errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("Archive must return %q, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+}
+
+func testRecordMatchResult(t *testing.T, repo domain.PlayerRepository) {
+	// given two players
+	winner, loser := domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll")
+	savePlayers(t, repo, winner, loser)
+	// when the result of a match is recorded
+	assertNoError(t, repo.RecordMatchResult(context.TODO(), winner.ID, loser.ID, 1, 1))
+	// then both players change
+	assertStatistics(t, repo, winner.ID, 1, 0)
+	assertStatistics(t, repo, loser.ID, 0, 1)
+	// when the loser doesn't exist
+	err := repo.RecordMatchResult(context.TODO(), winner.ID, domain.GenerateUUIDKey(), 1, 1)
+	// then nothing changes
+	if errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("error %q was expected, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+	assertStatistics(t, repo, winner.ID, 1, 0)
+	// when the winner doesn't exist
+	err = repo.RecordMatchResult(context.TODO(), domain.GenerateUUIDKey(), loser.ID, 1, 1)
+	// then nothing changes
+	if errors.Cause(err) != domain.ErrPlayerNotFound {
+		t.Errorf("error %q was expected, but got: %v", domain.ErrPlayerNotFound, err)
+	}
+	assertStatistics(t, repo, loser.ID, 0, 1)
+}
+
+func testConcurrentUpdates(t *testing.T, repo domain.PlayerRepository) {
+	// given a player
+	player := domain.NewPlayer("Ma Long")
+	savePlayers(t, repo, player)
+	// when many matches update it at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*concurrentUpdates)
+	for i := 0; i < concurrentUpdates; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- repo.UpdateWins(context.TODO(), player.ID, 1)
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- repo.UpdateDefeats(context.TODO(), player.ID, 1)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	// then no update is lost
+	for err := range errs {
+		assertNoError(t, err)
+	}
+	assertStatistics(t, repo, player.ID, concurrentUpdates, concurrentUpdates)
+}
+
+func testConcurrentMatches(t *testing.T, repo domain.PlayerRepository) {
+	// given a few players
+	players := []*domain.Player{
+		domain.NewPlayer("Ma Long"),
+		domain.NewPlayer("Timo Boll"),
+		domain.NewPlayer("Xu Xin"),
+		domain.NewPlayer("Jan-Ove Waldner"),
+	}
+	savePlayers(t, repo, players...)
+	// when every pair of players plays many matches at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*concurrentUpdates*len(players)*len(players))
+	for i := 0; i < concurrentUpdates; i++ {
+		for _, winner := range players {
+			for _, loser := range players {
+				if winner == loser {
+					continue
+				}
+				wg.Add(1)
+				go func(winnerID, loserID domain.Key) {
+					defer wg.Done()
+					errs <- repo.RecordMatchResult(context.TODO(), winnerID, loserID, 1, 1)
+					// readers run at the same time as the writers
+					_, err := repo.FindAll(context.TODO(), byNamesDescending)
+					errs <- err
+				}(winner.ID, loser.ID)
+			}
+		}
+	}
+	wg.Wait()
+	close(errs)
+	// then every match is recorded
+	for err := range errs {
+		assertNoError(t, err)
+	}
+	matches := concurrentUpdates * (len(players) - 1)
+	for _, player := range players {
+		assertStatistics(t, repo, player.ID, matches, matches)
+	}
+}
+
+func testCancelledContext(t *testing.T, repo domain.PlayerRepository) {
+	// given a stored player and a cancelled context
+	player := domain.NewPlayer("Ma Long")
+	savePlayers(t, repo, player)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// when the repository is used with the cancelled context
+	// then every operation returns the error of the context
+	assertCancelled(t, "Save", repo.Save(ctx, domain.NewPlayer("Xu Xin")))
+	_, err := repo.FindByID(ctx, player.ID)
+	assertCancelled(t, "FindByID", err)
+	_, err = repo.FindAll(ctx, byNamesDescending)
+	assertCancelled(t, "FindAll", err)
+	assertCancelled(t, "UpdateWins", repo.UpdateWins(ctx, player.ID, 1))
+	assertCancelled(t, "UpdateDefeats", repo.UpdateDefeats(ctx, player.ID, 1))
+	assertCancelled(t, "RecordMatchResult", repo.RecordMatchResult(ctx, player.ID, player.ID, 1, 1))
+	renamed := *player
+	renamed.Names = "Xu Xin"
+	assertCancelled(t, "Update", repo.Update(ctx, &renamed))
+	assertCancelled(t, "Archive", repo.Archive(ctx, player.ID))
+	// and nothing changed
+	all := findAll(t, repo, domain.PlayerQuery{})
+	assertNames(t, all, "Ma Long")
+	assertStatistics(t, repo, player.ID, 0, 0)
+	if all[0].Archived {
+		t.Errorf("player must not be archived, but got: %+v", all[0])
+	}
+}
+
+func testTransactionCommit(t *testing.T, repo domain.PlayerRepository) {
+	// given two players
+	winner, loser := domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll")
+	savePlayers(t, repo, winner)
+	// when a player is stored and a match recorded in a transaction
+	err := domain.RunInTransaction(context.TODO(), repo, func(ctx context.Context) error {
+		if err := repo.Save(ctx, loser); err != nil {
+			return err
+		}
+		if err := repo.RecordMatchResult(ctx, winner.ID, loser.ID, 1, 1); err != nil {
+			return err
+		}
+		// the transaction reads its own changes
+		got, err := repo.FindByID(ctx, loser.ID)
+		if err == nil && got.Losses != 1 {
+			t.Errorf("the transaction must read its own changes, but got: %+v", got)
+		}
+		return err
+	})
+	// then every change is kept
+	assertNoError(t, err)
+	assertStatistics(t, repo, winner.ID, 1, 0)
+	assertStatistics(t, repo, loser.ID, 0, 1)
+}
+
+func testTransactionRollback(t *testing.T, repo domain.PlayerRepository) {
+	// given two players
+	winner, loser := domain.NewPlayer("Ma Long"), domain.NewPlayer("Timo Boll")
+	savePlayers(t, repo, winner, loser)
+	// when a transaction that stored a player and recorded a match fails
+	failure := errors.New("ratings cannot be updated")
+	err := domain.RunInTransaction(context.TODO(), repo, func(ctx context.Context) error {
+		if err := repo.Save(ctx, domain.NewPlayer("Xu Xin")); err != nil {
+			return err
+		}
+		if err := repo.RecordMatchResult(ctx, winner.ID, loser.ID, 1, 1); err != nil {
+			return err
+		}
+		return failure
+	})
+	// then no change is kept
+	if err != failure {
+		t.Fatalf("error %q was expected, but got: %v", failure, err)
+	}
+	all := findAll(t, repo, domain.PlayerQuery{})
+	assertNames(t, all, "Ma Long", "Timo Boll")
+	assertStatistics(t, repo, winner.ID, 0, 0)
+	assertStatistics(t, repo, loser.ID, 0, 0)
+	// and the repository can still be used
+	assertNoError(t, repo.RecordMatchResult(context.TODO(), winner.ID, loser.ID, 1, 1))
+	assertStatistics(t, repo, winner.ID, 1, 0)
+}
+
+func findAll(t *testing.T, repo domain.PlayerRepository, query domain.PlayerQuery) []domain.Player {
+	t.Helper()
+	page, err := repo.FindAll(context.TODO(), query)
+	assertNoError(t, err)
+	if page.Total != len(page.Players) && page.NextCursor == "" {
+		t.Errorf("total %d must be the number of players %d on a single page", page.Total, len(page.Players))
+	}
+	return page.Players
+}
+
+func search(t *testing.T, repo domain.PlayerRepository, text string, limit int) []domain.Player {
+	t.Helper()
+	results, err := repo.Search(context.TODO(), text, limit)
+	assertNoError(t, err)
+	players := make([]domain.Player, 0, len(results))
+	for _, result := range results {
+		players = append(players, result.Player)
+	}
+	return players
+}
+
+func savePlayers(t *testing.T, repo domain.PlayerRepository, players ...*domain.Player) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, player := range players {
+		assertNoError(t, repo.Save(ctx, player))
+	}
+}
+
+func assertStatistics(t *testing.T, repo domain.PlayerRepository, playerID domain.Key, wins, losses int) {
+	t.Helper()
+	got, err := repo.FindByID(context.TODO(), playerID)
+	assertNoError(t, err)
+	if got.Wins != wins || got.Losses != losses {
+		t.Errorf("%d wins and %d losses were expected, but got: %d wins and %d losses", wins, losses, got.Wins, got.Losses)
+	}
+}
+
+func assertVersion(t *testing.T, repo domain.PlayerRepository, playerID domain.Key, version int) {
+	t.Helper()
+	got, err := repo.FindByID(context.TODO(), playerID)
+	assertNoError(t, err)
+	if got.Version != version {
+		t.Errorf("version %d was expected, but got: %d", version, got.Version)
+	}
+}
+
+func assertNames(t *testing.T, players []domain.Player, names ...string) {
+	t.Helper()
+	want := make(map[string]int)
+	for _, name := range names {
+		want[name]++
+	}
+	for _, player := range players {
+		want[player.Names]--
+	}
+	for _, missing := range want {
+		if missing != 0 {
+			t.Errorf("players %v were expected, but got: %+v", names, players)
+			return
+		}
+	}
+}
+
+func assertOrder(t *testing.T, players []domain.Player, names ...string) {
+	t.Helper()
+	got := make([]string, 0, len(players))
+	for _, player := range players {
+		got = append(got, player.Names)
+	}
+	if strings.Join(got, ",") != strings.Join(names, ",") {
+		t.Errorf("players %v were expected, but got: %v", names, got)
+	}
+}
+
+func assertCancelled(t *testing.T, operation string, err error) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("%s must return the cancellation of the context, but got: %v", operation, err)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("error was not expected, but got: %s", err)
+	}
+}
@@ -0,0 +1,146 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultGamesToWin is the number of games needed to win a best of 5 match
+	DefaultGamesToWin = 3
+	// DefaultPointsToWinGame is the number of points needed to win a game
+	DefaultPointsToWinGame = 11
+	// servesInARow is the number of serves a player makes before the opponent serves
+	servesInARow = 2
+)
+
+// MatchFormat defines how many games and points are needed to win a match and when
+// the expedite system applies.
+type MatchFormat struct {
+	GamesToWin      int           `json:"gamesToWin"`      // games needed to win the match
+	PointsToWinGame int           `json:"pointsToWinGame"` // points needed to win a game, by two
+	ExpediteAfter   time.Duration `json:"expediteAfter"`   // game time before expediting, zero disables it
+}
+
+// GameScore contains the points every player won in a game.
+type GameScore struct {
+	Player1 int `json:"player1"`
+	Player2 int `json:"player2"`
+}
+
+// MatchScore contains the games every player won and the score of each game.
+type MatchScore struct {
+	Player1 int         `json:"player1"` // games won by player 1
+	Player2 int         `json:"player2"` // games won by player 2
+	Games   []GameScore `json:"games"`   // score of every game played
+}
+
+// DefaultMatchFormat returns a best of 5 match format with games to 11 points.
+func DefaultMatchFormat() MatchFormat {
+	return MatchFormat{
+		GamesToWin:      DefaultGamesToWin,
+		PointsToWinGame: DefaultPointsToWinGame,
+		ExpediteAfter:   DefaultExpediteAfter,
+	}
+}
+
+// ValidateMatchFormat checks that the given format can be played.
+func ValidateMatchFormat(format MatchFormat) (bool, error) {
+	var result []string
+	if format.GamesToWin < 1 {
+		result = append(result, "Match games to win must be greater than zero")
+	}
+	if format.PointsToWinGame < 1 {
+		result = append(result, "Match points to win a game must be greater than zero")
+	}
+	if format.ExpediteAfter < 0 {
+		result = append(result, "Match expedite time cannot be negative")
+	}
+	if len(result) > 0 {
+		strresult := strings.Join(result, "\n")
+		log.Debugf("match format %v is not valid, because: %s \n", format, strresult)
+		return false, errors.New(strresult)
+	}
+	return true, nil
+}
+
+// String returns the score of the match in games, e.g. "3-1".
+func (m MatchScore) String() string {
+	return fmt.Sprintf("%d-%d", m.Player1, m.Player2)
+}
+
+// scoreBoard keeps the score of a match and decides who serves next.
+type scoreBoard struct {
+	format        MatchFormat
+	score         MatchScore
+	game          GameScore
+	player1Starts bool // true if player 1 served first in the match
+	expedite      bool // true if the expedite system applies
+}
+
+func newScoreBoard(format MatchFormat, player1Starts bool) *scoreBoard {
+	return &scoreBoard{
+		format:        format,
+		player1Starts: player1Starts,
+	}
+}
+
+// finished returns true if any player won the needed games.
+func (s *scoreBoard) finished() bool {
+	return s.score.Player1 >= s.format.GamesToWin || s.score.Player2 >= s.format.GamesToWin
+}
+
+// player1Serves returns true if player 1 must serve the next point. The first server
+// alternates every game, the serve changes every two points and every point once both
+// players reach the deuce or the expedite system applies.
+func (s *scoreBoard) player1Serves() bool {
+	played := s.game.Player1 + s.game.Player2
+	deuce := 2 * (s.format.PointsToWinGame - 1)
+	turns := played / servesInARow
+	switch {
+	case s.expedite:
+		turns = played
+	case played >= deuce:
+		turns = deuce/servesInARow + played - deuce
+	}
+	gameStarter := s.player1Starts == (len(s.score.Games)%2 == 0)
+	return gameStarter == (turns%2 == 0)
+}
+
+// point adds a point to the given player and returns true if it finished the game.
+func (s *scoreBoard) point(player1 bool) bool {
+	if player1 {
+		s.game.Player1++
+	} else {
+		s.game.Player2++
+	}
+	lead := s.game.Player1 - s.game.Player2
+	switch {
+	case s.game.Player1 >= s.format.PointsToWinGame && lead >= 2:
+		s.score.Player1++
+	case s.game.Player2 >= s.format.PointsToWinGame && lead <= -2:
+		s.score.Player2++
+	default:
+		return false
+	}
+	s.score.Games = append(s.score.Games, s.game)
+	s.game = GameScore{}
+	return true
+}
+
+// startExpedite applies the expedite system for the rest of the match if the current
+// game lasted the time of the format, unless both players are close to win the game.
+// It returns true if the expedite system was applied now.
+func (s *scoreBoard) startExpedite(gameTime time.Duration) bool {
+	if s.expedite || s.format.ExpediteAfter <= 0 || gameTime < s.format.ExpediteAfter {
+		return false
+	}
+	closeToWin := s.format.PointsToWinGame - 2
+	if s.game.Player1 >= closeToWin && s.game.Player2 >= closeToWin {
+		return false
+	}
+	s.expedite = true
+	return true
+}
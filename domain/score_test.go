@@ -0,0 +1,41 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestMatchScore(t *testing.T) {
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	format := domain.DefaultMatchFormat()
+
+	got := domain.SimulateMatch(*player1, *player2)
+
+	if got.Score.Player1 != format.GamesToWin && got.Score.Player2 != format.GamesToWin {
+		t.Errorf("a player must win %d games, but the score was: %s", format.GamesToWin, got.Score)
+	}
+	if len(got.Score.Games) != got.Score.Player1+got.Score.Player2 {
+		t.Errorf("the match score %s doesn't match the games played: %+v", got.Score, got.Score.Games)
+	}
+	for _, game := range got.Score.Games {
+		high, low := game.Player1, game.Player2
+		if low > high {
+			high, low = low, high
+		}
+		if high < format.PointsToWinGame || high-low < 2 {
+			t.Errorf("a game must be won with %d points by two, but got: %d-%d", format.PointsToWinGame, game.Player1, game.Player2)
+		}
+		if high > format.PointsToWinGame && high-low != 2 {
+			t.Errorf("a game after deuce must be won by exactly two, but got: %d-%d", game.Player1, game.Player2)
+		}
+	}
+	winnerGames := got.Score.Player1
+	if got.Winner.ID == player2.ID {
+		winnerGames = got.Score.Player2
+	}
+	if winnerGames != format.GamesToWin {
+		t.Errorf("the winner %q must have won %d games, but the score was: %s", got.Winner.Names, format.GamesToWin, got.Score)
+	}
+}
@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StatisticsEntryKind tells how an entry of the statistics log changes the statistics.
+type StatisticsEntryKind string
+
+// Kinds of the entries of the statistics log.
+const (
+	// MatchResultEntry adds the wins to the winner and the losses to the loser of a match
+	MatchResultEntry StatisticsEntryKind = "match"
+	// BaselineEntry adds the wins and losses a player had when the log was empty, the
+	// statistics stored before the log was enabled
+	BaselineEntry StatisticsEntryKind = "baseline"
+)
+
+// StatisticsEntry is an entry of the statistics log, what changed the statistics of
+// the players and when.
+type StatisticsEntry struct {
+	Sequence uint64              `json:"sequence"`           // position in the log, starting at 1
+	Kind     StatisticsEntryKind `json:"kind"`               // how the entry changes the statistics
+	MatchID  Key                 `json:"matchID,omitempty"`  // match of a match result
+	WinnerID Key                 `json:"winnerID,omitempty"` // winner of a match result
+	LoserID  Key                 `json:"loserID,omitempty"`  // loser of a match result
+	PlayerID Key                 `json:"playerID,omitempty"` // player of a baseline
+	Wins     int                 `json:"wins"`               // wins added to the winner or the player
+	Losses   int                 `json:"losses"`             // losses added to the loser or the player
+	Recorded time.Time           `json:"recorded"`           // when it was appended to the log
+}
+
+// StatisticsLog is the append-only log of everything that changed the statistics of the
+// players, the wins and losses stored with the players are a projection of it.
+type StatisticsLog interface {
+	// Append adds the entry at the end of the log, setting its sequence and record date
+	Append(ctx context.Context, entry *StatisticsEntry) error
+	// Replay calls fn with every entry of the log in the order they were appended
+	Replay(ctx context.Context, fn func(entry StatisticsEntry) error) error
+}
+
+// Statistics are the wins and losses of a player.
+type Statistics struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+}
+
+// StatisticsProjection has the statistics of every player of the entries applied to it,
+// players without entries have no wins nor losses.
+type StatisticsProjection map[Key]Statistics
+
+// memoryStatisticsLog keeps the statistics log on memory.
+type memoryStatisticsLog struct {
+	mu      sync.Mutex
+	entries []StatisticsEntry
+}
+
+// NewMemoryStatisticsLog returns a statistics log on memory, it is lost when the service stops.
+func NewMemoryStatisticsLog() StatisticsLog {
+	return new(memoryStatisticsLog)
+}
+
+// IsStatisticsLogOnMemory tells if the statistics log is kept on memory, so it only has the
+// entries appended since the service started.
+func IsStatisticsLogOnMemory(statistics StatisticsLog) bool {
+	_, ok := statistics.(*memoryStatisticsLog)
+	return ok
+}
+
+// Append adds the entry at the end of the log.
+func (m *memoryStatisticsLog) Append(ctx context.Context, entry *StatisticsEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.Sequence = uint64(len(m.entries)) + 1
+	entry.Recorded = time.Now().UTC()
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+// Replay calls fn with the entries of the log, the ones appended while it runs are not
+// replayed.
+func (m *memoryStatisticsLog) Replay(ctx context.Context, fn func(entry StatisticsEntry) error) error {
+	m.mu.Lock()
+	entries := m.entries[:len(m.entries):len(m.entries)]
+	m.mu.Unlock()
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMatchResultEntry returns the entry of a match won by the winner, the winner adds
+// the wins and the loser adds the losses.
+func NewMatchResultEntry(matchID, winnerID, loserID Key, wins, losses int) *StatisticsEntry {
+	return &StatisticsEntry{
+		Kind:     MatchResultEntry,
+		MatchID:  matchID,
+		WinnerID: winnerID,
+		LoserID:  loserID,
+		Wins:     wins,
+		Losses:   losses,
+	}
+}
+
+// NewBaselineEntry returns the entry of the wins and losses the player had when the log
+// was empty.
+func NewBaselineEntry(playerID Key, wins, losses int) *StatisticsEntry {
+	return &StatisticsEntry{
+		Kind:     BaselineEntry,
+		PlayerID: playerID,
+		Wins:     wins,
+		Losses:   losses,
+	}
+}
+
+// Apply adds the wins and losses of a baseline entry to its player, and the wins of a
+// match result entry to its winner and the losses to its loser.
+func (p StatisticsProjection) Apply(entry StatisticsEntry) {
+	if entry.Kind == BaselineEntry {
+		player := p[entry.PlayerID]
+		player.Wins += entry.Wins
+		player.Losses += entry.Losses
+		p[entry.PlayerID] = player
+		return
+	}
+	if entry.WinnerID != "" {
+		winner := p[entry.WinnerID]
+		winner.Wins += entry.Wins
+		p[entry.WinnerID] = winner
+	}
+	if entry.LoserID != "" {
+		loser := p[entry.LoserID]
+		loser.Losses += entry.Losses
+		p[entry.LoserID] = loser
+	}
+}
+
+// ProjectStatistics replays the whole log and returns the statistics of every player.
+func ProjectStatistics(ctx context.Context, statistics StatisticsLog) (StatisticsProjection, error) {
+	projection := make(StatisticsProjection)
+	err := statistics.Replay(ctx, func(entry StatisticsEntry) error {
+		projection.Apply(entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return projection, nil
+}
@@ -0,0 +1,48 @@
+package domain_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestProjectStatistics(t *testing.T) {
+	// given a log with the baseline of a player and matches
+	statistics := domain.NewMemoryStatisticsLog()
+	malong, fan := domain.NewPlayer("Ma Long"), domain.NewPlayer("Fan Zhendong")
+	malong.ID, fan.ID = "malong", "fan"
+	entries := []*domain.StatisticsEntry{
+		domain.NewBaselineEntry(malong.ID, 10, 3),
+		domain.NewMatchResultEntry("match1", malong.ID, fan.ID, 1, 1),
+		domain.NewMatchResultEntry("match2", fan.ID, malong.ID, 1, 1),
+		domain.NewMatchResultEntry("match3", fan.ID, malong.ID, 1, 1),
+	}
+	for _, entry := range entries {
+		if err := statistics.Append(context.TODO(), entry); err != nil {
+			t.Fatalf("entry %+v cannot be appended: %s", entry, err)
+		}
+	}
+
+	// when the statistics are projected
+	got, err := domain.ProjectStatistics(context.TODO(), statistics)
+
+	// then every player has the wins and losses of its baseline and its matches
+	if err != nil {
+		t.Fatalf("statistics cannot be projected: %s", err)
+	}
+	want := domain.StatisticsProjection{
+		malong.ID: {Wins: 11, Losses: 5},
+		fan.ID:    {Wins: 2, Losses: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("projection %+v was expected, but got: %+v", want, got)
+	}
+	// and the entries are in sequence
+	for i, entry := range entries {
+		if entry.Sequence != uint64(i+1) || entry.Recorded.IsZero() {
+			t.Errorf("entry %d was expected with its record date, but got: %+v", i+1, entry)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package domain
+
+import "fmt"
+
+// PlayingStyle defines the way a player plays the game.
+type PlayingStyle string
+
+// Handedness defines the hand a player uses to hold the racket.
+type Handedness string
+
+// Grip defines how a player holds the racket.
+type Grip string
+
+const (
+	// OffensiveLooper attacks with heavy topspin loops from both wings
+	OffensiveLooper PlayingStyle = "looper"
+	// PenholdAttacker attacks close to the table with a penhold grip
+	PenholdAttacker PlayingStyle = "penhold-attacker"
+	// Chopper defends far from the table with backspin chops
+	Chopper PlayingStyle = "chopper"
+	// AllRounder mixes attack and defense
+	AllRounder PlayingStyle = "all-rounder"
+
+	// RightHanded players hold the racket with the right hand
+	RightHanded Handedness = "right"
+	// LeftHanded players hold the racket with the left hand
+	LeftHanded Handedness = "left"
+
+	// ShakehandGrip holds the racket like a handshake
+	ShakehandGrip Grip = "shakehand"
+	// PenholdGrip holds the racket like a pen
+	PenholdGrip Grip = "penhold"
+
+	// OppositeHandRisk is the extra error risk, in per mille, of facing a player
+	// with a different handedness
+	OppositeHandRisk = 1
+)
+
+// PlayerProfile groups the playing style, handedness and grip of a player.
+// Empty values mean the profile attribute is unknown.
+type PlayerProfile struct {
+	Style      PlayingStyle `json:"style,omitempty"`      // playing style
+	Handedness Handedness   `json:"handedness,omitempty"` // racket hand
+	Grip       Grip         `json:"grip,omitempty"`       // racket grip
+}
+
+// matchupMatrix contains the extra error risk, in per mille, that a player with the
+// style of the first key has when facing a player with the style of the second key.
+// Negative values mean the matchup favors the player.
+var matchupMatrix = map[PlayingStyle]map[PlayingStyle]int{
+	OffensiveLooper: {
+		PenholdAttacker: 1,
+		Chopper:         4,
+		AllRounder:      -1,
+	},
+	PenholdAttacker: {
+		OffensiveLooper: -1,
+		Chopper:         2,
+		AllRounder:      -2,
+	},
+	Chopper: {
+		OffensiveLooper: -3,
+		PenholdAttacker: -1,
+		AllRounder:      1,
+	},
+	AllRounder: {
+		OffensiveLooper: 1,
+		PenholdAttacker: 2,
+		Chopper:         -1,
+	},
+}
+
+// MatchupRisk returns the extra error risk, in per mille, that the given player has
+// on every shot because of the profile of the opponent.
+func MatchupRisk(player, opponent PlayerProfile) int {
+	risk := matchupMatrix[player.Style][opponent.Style]
+	if player.Handedness != "" && opponent.Handedness != "" &&
+		player.Handedness != opponent.Handedness {
+		risk += OppositeHandRisk
+	}
+	return risk
+}
+
+// Matches checks if the given profile matches every not empty attribute of this one.
+func (p PlayerProfile) Matches(profile PlayerProfile) bool {
+	if p.Style != "" && p.Style != profile.Style {
+		return false
+	}
+	if p.Handedness != "" && p.Handedness != profile.Handedness {
+		return false
+	}
+	if p.Grip != "" && p.Grip != profile.Grip {
+		return false
+	}
+	return true
+}
+
+// validate returns the reasons why the profile is not valid.
+func (p PlayerProfile) validate() []string {
+	var result []string
+	switch p.Style {
+	case "", OffensiveLooper, PenholdAttacker, Chopper, AllRounder:
+	default:
+		result = append(result, fmt.Sprintf("Player style %q is not valid", p.Style))
+	}
+	switch p.Handedness {
+	case "", RightHanded, LeftHanded:
+	default:
+		result = append(result, fmt.Sprintf("Player handedness %q is not valid", p.Handedness))
+	}
+	switch p.Grip {
+	case "", ShakehandGrip, PenholdGrip:
+	default:
+		result = append(result, fmt.Sprintf("Player grip %q is not valid", p.Grip))
+	}
+	if p.Style == PenholdAttacker && p.Grip == ShakehandGrip {
+		result = append(result, "Player with penhold-attacker style must use a penhold grip")
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestMatchupRisk(t *testing.T) {
+	looper := domain.PlayerProfile{Style: domain.OffensiveLooper, Handedness: domain.RightHanded}
+	chopper := domain.PlayerProfile{Style: domain.Chopper, Handedness: domain.RightHanded}
+	leftyChopper := domain.PlayerProfile{Style: domain.Chopper, Handedness: domain.LeftHanded}
+
+	if got := domain.MatchupRisk(looper, chopper); got <= 0 {
+		t.Errorf("a chopper must trouble a looper, but the looper risk was: %d", got)
+	}
+	if got := domain.MatchupRisk(chopper, looper); got >= 0 {
+		t.Errorf("a chopper must be favored against a looper, but the chopper risk was: %d", got)
+	}
+	if got, want := domain.MatchupRisk(looper, leftyChopper), domain.MatchupRisk(looper, chopper)+domain.OppositeHandRisk; got != want {
+		t.Errorf("facing a left handed player must add the opposite hand risk, expected: %d, but got: %d", want, got)
+	}
+	if got := domain.MatchupRisk(domain.PlayerProfile{}, chopper); got != 0 {
+		t.Errorf("a player without profile must not have matchup risk, but got: %d", got)
+	}
+}
+
+func TestProfileMatches(t *testing.T) {
+	profile := domain.PlayerProfile{Style: domain.PenholdAttacker, Handedness: domain.RightHanded, Grip: domain.PenholdGrip}
+	tests := []struct {
+		filter domain.PlayerProfile
+		want   bool
+	}{
+		{domain.PlayerProfile{}, true},
+		{domain.PlayerProfile{Style: domain.PenholdAttacker}, true},
+		{domain.PlayerProfile{Style: domain.PenholdAttacker, Grip: domain.PenholdGrip}, true},
+		{domain.PlayerProfile{Handedness: domain.LeftHanded}, false},
+		{domain.PlayerProfile{Style: domain.Chopper, Grip: domain.PenholdGrip}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(profile); got != tt.want {
+			t.Errorf("filter %+v on profile %+v expects [%t], but got [%t]", tt.filter, profile, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+const (
+	// MinAggression is the lowest aggression level a manager can choose
+	MinAggression = 1
+	// MaxAggression is the highest aggression level a manager can choose
+	MaxAggression = 5
+	// DefaultAggression is a balanced aggression level
+	DefaultAggression = 3
+)
+
+// ServeType defines the kind of serve a player prefers.
+type ServeType string
+
+// DefenseStyle defines how a player answers an attacking ball.
+type DefenseStyle string
+
+// LongBallStyle defines how a player returns a long ball.
+type LongBallStyle string
+
+const (
+	// ShortServe keeps the ball short so the receiver cannot attack it
+	ShortServe ServeType = "short"
+	// LongServe pushes the receiver away from the table
+	LongServe ServeType = "long"
+	// FastServe is a risky serve looking for a direct point
+	FastServe ServeType = "fast"
+	// SpinServe loads the ball with spin to force a weak return
+	SpinServe ServeType = "spin"
+
+	// CounterAttack answers an attacking ball with another attack
+	CounterAttack DefenseStyle = "counter"
+	// Block answers an attacking ball with a safe block
+	Block DefenseStyle = "block"
+
+	// PushLongBall returns long balls with a safe push
+	PushLongBall LongBallStyle = "push"
+	// LoopLongBall returns long balls with a topspin loop
+	LoopLongBall LongBallStyle = "loop"
+)
+
+// Tactics models the pre-match instructions a manager gives to a player.
+type Tactics struct {
+	Aggression int           `json:"aggression"` // from MinAggression to MaxAggression
+	Serve      ServeType     `json:"serve"`      // preferred serve type
+	Defense    DefenseStyle  `json:"defense"`    // counter-attack or block
+	LongBalls  LongBallStyle `json:"longBalls"`  // push or loop long balls
+}
+
+// TacticEffect contains how effective a single tactic was during the match.
+type TacticEffect struct {
+	Tactic     string `json:"tactic"`     // tactic label, e.g. "serve:spin"
+	Used       int    `json:"used"`       // times the tactic was applied
+	PointsWon  int    `json:"pointsWon"`  // points decided in favor after applying it
+	PointsLost int    `json:"pointsLost"` // points decided against after applying it
+}
+
+// TacticsReport groups the tactics of a player and how effective they were.
+type TacticsReport struct {
+	PlayerID Key            `json:"playerID"`
+	Tactics  Tactics        `json:"tactics"`
+	Effects  []TacticEffect `json:"effects"`
+}
+
+// DefaultTactics returns balanced tactics used when a manager does not submit any.
+func DefaultTactics() Tactics {
+	return Tactics{
+		Aggression: DefaultAggression,
+		Serve:      ShortServe,
+		Defense:    Block,
+		LongBalls:  PushLongBall,
+	}
+}
+
+// ValidateTactics checks that the given tactics contain known values.
+func ValidateTactics(tactics Tactics) (bool, error) {
+	var result []string
+	log.Debugf("validating tactics %v", tactics)
+	if tactics.Aggression < MinAggression || tactics.Aggression > MaxAggression {
+		result = append(result, fmt.Sprintf("Tactics aggression must be between %d and %d", MinAggression, MaxAggression))
+	}
+	switch tactics.Serve {
+	case ShortServe, LongServe, FastServe, SpinServe:
+	default:
+		result = append(result, fmt.Sprintf("Tactics serve %q is not valid", tactics.Serve))
+	}
+	switch tactics.Defense {
+	case CounterAttack, Block:
+	default:
+		result = append(result, fmt.Sprintf("Tactics defense %q is not valid", tactics.Defense))
+	}
+	switch tactics.LongBalls {
+	case PushLongBall, LoopLongBall:
+	default:
+		result = append(result, fmt.Sprintf("Tactics long balls %q is not valid", tactics.LongBalls))
+	}
+
+	if len(result) > 0 {
+		strresult := strings.Join(result, "\n")
+		log.Debugf("tactics %v are not valid, because: %s \n", tactics, strresult)
+		return false, errors.New(strresult)
+	}
+	return true, nil
+}
+
+// serveRisk returns the error risk, in per mille, that a serve adds to the server
+// and to the receiver.
+func (t Tactics) serveRisk() (own, receiver int) {
+	switch t.Serve {
+	case LongServe:
+		return 0, 2
+	case FastServe:
+		return 6, 9
+	case SpinServe:
+		return 2, 6
+	default:
+		return 0, 1
+	}
+}
+
+// aggressionRisk returns the error risk, in per mille, that the aggression level adds
+// to the hitter and the pressure it puts on the opponent.
+func (t Tactics) aggressionRisk() (own, pressure int) {
+	delta := t.Aggression - DefaultAggression
+	return delta * 3, delta * 4
+}
+
+// defenseRisk returns the error risk, in per mille, of answering the given pressure and
+// the pressure sent back to the opponent.
+func (t Tactics) defenseRisk(incoming int) (own, pressure int) {
+	if t.Defense == CounterAttack {
+		return incoming + 2, 6
+	}
+	return incoming / 2, 0
+}
+
+// longBallRisk returns the error risk, in per mille, of returning a long ball and the
+// pressure sent back to the opponent.
+func (t Tactics) longBallRisk() (own, pressure int) {
+	if t.LongBalls == LoopLongBall {
+		return 3, 6
+	}
+	return -2, -2
+}
+
+// tactic kinds tracked during a match, they are used as bits of ball.tactics
+const (
+	serveTactic = iota
+	defenseTactic
+	longBallsTactic
+	aggressionTactic
+	tacticKinds
+)
+
+// tacticsTracker accumulates how many times each tactic was used by a player.
+type tacticsTracker struct {
+	playerID Key
+	tactics  Tactics
+	matchup  int                       // extra error risk, in per mille, against the opponent profile and rating
+	referee  *rand.Rand                // random generator shared by both players of the match
+	effects  [tacticKinds]TacticEffect // effects by tactic kind
+	order    []int                     // tactic kinds in the order they were first used
+}
+
+func newTacticsTracker(playerID Key, tactics Tactics, referee *rand.Rand) *tacticsTracker {
+	tracker := &tacticsTracker{
+		playerID: playerID,
+		tactics:  tactics,
+		referee:  referee,
+		order:    make([]int, 0, tacticKinds),
+	}
+	tracker.effects[serveTactic].Tactic = fmt.Sprintf("serve:%s", tactics.Serve)
+	tracker.effects[defenseTactic].Tactic = fmt.Sprintf("defense:%s", tactics.Defense)
+	tracker.effects[longBallsTactic].Tactic = fmt.Sprintf("longBalls:%s", tactics.LongBalls)
+	tracker.effects[aggressionTactic].Tactic = fmt.Sprintf("aggression:%d", tactics.Aggression)
+	return tracker
+}
+
+// use records that the given tactic kind was applied in the current shot.
+func (t *tacticsTracker) use(kind int) {
+	if t.effects[kind].Used == 0 {
+		t.order = append(t.order, kind)
+	}
+	t.effects[kind].Used++
+}
+
+// decide credits the tactic kinds in the given bits with the outcome of the point.
+func (t *tacticsTracker) decide(kinds uint8, won bool) {
+	for kind := 0; kind < tacticKinds; kind++ {
+		if kinds&(1<<kind) == 0 || t.effects[kind].Used == 0 {
+			continue
+		}
+		if won {
+			t.effects[kind].PointsWon++
+			continue
+		}
+		t.effects[kind].PointsLost++
+	}
+}
+
+// report builds the tactics report keeping the order in which tactics were first used.
+func (t *tacticsTracker) report() TacticsReport {
+	effects := make([]TacticEffect, 0, len(t.order))
+	for _, kind := range t.order {
+		effects = append(effects, t.effects[kind])
+	}
+	return TacticsReport{
+		PlayerID: t.playerID,
+		Tactics:  t.tactics,
+		Effects:  effects,
+	}
+}
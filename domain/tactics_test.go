@@ -0,0 +1,90 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+func TestValidateTactics(t *testing.T) {
+	tests := []struct {
+		name    string
+		tactics domain.Tactics
+		result  bool
+		err     string
+	}{
+		{
+			name:    "default tactics",
+			tactics: domain.DefaultTactics(),
+			result:  true,
+		},
+		{
+			name:    "aggressive tactics",
+			tactics: domain.Tactics{Aggression: 5, Serve: domain.FastServe, Defense: domain.CounterAttack, LongBalls: domain.LoopLongBall},
+			result:  true,
+		},
+		{
+			name:    "aggression out of range",
+			tactics: domain.Tactics{Aggression: 6, Serve: domain.ShortServe, Defense: domain.Block, LongBalls: domain.PushLongBall},
+			result:  false,
+			err:     "Tactics aggression must be between 1 and 5",
+		},
+		{
+			name:    "unknown styles",
+			tactics: domain.Tactics{Aggression: 1, Serve: "lob", Defense: "run", LongBalls: "flick"},
+			result:  false,
+			err:     "Tactics serve \"lob\" is not valid\nTactics defense \"run\" is not valid\nTactics long balls \"flick\" is not valid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := domain.ValidateTactics(tt.tactics)
+			if ok != tt.result {
+				t.Fatalf("Given tactics [%+v], it expects [%t], but it got [%t]", tt.tactics, tt.result, ok)
+			}
+			if !ok && err.Error() != tt.err {
+				t.Errorf("Given tactics [%+v], it expects [%s], but it got [%s]", tt.tactics, tt.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestSimulateMatchWithTactics(t *testing.T) {
+	player1 := domain.NewPlayer("Wang Hao")
+	player2 := domain.NewPlayer("Zhang Jike")
+	tactics1 := domain.Tactics{Aggression: 5, Serve: domain.SpinServe, Defense: domain.CounterAttack, LongBalls: domain.LoopLongBall}
+	tactics2 := domain.Tactics{Aggression: 1, Serve: domain.LongServe, Defense: domain.Block, LongBalls: domain.PushLongBall}
+
+	got := domain.SimulateMatchWithTactics(*player1, *player2, tactics1, tactics2)
+
+	if got.Winner == nil || got.Loser == nil {
+		t.Fatalf("a winner and a loser were expected, but got winner: %v and loser: %v", got.Winner, got.Loser)
+	}
+	if len(got.Tactics) != 2 {
+		t.Fatalf("a tactics report for each player was expected, but got: %+v", got.Tactics)
+	}
+	if got.Tactics[0].PlayerID != player1.ID || got.Tactics[0].Tactics != tactics1 {
+		t.Errorf("the first tactics report must belong to player %q with tactics %+v, but got: %+v",
+			player1.ID, tactics1, got.Tactics[0])
+	}
+	if got.Tactics[1].PlayerID != player2.ID || got.Tactics[1].Tactics != tactics2 {
+		t.Errorf("the second tactics report must belong to player %q with tactics %+v, but got: %+v",
+			player2.ID, tactics2, got.Tactics[1])
+	}
+	var won, lost int
+	for _, report := range got.Tactics {
+		for _, effect := range report.Effects {
+			if effect.Used == 0 {
+				t.Errorf("tactic %q is in the report but it was never used", effect.Tactic)
+			}
+			won += effect.PointsWon
+			lost += effect.PointsLost
+		}
+	}
+	if lost == 0 {
+		t.Errorf("the decisive point must be credited against the tactics of the loser, but got: %+v", got.Tactics)
+	}
+	if len(got.Narrative) > 2 && won == 0 {
+		t.Errorf("the decisive point must be credited to the tactics of the winner, but got: %+v", got.Tactics)
+	}
+}
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+)
+
+// Transaction groups the changes made by repositories, they are applied together
+// when it is committed and discarded when it is rolled back.
+type Transaction interface {
+	// Commit applies the changes of the transaction
+	Commit() error
+	// Rollback discards the changes of the transaction
+	Rollback() error
+}
+
+// Transactor begins the transactions of a storage backend. Repositories of that backend
+// make their changes inside the transaction carried by the context they receive.
+type Transactor interface {
+	// Begin starts a new transaction
+	Begin(ctx context.Context) (Transaction, error)
+}
+
+// unitOfWorkKey is the key of the unit of work in a context
+type unitOfWorkKey struct{}
+
+// unitOfWork contains a transaction and what must be done right before and once it is
+// committed.
+type unitOfWork struct {
+	tx           Transaction
+	beforeCommit []func() error
+	afterCommit  []func()
+}
+
+// noTransactor begins transactions that do nothing, for storages without them.
+type noTransactor struct{}
+
+// noTransaction is a transaction that does nothing.
+type noTransaction struct{}
+
+// NoTransactor returns a transactor whose transactions do nothing, every change is
+// applied as soon as it is made.
+func NoTransactor() Transactor {
+	return noTransactor{}
+}
+
+// Begin returns a transaction that does nothing.
+func (noTransactor) Begin(ctx context.Context) (Transaction, error) {
+	return noTransaction{}, nil
+}
+
+// Commit does nothing.
+func (noTransaction) Commit() error { return nil }
+
+// Rollback does nothing.
+func (noTransaction) Rollback() error { return nil }
+
+// TransactionFrom returns the transaction carried by the given context.
+func TransactionFrom(ctx context.Context) (Transaction, bool) {
+	work, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork)
+	if !ok {
+		return nil, false
+	}
+	return work.tx, true
+}
+
+// RunInTransaction calls fn with a context carrying a new transaction, which is
+// committed if fn succeeds and rolled back if it fails or panics. If the context
+// already carries a transaction fn joins it.
+func RunInTransaction(ctx context.Context, transactor Transactor, fn func(ctx context.Context) error) (err error) {
+	if _, ok := TransactionFrom(ctx); ok {
+		return fn(ctx)
+	}
+	tx, err := transactor.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("transaction cannot begin: %w", err)
+	}
+	work := &unitOfWork{tx: tx}
+	defer func() {
+		if r := recover(); r != nil {
+			rollback(tx)
+			panic(r)
+		}
+	}()
+	if err := fn(context.WithValue(ctx, unitOfWorkKey{}, work)); err != nil {
+		rollback(tx)
+		return err
+	}
+	for _, fn := range work.beforeCommit {
+		if err := fn(); err != nil {
+			rollback(tx)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("transaction cannot be committed: %s", err)
+		return fmt.Errorf("transaction cannot be committed: %w", err)
+	}
+	for _, fn := range work.afterCommit {
+		fn()
+	}
+	return nil
+}
+
+// BeforeCommit calls fn once every change of the transaction carried by the context was
+// made, right before it is committed and while it still holds what it changed, so the
+// functions of transactions that change the same data are called in the order they are
+// committed. The transaction is rolled back if fn fails. Without transaction fn is called
+// right away and its error is returned.
+func BeforeCommit(ctx context.Context, fn func() error) error {
+	work, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork)
+	if !ok {
+		return fn()
+	}
+	work.beforeCommit = append(work.beforeCommit, fn)
+	return nil
+}
+
+// AfterCommit calls fn once the transaction carried by the context is committed, it
+// is not called if the transaction is rolled back. Without transaction fn is called
+// right away.
+func AfterCommit(ctx context.Context, fn func()) {
+	work, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork)
+	if !ok {
+		fn()
+		return
+	}
+	work.afterCommit = append(work.afterCommit, fn)
+}
+
+// rollback rolls back the given transaction, its error is only logged because the
+// error that caused it is more relevant.
+func rollback(tx Transaction) {
+	if err := tx.Rollback(); err != nil {
+		log.Errorf("transaction cannot be rolled back: %s", err)
+	}
+}
@@ -0,0 +1,133 @@
+package domain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// recordingTransactor records what happens to its transactions.
+type recordingTransactor struct {
+	calls []string
+}
+
+func (r *recordingTransactor) Begin(ctx context.Context) (domain.Transaction, error) {
+	r.calls = append(r.calls, "begin")
+	return recordingTransaction{r}, nil
+}
+
+type recordingTransaction struct {
+	transactor *recordingTransactor
+}
+
+func (r recordingTransaction) Commit() error {
+	r.transactor.calls = append(r.transactor.calls, "commit")
+	return nil
+}
+
+func (r recordingTransaction) Rollback() error {
+	r.transactor.calls = append(r.transactor.calls, "rollback")
+	return nil
+}
+
+func TestRunInTransaction(t *testing.T) {
+	t.Run("commit", func(t *testing.T) {
+		// given
+		transactor := new(recordingTransactor)
+		// when
+		err := domain.RunInTransaction(context.TODO(), transactor, func(ctx context.Context) error {
+			if _, ok := domain.TransactionFrom(ctx); !ok {
+				t.Errorf("the context must carry the transaction")
+			}
+			domain.AfterCommit(ctx, func() { transactor.calls = append(transactor.calls, "after commit") })
+			// nested calls join the transaction
+			return domain.RunInTransaction(ctx, transactor, func(ctx context.Context) error {
+				return domain.BeforeCommit(ctx, func() error {
+					transactor.calls = append(transactor.calls, "before commit")
+					return nil
+				})
+			})
+		})
+		// then
+		if err != nil {
+			t.Fatalf("error was not expected, but: %s", err)
+		}
+		assertCalls(t, transactor.calls, "begin", "before commit", "commit", "after commit")
+	})
+	t.Run("failure before commit", func(t *testing.T) {
+		// given
+		transactor := new(recordingTransactor)
+		failure := errors.New("statistics log is full")
+		// when
+		err := domain.RunInTransaction(context.TODO(), transactor, func(ctx context.Context) error {
+			domain.AfterCommit(ctx, func() { transactor.calls = append(transactor.calls, "after commit") })
+			return domain.BeforeCommit(ctx, func() error { return failure })
+		})
+		// then
+		if err != failure {
+			t.Errorf("error %q was expected, but got: %v", failure, err)
+		}
+		assertCalls(t, transactor.calls, "begin", "rollback")
+	})
+	t.Run("rollback", func(t *testing.T) {
+		// given
+		transactor := new(recordingTransactor)
+		failure := errors.New("ratings are broken")
+		// when
+		err := domain.RunInTransaction(context.TODO(), transactor, func(ctx context.Context) error {
+			domain.AfterCommit(ctx, func() { transactor.calls = append(transactor.calls, "after commit") })
+			return failure
+		})
+		// then
+		if err != failure {
+			t.Errorf("error %q was expected, but got: %v", failure, err)
+		}
+		assertCalls(t, transactor.calls, "begin", "rollback")
+	})
+	t.Run("panic", func(t *testing.T) {
+		// given
+		transactor := new(recordingTransactor)
+		// when
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("the panic must go on after the rollback")
+				}
+			}()
+			domain.RunInTransaction(context.TODO(), transactor, func(ctx context.Context) error {
+				panic("ratings are broken")
+			})
+		}()
+		// then
+		assertCalls(t, transactor.calls, "begin", "rollback")
+	})
+}
+
+func TestAfterCommitWithoutTransaction(t *testing.T) {
+	var called bool
+	domain.AfterCommit(context.TODO(), func() { called = true })
+	if !called {
+		t.Errorf("without transaction the function must be called right away")
+	}
+}
+
+func TestBeforeCommitWithoutTransaction(t *testing.T) {
+	failure := errors.New("statistics log is full")
+	if err := domain.BeforeCommit(context.TODO(), func() error { return failure }); err != failure {
+		t.Errorf("without transaction the function must be called right away, but got: %v", err)
+	}
+}
+
+func assertCalls(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("calls %v were expected, but got: %v", want, got)
+	}
+	for index := range want {
+		if got[index] != want[index] {
+			t.Fatalf("calls %v were expected, but got: %v", want, got)
+		}
+	}
+}
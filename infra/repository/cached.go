@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// CacheStats counts how the cache of players was used.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`      // players found in the cache
+	Misses    uint64 `json:"misses"`    // players read from the repository, because they were not cached or expired
+	Evictions uint64 `json:"evictions"` // players removed to make room for others
+	Size      int    `json:"size"`      // players in the cache now
+}
+
+// CachedPlayerRepository decorates a PlayerRepository keeping the players found by id in
+// memory, the least recently used ones are evicted when it is full and every cached player
+// is read again once its time to live is over. Any change of a player removes it from the
+// cache, so it is read again the next time.
+type CachedPlayerRepository struct {
+	domain.PlayerRepository
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	entries    map[domain.Key]*list.Element
+	recent     *list.List // cached players, the most recently used first
+	generation uint64     // it increases with every change, so players read before it are not cached
+	stats      CacheStats
+}
+
+// cacheEntry is a player in the cache.
+type cacheEntry struct {
+	player  domain.Player
+	expires time.Time
+}
+
+// NewCachedPlayerRepository wraps the given repository with a cache of size players that
+// are kept for ttl at most.
+func NewCachedPlayerRepository(repository domain.PlayerRepository, size int, ttl time.Duration) *CachedPlayerRepository {
+	log.Infof("creating cache of %d players with time to live %s", size, ttl)
+	return &CachedPlayerRepository{
+		PlayerRepository: repository,
+		size:             size,
+		ttl:              ttl,
+		entries:          make(map[domain.Key]*list.Element, size),
+		recent:           list.New(),
+	}
+}
+
+// FindByID returns the cached player with the given id or reads it from the repository.
+// Inside a transaction it is always read from the repository, so the changes of the
+// transaction are seen.
+func (c *CachedPlayerRepository) FindByID(ctx context.Context, id domain.Key) (domain.Player, error) {
+	if _, ok := domain.TransactionFrom(ctx); ok {
+		return c.PlayerRepository.FindByID(ctx, id)
+	}
+	player, ok, generation := c.get(id)
+	if ok {
+		return player, nil
+	}
+	player, err := c.PlayerRepository.FindByID(ctx, id)
+	if err != nil {
+		return domain.Player{}, err
+	}
+	if player.ID != "" {
+		c.put(player, generation)
+	}
+	return player, nil
+}
+
+// Save the given player, it is cached once it is found.
+func (c *CachedPlayerRepository) Save(ctx context.Context, player *domain.Player) error {
+	if err := c.PlayerRepository.Save(ctx, player); err != nil {
+		return err
+	}
+	c.invalidate(ctx, player.ID)
+	return nil
+}
+
+// UpdateWins increases the value on field wins
+func (c *CachedPlayerRepository) UpdateWins(ctx context.Context, playerID domain.Key, wins int) error {
+	if err := c.PlayerRepository.UpdateWins(ctx, playerID, wins); err != nil {
+		return err
+	}
+	c.invalidate(ctx, playerID)
+	return nil
+}
+
+// UpdateDefeats increases the value on field loses
+func (c *CachedPlayerRepository) UpdateDefeats(ctx context.Context, playerID domain.Key, defeats int) error {
+	if err := c.PlayerRepository.UpdateDefeats(ctx, playerID, defeats); err != nil {
+		return err
+	}
+	c.invalidate(ctx, playerID)
+	return nil
+}
+
+// RecordMatchResult increases the wins of the winner and the losses of the loser.
+func (c *CachedPlayerRepository) RecordMatchResult(ctx context.Context, winnerID, loserID domain.Key, wins, losses int) error {
+	if err := c.PlayerRepository.RecordMatchResult(ctx, winnerID, loserID, wins, losses); err != nil {
+		return err
+	}
+	c.invalidate(ctx, winnerID, loserID)
+	return nil
+}
+
+// Update replaces the stored player with the given one.
+func (c *CachedPlayerRepository) Update(ctx context.Context, player *domain.Player) error {
+	if err := c.PlayerRepository.Update(ctx, player); err != nil {
+		return err
+	}
+	c.invalidate(ctx, player.ID)
+	return nil
+}
+
+// Archive marks the player with the given id as archived.
+func (c *CachedPlayerRepository) Archive(ctx context.Context, id domain.Key) error {
+	if err := c.PlayerRepository.Archive(ctx, id); err != nil {
+		return err
+	}
+	c.invalidate(ctx, id)
+	return nil
+}
+
+// Stats returns how the cache was used so far.
+func (c *CachedPlayerRepository) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := c.stats
+	result.Size = c.recent.Len()
+	return result
+}
+
+// Close closes the decorated repository if it can be closed.
+func (c *CachedPlayerRepository) Close() error {
+	if closer, ok := c.PlayerRepository.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// get returns the cached player with the given id if it didn't expire and the current
+// generation, the one a player read from the repository is cached with.
+func (c *CachedPlayerRepository) get(id domain.Key) (domain.Player, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[id]
+	if !ok {
+		c.stats.Misses++
+		return domain.Player{}, false, c.generation
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		c.stats.Misses++
+		return domain.Player{}, false, c.generation
+	}
+	c.recent.MoveToFront(element)
+	c.stats.Hits++
+	return entry.player, true, c.generation
+}
+
+// put caches the given player unless something changed since the given generation,
+// because the player may be older than the stored one then.
+func (c *CachedPlayerRepository) put(player domain.Player, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation || c.size <= 0 {
+		return
+	}
+	entry := &cacheEntry{player: player, expires: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[player.ID]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.entries[player.ID] = c.recent.PushFront(entry)
+	for c.recent.Len() > c.size {
+		c.remove(c.recent.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate removes the players with the given ids from the cache, once more when the
+// transaction of the context is committed because other goroutines may cache them in
+// between from the data before the transaction.
+func (c *CachedPlayerRepository) invalidate(ctx context.Context, ids ...domain.Key) {
+	c.forget(ids...)
+	if _, ok := domain.TransactionFrom(ctx); ok {
+		domain.AfterCommit(ctx, func() { c.forget(ids...) })
+	}
+}
+
+// forget removes the players with the given ids from the cache and starts a new generation.
+func (c *CachedPlayerRepository) forget(ids ...domain.Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, id := range ids {
+		if element, ok := c.entries[id]; ok {
+			c.remove(element)
+		}
+	}
+}
+
+// remove removes the given element from the cache, the caller holds the lock.
+func (c *CachedPlayerRepository) remove(element *list.Element) {
+	c.recent.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).player.ID)
+}
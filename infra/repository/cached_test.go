@@ -0,0 +1,128 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+	"github.com/pkg/errors"
+)
+
+func TestCacheHitsAndMisses(t *testing.T) {
+	// given a cached player
+	cache := repository.NewCachedPlayerRepository(repository.NewPlayerRepositoryOnMemory(5), 10, time.Minute)
+	player := domain.NewPlayer("Ma Long")
+	saveAPlayer(t, cache, player)
+	findPlayer(t, cache, player.ID)
+	// when it is found again
+	got := findPlayer(t, cache, player.ID)
+	// then it comes from the cache
+	if got.Names != player.Names {
+		t.Errorf("player %+v was expected, but got: %+v", player, got)
+	}
+	assertCacheStats(t, cache, repository.CacheStats{Hits: 1, Misses: 1, Size: 1})
+	// and missing players are not cached
+	findPlayer(t, cache, domain.GenerateUUIDKey())
+	assertCacheStats(t, cache, repository.CacheStats{Hits: 1, Misses: 2, Size: 1})
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// given a full cache
+	cache := repository.NewCachedPlayerRepository(repository.NewPlayerRepositoryOnMemory(5), 2, time.Minute)
+	first, second, third := domain.NewPlayer("Ma Long"), domain.NewPlayer("Xu Xin"), domain.NewPlayer("Timo Boll")
+	for _, player := range []*domain.Player{first, second, third} {
+		saveAPlayer(t, cache, player)
+	}
+	findPlayer(t, cache, first.ID)
+	findPlayer(t, cache, second.ID)
+	// when the first player is used again and a third one is cached
+	findPlayer(t, cache, first.ID)
+	findPlayer(t, cache, third.ID)
+	// then the second player was evicted
+	assertCacheStats(t, cache, repository.CacheStats{Hits: 1, Misses: 3, Evictions: 1, Size: 2})
+	findPlayer(t, cache, first.ID)
+	findPlayer(t, cache, second.ID)
+	assertCacheStats(t, cache, repository.CacheStats{Hits: 2, Misses: 4, Evictions: 2, Size: 2})
+}
+
+func TestCacheExpires(t *testing.T) {
+	// given a player cached for a short time
+	cache := repository.NewCachedPlayerRepository(repository.NewPlayerRepositoryOnMemory(5), 10, 10*time.Millisecond)
+	player := domain.NewPlayer("Ma Long")
+	saveAPlayer(t, cache, player)
+	findPlayer(t, cache, player.ID)
+	// when it is found after its time to live
+	time.Sleep(20 * time.Millisecond)
+	findPlayer(t, cache, player.ID)
+	// then it was read again
+	assertCacheStats(t, cache, repository.CacheStats{Misses: 2, Size: 1})
+}
+
+func TestCacheInvalidatesChangedPlayers(t *testing.T) {
+	// given two cached players
+	repo := repository.NewPlayerRepositoryOnMemory(5)
+	cache := repository.NewCachedPlayerRepository(repo, 10, time.Minute)
+	winner, loser := domain.NewPlayer("Ma Long"), domain.NewPlayer("Xu Xin")
+	saveAPlayer(t, cache, winner)
+	saveAPlayer(t, cache, loser)
+	findPlayer(t, cache, winner.ID)
+	findPlayer(t, cache, loser.ID)
+	// when they play a match
+	assertNoError(t, cache.RecordMatchResult(context.TODO(), winner.ID, loser.ID, 1, 1))
+	// then they are read again with their new statistics
+	if got := findPlayer(t, cache, winner.ID); got.Wins != 1 {
+		t.Errorf("1 win was expected, but got: %+v", got)
+	}
+	if got := findPlayer(t, cache, loser.ID); got.Losses != 1 {
+		t.Errorf("1 loss was expected, but got: %+v", got)
+	}
+	assertCacheStats(t, cache, repository.CacheStats{Misses: 4, Size: 2})
+	// and a player changed in a transaction is read again once it is committed
+	err := domain.RunInTransaction(context.TODO(), cache, func(ctx context.Context) error {
+		player, err := cache.FindByID(ctx, winner.ID)
+		if err != nil {
+			return err
+		}
+		player.Names = "Fan Zhendong"
+		return cache.Update(ctx, &player)
+	})
+	assertNoError(t, err)
+	if got := findPlayer(t, cache, winner.ID); got.Names != "Fan Zhendong" {
+		t.Errorf("the updated player was expected, but got: %+v", got)
+	}
+	// but not if it is rolled back
+	failure := errors.New("player cannot be updated")
+	err = domain.RunInTransaction(context.TODO(), cache, func(ctx context.Context) error {
+		player, err := cache.FindByID(ctx, winner.ID)
+		if err != nil {
+			return err
+		}
+		player.Names = "Wang Hao"
+		if err := cache.Update(ctx, &player); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("error %q was expected, but got: %v", failure, err)
+	}
+	if got := findPlayer(t, cache, winner.ID); got.Names != "Fan Zhendong" {
+		t.Errorf("the player before the transaction was expected, but got: %+v", got)
+	}
+}
+
+func findPlayer(t *testing.T, repo domain.PlayerRepository, id domain.Key) domain.Player {
+	t.Helper()
+	player, err := repo.FindByID(context.TODO(), id)
+	assertNoError(t, err)
+	return player
+}
+
+func assertCacheStats(t *testing.T, cache *repository.CachedPlayerRepository, want repository.CacheStats) {
+	t.Helper()
+	if got := cache.Stats(); got != want {
+		t.Errorf("cache stats %+v were expected, but got: %+v", want, got)
+	}
+}
@@ -0,0 +1,80 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/domain/repositorytest"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	repositorytest.TestPlayerRepository(t, func(t *testing.T) domain.PlayerRepository {
+		return repository.NewPlayerRepositoryOnMemory(5)
+	})
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	repositorytest.TestPlayerRepository(t, func(t *testing.T) domain.PlayerRepository {
+		return newSQLiteRepository(t, filepath.Join(t.TempDir(), "players.db"))
+	})
+}
+
+func TestBoltConformance(t *testing.T) {
+	repositorytest.TestPlayerRepository(t, func(t *testing.T) domain.PlayerRepository {
+		return newBoltRepository(t, filepath.Join(t.TempDir(), "players.bolt"))
+	})
+}
+
+func TestMemoryMatchConformance(t *testing.T) {
+	repositorytest.TestMatchRepository(t, func(t *testing.T) (domain.PlayerRepository, domain.MatchRepository) {
+		return newMatchRepositories(t, repository.NewPlayerRepositoryOnMemory(5))
+	})
+}
+
+func TestSQLiteMatchConformance(t *testing.T) {
+	repositorytest.TestMatchRepository(t, func(t *testing.T) (domain.PlayerRepository, domain.MatchRepository) {
+		return newMatchRepositories(t, newSQLiteRepository(t, filepath.Join(t.TempDir(), "players.db")))
+	})
+}
+
+func TestBoltMatchConformance(t *testing.T) {
+	repositorytest.TestMatchRepository(t, func(t *testing.T) (domain.PlayerRepository, domain.MatchRepository) {
+		return newMatchRepositories(t, newBoltRepository(t, filepath.Join(t.TempDir(), "players.bolt")))
+	})
+}
+
+func TestSnapshotMemoryConformance(t *testing.T) {
+	repositorytest.TestPlayerRepository(t, func(t *testing.T) domain.PlayerRepository {
+		return newSnapshotRepository(t, filepath.Join(t.TempDir(), "players.snapshot"), time.Millisecond)
+	})
+}
+
+func TestCachedConformance(t *testing.T) {
+	repositorytest.TestPlayerRepository(t, func(t *testing.T) domain.PlayerRepository {
+		return repository.NewCachedPlayerRepository(repository.NewPlayerRepositoryOnMemory(5), 100, time.Minute)
+	})
+}
+
+func TestCachedMatchConformance(t *testing.T) {
+	repositorytest.TestMatchRepository(t, func(t *testing.T) (domain.PlayerRepository, domain.MatchRepository) {
+		players := repository.NewCachedPlayerRepository(repository.NewPlayerRepositoryOnMemory(5), 100, time.Minute)
+		return newMatchRepositories(t, players)
+	})
+}
+
+func TestCachedSQLiteConformance(t *testing.T) {
+	repositorytest.TestPlayerRepository(t, func(t *testing.T) domain.PlayerRepository {
+		repo := newSQLiteRepository(t, filepath.Join(t.TempDir(), "players.db"))
+		return repository.NewCachedPlayerRepository(repo, 100, time.Minute)
+	})
+}
+
+func newMatchRepositories(t *testing.T, players domain.PlayerRepository) (domain.PlayerRepository, domain.MatchRepository) {
+	t.Helper()
+	matches, err := repository.NewMatchRepositoryOn(players)
+	assertNoError(t, err)
+	return players, matches
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// NewMatchRepositoryOn returns the repository of the matches stored on the same backend
+// as the given repository of players, so both take part in the transactions it begins.
+func NewMatchRepositoryOn(players domain.PlayerRepository) (domain.MatchRepository, error) {
+	switch repo := players.(type) {
+	case *CachedPlayerRepository:
+		return NewMatchRepositoryOn(repo.PlayerRepository)
+	case *dbMemory:
+		log.Info("creating on memory repository for matches")
+		return &memoryMatches{db: repo}, nil
+	case *snapshotMemory:
+		log.Info("creating on memory repository for matches, they are not written on the snapshots")
+		return &memoryMatches{db: repo.dbMemory}, nil
+	case *dbSQLite:
+		log.Info("creating sqlite repository for matches")
+		return &sqliteMatches{db: repo}, nil
+	case *dbBolt:
+		log.Info("creating bbolt repository for matches")
+		return &boltMatches{db: repo}, nil
+	}
+	return nil, errors.Errorf("matches cannot be stored on the backend %T of the players", players)
+}
@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// migrationFiles contains the numbered up and down migrations of the sql schema, named
+// like 0001_create_players.up.sql and 0001_create_players.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// createMigrationsTable creates the table with the migrations applied to the database.
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name    TEXT NOT NULL,
+	applied TEXT NOT NULL
+)`
+
+// ErrDatabaseNotMigrated is returned when a repository is opened on a database with
+// pending migrations.
+var ErrDatabaseNotMigrated = errors.New("database has pending migrations")
+
+// Migration contains the statements to change the schema to a version and back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration was applied to the database.
+type MigrationStatus struct {
+	Version int
+	Name    string
+	Applied *time.Time // nil when the migration is pending
+}
+
+// Migrator applies the embedded migrations to a sql database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewSQLiteMigrator opens the sqlite database in the given file to migrate it.
+func NewSQLiteMigrator(path string) (*Migrator, error) {
+	log.Infof("creating migrator for sqlite database on file: %s", path)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "sqlite database %q cannot be opened", path)
+	}
+	db.SetMaxOpenConns(1)
+	migrator, err := newMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return migrator, nil
+}
+
+// newMigrator creates a migrator for the given database with the embedded migrations.
+func newMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return nil, errors.Wrap(err, "migrations table cannot be created")
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies the pending migrations in order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for index, migration := range pending {
+		log.Infof("applying migration %d %s", migration.Version, migration.Name)
+		err := m.apply(ctx, migration.Up,
+			`INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+			migration.Version, migration.Name, formatTime(time.Now()))
+		if err != nil {
+			return pending[:index], errors.Wrapf(err, "migration %d %s cannot be applied", migration.Version, migration.Name)
+		}
+	}
+	return pending, nil
+}
+
+// Down reverts the last applied migration and returns it, it returns nil if there is
+// not any applied migration.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for index := len(statuses) - 1; index >= 0; index-- {
+		if statuses[index].Applied == nil {
+			continue
+		}
+		migration := m.migrations[index]
+		log.Infof("reverting migration %d %s", migration.Version, migration.Name)
+		err := m.apply(ctx, migration.Down, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %d %s cannot be reverted", migration.Version, migration.Name)
+		}
+		return &migration, nil
+	}
+	log.Info("there is not any migration to revert")
+	return nil, nil
+}
+
+// Status returns every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, errors.Wrap(err, "applied migrations cannot be read")
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var date string
+		if err := rows.Scan(&version, &date); err != nil {
+			return nil, errors.Wrap(err, "applied migrations cannot be read")
+		}
+		if applied[version], err = time.Parse(time.RFC3339Nano, date); err != nil {
+			return nil, errors.Wrapf(err, "date of migration %d is not valid", version)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "applied migrations cannot be read")
+	}
+	result := make([]MigrationStatus, len(m.migrations))
+	for index, migration := range m.migrations {
+		result[index] = MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if date, ok := applied[migration.Version]; ok {
+			result[index].Applied = &date
+		}
+	}
+	return result, nil
+}
+
+// Pending returns the migrations that were not applied yet in order.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []Migration
+	for index, status := range statuses {
+		if status.Applied == nil {
+			result = append(result, m.migrations[index])
+		}
+	}
+	return result, nil
+}
+
+// Close closes the database.
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// apply runs the statements of a migration and records it in the same transaction.
+func (m *Migrator) apply(ctx context.Context, statements, record string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadMigrations reads the migrations of the given files sorted by version, every
+// version must have an up and a down file.
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, errors.Wrap(err, "migrations cannot be listed")
+	}
+	byVersion := make(map[int]*Migration)
+	for _, file := range names {
+		base := strings.TrimPrefix(file, "migrations/")
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction, base = "up", strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			direction, base = "down", strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, fmt.Errorf("migration %s must end with .up.sql or .down.sql", file)
+		}
+		parts := strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) < 2 {
+			return nil, fmt.Errorf("migration %s must be named like 0001_description.%s.sql", file, direction)
+		}
+		content, err := fs.ReadFile(files, file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s cannot be read", file)
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = migration
+		}
+		if migration.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d is named %s and %s", version, migration.Name, parts[1])
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	result := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d %s must have an up and a down file", migration.Version, migration.Name)
+		}
+		result = append(result, *migration)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
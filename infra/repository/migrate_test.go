@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+	"github.com/pkg/errors"
+)
+
+func TestMigrateUpAndDown(t *testing.T) {
+	// given a new database
+	path := filepath.Join(t.TempDir(), "players.db")
+	migrator, err := repository.NewSQLiteMigrator(path)
+	assertNoError(t, err)
+	defer migrator.Close()
+	ctx := context.TODO()
+	statuses, err := migrator.Status(ctx)
+	assertNoError(t, err)
+	if len(statuses) == 0 {
+		t.Fatalf("migrations were expected")
+	}
+	// when it is migrated up
+	applied, err := migrator.Up(ctx)
+	// then every migration is applied once
+	assertNoError(t, err)
+	if len(applied) != len(statuses) {
+		t.Errorf("%d migrations were expected to be applied, but got: %d", len(statuses), len(applied))
+	}
+	if again, err := migrator.Up(ctx); err != nil || len(again) != 0 {
+		t.Errorf("migrations must be applied once, but got: %d, %v", len(again), err)
+	}
+	assertPendingMigrations(t, migrator, 0)
+
+	// when the last migration is reverted
+	reverted, err := migrator.Down(ctx)
+	// then it is pending again
+	assertNoError(t, err)
+	if reverted == nil || reverted.Version != statuses[len(statuses)-1].Version {
+		t.Fatalf("migration %d was expected to be reverted, but got: %+v", statuses[len(statuses)-1].Version, reverted)
+	}
+	assertPendingMigrations(t, migrator, 1)
+
+	// when every migration is reverted
+	for i := 1; i < len(statuses); i++ {
+		_, err := migrator.Down(ctx)
+		assertNoError(t, err)
+	}
+	// then there is nothing else to revert
+	if reverted, err := migrator.Down(ctx); err != nil || reverted != nil {
+		t.Errorf("nothing was expected to be reverted, but got: %+v, %v", reverted, err)
+	}
+	assertPendingMigrations(t, migrator, len(statuses))
+}
+
+func TestRepositoryRefusesUnmigratedDatabase(t *testing.T) {
+	// given a database without migrations
+	path := filepath.Join(t.TempDir(), "players.db")
+	// when a repository is opened on it
+	_, err := repository.NewPlayerRepositoryOnSQLite(path)
+	// then it is refused
+	if errors.Cause(err) != repository.ErrDatabaseNotMigrated {
+		t.Errorf("error %q was expected, but got: %v", repository.ErrDatabaseNotMigrated, err)
+	}
+	// and once it is migrated it can be used
+	repo := newSQLiteRepository(t, path)
+	saveAPlayer(t, repo, domain.NewPlayer("Ma Long"))
+}
+
+func assertPendingMigrations(t *testing.T, migrator *repository.Migrator, want int) {
+	t.Helper()
+	pending, err := migrator.Pending(context.TODO())
+	assertNoError(t, err)
+	if len(pending) != want {
+		t.Errorf("%d pending migrations were expected, but got: %+v", want, pending)
+	}
+}
@@ -0,0 +1,13 @@
+-- databases created before the migrations already have the players table
+CREATE TABLE IF NOT EXISTS players (
+	id         TEXT PRIMARY KEY,
+	names      TEXT NOT NULL,
+	wins       INTEGER NOT NULL DEFAULT 0,
+	losses     INTEGER NOT NULL DEFAULT 0,
+	rating     INTEGER NOT NULL DEFAULT 0,
+	style      TEXT NOT NULL DEFAULT '',
+	handedness TEXT NOT NULL DEFAULT '',
+	grip       TEXT NOT NULL DEFAULT '',
+	created    TEXT NOT NULL,
+	updated    TEXT NOT NULL
+);
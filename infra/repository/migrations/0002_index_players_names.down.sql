@@ -0,0 +1 @@
+DROP INDEX players_names;
@@ -0,0 +1,2 @@
+-- players are listed sorted by names
+CREATE INDEX players_names ON players (names);
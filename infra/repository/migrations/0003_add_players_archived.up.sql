@@ -0,0 +1,2 @@
+-- archived players are kept so the matches they played stay intact
+ALTER TABLE players ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+-- padded dates are read like the previous ones, there is nothing to undo
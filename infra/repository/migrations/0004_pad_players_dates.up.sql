@@ -0,0 +1,6 @@
+-- dates are stored with nine decimals, so they are sorted and compared as text
+UPDATE players SET
+	created = substr(created, 1, 19) || '.' ||
+		substr((CASE WHEN substr(created, 20, 1) = '.' THEN substr(created, 21, length(created) - 21) ELSE '' END) || '000000000', 1, 9) || 'Z',
+	updated = substr(updated, 1, 19) || '.' ||
+		substr((CASE WHEN substr(updated, 20, 1) = '.' THEN substr(updated, 21, length(updated) - 21) ELSE '' END) || '000000000', 1, 9) || 'Z';
@@ -0,0 +1,2 @@
+-- every change of a player increases its version, so stale changes are rejected
+ALTER TABLE players ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
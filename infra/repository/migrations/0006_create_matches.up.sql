@@ -0,0 +1,10 @@
+-- reports of the played matches, stored as json with the columns they are found by
+CREATE TABLE matches (
+	id        TEXT PRIMARY KEY,
+	player1id TEXT NOT NULL,
+	player2id TEXT NOT NULL,
+	report    TEXT NOT NULL,
+	created   TEXT NOT NULL
+);
+CREATE INDEX matches_player1id ON matches (player1id);
+CREATE INDEX matches_player2id ON matches (player2id);
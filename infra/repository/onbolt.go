@@ -0,0 +1,473 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// playersBucket contains the players encoded as json by id
+	playersBucket = []byte("players")
+	// namesBucket is the index of the players by names, its keys are the names and the id
+	// of every player and its values are empty
+	namesBucket = []byte("players_by_names")
+	// matchesBucket contains the reports of the played matches encoded as json by id
+	matchesBucket = []byte("matches")
+)
+
+// dbBolt implements PlayerRepository and store data on a bbolt file.
+type dbBolt struct {
+	db    *bolt.DB
+	index *playerIndex
+}
+
+// boltMatches implements MatchRepository on the bbolt file of the players, so matches
+// and players are changed in the same transactions.
+type boltMatches struct {
+	db *dbBolt
+}
+
+// boltTx is a writable transaction on a bbolt file.
+type boltTx struct {
+	db *dbBolt
+	tx *bolt.Tx
+}
+
+// NewPlayerRepositoryOnBolt opens the bbolt database in the given file, creating the
+// file and its buckets if they don't exist.
+func NewPlayerRepositoryOnBolt(path string) (domain.PlayerRepository, error) {
+	log.Infof("creating bbolt repository for players on file: %s", path)
+	// another process holding the file makes open wait forever without timeout
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "bbolt database %q cannot be opened", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{playersBucket, namesBucket, matchesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "buckets cannot be created on bbolt database %q", path)
+	}
+	index, err := loadBoltIndex(db)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "players of bbolt database %q cannot be indexed", path)
+	}
+	return &dbBolt{db: db, index: index}, nil
+}
+
+// loadBoltIndex creates the search index with the players that are not archived.
+func loadBoltIndex(db *bolt.DB) (*playerIndex, error) {
+	var players []domain.Player
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(playersBucket).ForEach(func(id, record []byte) error {
+			var player domain.Player
+			if err := decodePlayer(record, &player); err != nil {
+				return err
+			}
+			players = append(players, player)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("search index was created with %d players", len(players))
+	return newPlayerIndex(players...), nil
+}
+
+// Save the given player
+func (db *dbBolt) Save(ctx context.Context, player *domain.Player) error {
+	log.Infof("receiven player: %v to store", player)
+	record, err := json.Marshal(player)
+	if err != nil {
+		return errors.Wrapf(err, "player %s cannot be encoded", player.ID)
+	}
+	return db.update(ctx, "Could not finish save operation at time", func(tx *bolt.Tx) error {
+		players := tx.Bucket(playersBucket)
+		if players.Get([]byte(player.ID)) != nil {
+			log.Errorf("record with id: %s already exists on db", player.ID)
+			return fmt.Errorf("The player with ID: %s already exists", player.ID)
+		}
+		if err := players.Put([]byte(player.ID), record); err != nil {
+			return errors.Wrapf(err, "player %s cannot be stored", player.ID)
+		}
+		log.Infof("saving player: %v on database", player)
+		if err := tx.Bucket(namesBucket).Put(namesKey(*player), []byte{}); err != nil {
+			return err
+		}
+		saved := *player
+		tx.OnCommit(func() { db.index.put(saved) })
+		return nil
+	})
+}
+
+// FindByID searches a player record with the given Id, it returns an empty player if
+// there is not such player.
+func (db *dbBolt) FindByID(ctx context.Context, id domain.Key) (domain.Player, error) {
+	log.Infof("looking for player with id: %s", id)
+	var result domain.Player
+	err := db.view(ctx, "Could not finish the find by id at time", func(tx *bolt.Tx) error {
+		record := tx.Bucket(playersBucket).Get([]byte(id))
+		if record == nil {
+			log.Infof("player with id %s was not found on repository", id)
+			return nil
+		}
+		return decodePlayer(record, &result)
+	})
+	if err != nil {
+		return domain.Player{}, err
+	}
+	return result, nil
+}
+
+// FindAll returns the page of the players selected by the query, the players with a
+// names prefix are found through the names index.
+func (db *dbBolt) FindAll(ctx context.Context, query domain.PlayerQuery) (domain.PlayerPage, error) {
+	log.Infof("finding all players with query: %+v", query)
+	values := make([]domain.Player, 0)
+	err := db.view(ctx, "Could not finish the findAll at time", func(tx *bolt.Tx) error {
+		players := tx.Bucket(playersBucket)
+		if query.NamesPrefix == "" {
+			return players.ForEach(func(id, record []byte) error {
+				var player domain.Player
+				if err := decodePlayer(record, &player); err != nil {
+					return err
+				}
+				values = append(values, player)
+				return nil
+			})
+		}
+		prefix := []byte(query.NamesPrefix)
+		cursor := tx.Bucket(namesBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			var player domain.Player
+			if err := decodePlayer(players.Get(idFromNamesKey(key)), &player); err != nil {
+				return err
+			}
+			values = append(values, player)
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.PlayerPage{}, err
+	}
+	result, err := query.Page(values)
+	if err != nil {
+		return domain.PlayerPage{}, err
+	}
+	log.Debugf("players found are: %+v", result)
+	return result, nil
+}
+
+// Search returns the players found by the index whose names match the text, they are
+// read from the database in the same transaction.
+func (db *dbBolt) Search(ctx context.Context, text string, limit int) ([]domain.SearchResult, error) {
+	log.Infof("searching players with text: %q", text)
+	found := db.index.search(text, limit)
+	var result []domain.SearchResult
+	err := db.view(ctx, "Could not finish the search at time", func(tx *bolt.Tx) error {
+		players := tx.Bucket(playersBucket)
+		var err error
+		result, err = searchResults(found, func(id domain.Key) (domain.Player, error) {
+			var player domain.Player
+			if record := players.Get([]byte(id)); record != nil {
+				return player, decodePlayer(record, &player)
+			}
+			return player, nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("players found are: %+v", result)
+	return result, nil
+}
+
+// UpdateWins increases the value on field wins
+func (db *dbBolt) UpdateWins(ctx context.Context, playerID domain.Key, wins int) error {
+	log.Infof("increasing wins of player with id: %s", playerID)
+	return db.RecordMatchResult(ctx, playerID, "", wins, 0)
+}
+
+// UpdateDefeats increases the value on field loses
+func (db *dbBolt) UpdateDefeats(ctx context.Context, playerID domain.Key, defeats int) error {
+	log.Infof("increasing defeats of player with id: %s", playerID)
+	return db.RecordMatchResult(ctx, "", playerID, 0, defeats)
+}
+
+// RecordMatchResult increases the wins of the winner and the losses of the loser in a
+// single transaction, an empty id skips that player.
+func (db *dbBolt) RecordMatchResult(ctx context.Context, winnerID, loserID domain.Key, wins, losses int) error {
+	log.Infof("recording match result, winner: %q, loser: %q", winnerID, loserID)
+	return db.update(ctx, "Could not finish the update of statistics at time", func(tx *bolt.Tx) error {
+		players := tx.Bucket(playersBucket)
+		// both players are checked first, so nothing changes inside a transaction that goes on
+		for _, playerID := range []domain.Key{winnerID, loserID} {
+			if playerID != "" && players.Get([]byte(playerID)) == nil {
+				log.Errorf("match result cannot be recorded because player %q doesn't exist", playerID)
+				return domain.ErrPlayerNotFound
+			}
+		}
+		if winnerID != "" {
+			err := updatePlayer(players, winnerID, func(player *domain.Player) error {
+				player.Wins += wins
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if loserID != "" {
+			return updatePlayer(players, loserID, func(player *domain.Player) error {
+				player.Losses += losses
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// Update replaces the stored player with the given one keeping its creation date, if
+// the player has the stored version. The names index changes with its names.
+func (db *dbBolt) Update(ctx context.Context, player *domain.Player) error {
+	log.Infof("updating player: %v", player)
+	return db.update(ctx, "Could not finish the update at time", func(tx *bolt.Tx) error {
+		var stored domain.Player
+		err := updatePlayer(tx.Bucket(playersBucket), player.ID, func(current *domain.Player) error {
+			if current.Version != player.Version {
+				log.Errorf("player %q cannot be updated from version %d, it is on version %d", player.ID, player.Version, current.Version)
+				return domain.ErrVersionConflict
+			}
+			stored = *current
+			*current = *player
+			current.Created = stored.Created
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		player.Version++
+		names := tx.Bucket(namesBucket)
+		if err := names.Delete(namesKey(stored)); err != nil {
+			return errors.Wrapf(err, "names of player %s cannot be removed from the index", player.ID)
+		}
+		if err := names.Put(namesKey(*player), []byte{}); err != nil {
+			return err
+		}
+		updated := *player
+		tx.OnCommit(func() { db.index.put(updated) })
+		return nil
+	})
+}
+
+// Archive marks the player with the given id as archived.
+func (db *dbBolt) Archive(ctx context.Context, id domain.Key) error {
+	log.Infof("archiving player with id: %s", id)
+	return db.update(ctx, "Could not finish the archive at time", func(tx *bolt.Tx) error {
+		err := updatePlayer(tx.Bucket(playersBucket), id, func(player *domain.Player) error {
+			player.Archived = true
+			player.Updated = time.Now()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		tx.OnCommit(func() { db.index.delete(id) })
+		return nil
+	})
+}
+
+// Save stores the report of the given match.
+func (m *boltMatches) Save(ctx context.Context, match *domain.MatchReport) error {
+	log.Infof("receiving match %s to store", match.ID)
+	record, err := json.Marshal(match)
+	if err != nil {
+		return errors.Wrapf(err, "match %s cannot be encoded", match.ID)
+	}
+	return m.db.update(ctx, "Could not finish the save of the match at time", func(tx *bolt.Tx) error {
+		matches := tx.Bucket(matchesBucket)
+		if matches.Get([]byte(match.ID)) != nil {
+			log.Errorf("match with id: %s already exists on db", match.ID)
+			return fmt.Errorf("The match with ID: %s already exists", match.ID)
+		}
+		if err := matches.Put([]byte(match.ID), record); err != nil {
+			return errors.Wrapf(err, "match %s cannot be stored", match.ID)
+		}
+		return nil
+	})
+}
+
+// FindByID searches the report of the match with the given id, it returns an empty
+// report if there is not such match.
+func (m *boltMatches) FindByID(ctx context.Context, id domain.Key) (domain.MatchReport, error) {
+	log.Infof("looking for match with id: %s", id)
+	var result domain.MatchReport
+	err := m.db.view(ctx, "Could not finish the find of the match at time", func(tx *bolt.Tx) error {
+		record := tx.Bucket(matchesBucket).Get([]byte(id))
+		if record == nil {
+			log.Infof("match with id %s was not found on repository", id)
+			return nil
+		}
+		if err := json.Unmarshal(record, &result); err != nil {
+			return errors.Wrap(err, "match record cannot be decoded")
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.MatchReport{}, err
+	}
+	return result, nil
+}
+
+// updatePlayer reads, changes and writes the player with the given id in the bucket,
+// increasing its version. Nothing is written if change fails.
+func updatePlayer(players *bolt.Bucket, playerID domain.Key, change func(player *domain.Player) error) error {
+	record := players.Get([]byte(playerID))
+	if record == nil {
+		log.Errorf("player %q cannot be updated because it doesn't exist", playerID)
+		return domain.ErrPlayerNotFound
+	}
+	var player domain.Player
+	if err := decodePlayer(record, &player); err != nil {
+		return err
+	}
+	if err := change(&player); err != nil {
+		return err
+	}
+	player.Version++
+	updated, err := json.Marshal(player)
+	if err != nil {
+		return errors.Wrapf(err, "player %s cannot be encoded", playerID)
+	}
+	log.Infof("player %q was updated on repository", playerID)
+	return players.Put([]byte(playerID), updated)
+}
+
+// Begin starts a writable transaction, the operations of the repository with a context
+// carrying it run inside it. Other writers wait until it is committed or rolled back.
+func (db *dbBolt) Begin(ctx context.Context) (domain.Transaction, error) {
+	if err := checkContext(ctx, "Could not begin the transaction at time"); err != nil {
+		return nil, err
+	}
+	tx, err := db.db.Begin(true)
+	if err != nil {
+		return nil, errors.Wrap(err, "bbolt transaction cannot begin")
+	}
+	return &boltTx{db: db, tx: tx}, nil
+}
+
+// Commit writes the changes of the transaction to the file.
+func (tx *boltTx) Commit() error {
+	return tx.tx.Commit()
+}
+
+// Rollback discards the changes of the transaction.
+func (tx *boltTx) Rollback() error {
+	return tx.tx.Rollback()
+}
+
+// view runs fn in the transaction carried by the context or in a new read only one.
+func (db *dbBolt) view(ctx context.Context, message string, fn func(tx *bolt.Tx) error) error {
+	if tx, ok := db.transaction(ctx); ok {
+		return inTransaction(ctx, message, tx, fn)
+	}
+	return withContext(ctx, message, func() error {
+		return db.db.View(fn)
+	})
+}
+
+// update runs fn in the transaction carried by the context or in a new writable one.
+func (db *dbBolt) update(ctx context.Context, message string, fn func(tx *bolt.Tx) error) error {
+	if tx, ok := db.transaction(ctx); ok {
+		return inTransaction(ctx, message, tx, fn)
+	}
+	return withContext(ctx, message, func() error {
+		return db.db.Update(fn)
+	})
+}
+
+// transaction returns the transaction of this database carried by the context.
+func (db *dbBolt) transaction(ctx context.Context) (*bolt.Tx, bool) {
+	current, ok := domain.TransactionFrom(ctx)
+	if !ok {
+		return nil, false
+	}
+	tx, ok := current.(*boltTx)
+	if !ok || tx.db != db {
+		return nil, false
+	}
+	return tx.tx, true
+}
+
+// inTransaction runs fn in the given transaction. It doesn't run in background like
+// withContext because a bbolt transaction cannot be used by many goroutines.
+func inTransaction(ctx context.Context, message string, tx *bolt.Tx, fn func(tx *bolt.Tx) error) error {
+	if err := checkContext(ctx, message); err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+// Close closes the database file.
+func (db *dbBolt) Close() error {
+	log.Info("closing bbolt repository for players")
+	return db.db.Close()
+}
+
+// namesKey returns the key of the player on the names index, the id makes it unique
+// when two players have the same names.
+func namesKey(player domain.Player) []byte {
+	return []byte(player.Names + "\x00" + string(player.ID))
+}
+
+// idFromNamesKey returns the id of the player of the given key of the names index.
+func idFromNamesKey(key []byte) []byte {
+	for index := len(key) - 1; index >= 0; index-- {
+		if key[index] == 0 {
+			return key[index+1:]
+		}
+	}
+	return key
+}
+
+// decodePlayer decodes a player stored as json.
+func decodePlayer(record []byte, player *domain.Player) error {
+	if err := json.Unmarshal(record, player); err != nil {
+		return errors.Wrap(err, "player record cannot be decoded")
+	}
+	return nil
+}
+
+// withContext runs the given operation and waits for it until the context is done,
+// like the memory repository does.
+func withContext(ctx context.Context, message string, operation func() error) error {
+	if err := checkContext(ctx, message); err != nil {
+		return err
+	}
+	chanresult := make(chan error, 1)
+	go func() {
+		chanresult <- operation()
+	}()
+	select {
+	case <-ctx.Done():
+		log.Errorf("Operation take a long to time to finish: %s", ctx.Err())
+		return errors.Wrap(ctx.Err(), message)
+	case err := <-chanresult:
+		return err
+	}
+}
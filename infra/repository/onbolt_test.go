@@ -0,0 +1,72 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+)
+
+func TestBoltPlayersSurviveReopening(t *testing.T) {
+	// given a player stored on a bbolt file
+	path := filepath.Join(t.TempDir(), "players.bolt")
+	repo := newBoltRepository(t, path)
+	newplayer := domain.NewPlayer("Ma Long")
+	newplayer.Grip = domain.Grip("shakehand")
+	saveAPlayer(t, repo, newplayer)
+	assertNoError(t, repo.UpdateWins(context.TODO(), newplayer.ID, 2))
+	assertNoError(t, repo.UpdateDefeats(context.TODO(), newplayer.ID, 1))
+	closeRepository(t, repo)
+
+	// when the database is opened again
+	reopened := newBoltRepository(t, path)
+	got, err := reopened.FindByID(context.TODO(), newplayer.ID)
+
+	// then the player keeps its data
+	assertNoError(t, err)
+	if got.Names != newplayer.Names || got.Grip != newplayer.Grip || got.Wins != 2 || got.Losses != 1 {
+		t.Errorf("player %+v with 2 wins and 1 loss was expected, but got: %+v", newplayer, got)
+	}
+	if err := reopened.Save(context.TODO(), newplayer); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("a player cannot be stored twice, but got: %v", err)
+	}
+	// and it can be searched by its names
+	found, err := reopened.Search(context.TODO(), "long", 0)
+	assertNoError(t, err)
+	if len(found) != 1 || found[0].Player.ID != newplayer.ID {
+		t.Errorf("player %s was expected to be found, but got: %+v", newplayer.ID, found)
+	}
+}
+
+func TestBoltMatchesSurviveReopening(t *testing.T) {
+	// given a match stored on a bbolt file
+	path := filepath.Join(t.TempDir(), "players.bolt")
+	repo := newBoltRepository(t, path)
+	matches, err := repository.NewMatchRepositoryOn(repo)
+	assertNoError(t, err)
+	match := domain.SimulateMatch(*domain.NewPlayer("Ma Long"), *domain.NewPlayer("Timo Boll"))
+	assertNoError(t, matches.Save(context.TODO(), match))
+	closeRepository(t, repo)
+
+	// when the database is opened again
+	reopened, err := repository.NewMatchRepositoryOn(newBoltRepository(t, path))
+	assertNoError(t, err)
+	got, err := reopened.FindByID(context.TODO(), match.ID)
+
+	// then the match keeps its report
+	assertNoError(t, err)
+	if got.ID != match.ID || got.Winner == nil || got.Winner.ID != match.Winner.ID || len(got.Events) != len(match.Events) {
+		t.Errorf("match %s won by %s was expected, but got: %+v", match.ID, match.Winner.ID, got)
+	}
+}
+
+func newBoltRepository(t *testing.T, path string) domain.PlayerRepository {
+	t.Helper()
+	repo, err := repository.NewPlayerRepositoryOnBolt(path)
+	assertNoError(t, err)
+	t.Cleanup(func() { closeRepository(t, repo) })
+	return repo
+}
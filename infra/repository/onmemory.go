@@ -3,15 +3,40 @@ package repository
 import (
 	"context"
 	"fmt"
-	"sort"
+	"sync"
+	"time"
 
 	"github.com/fernandoocampo/thepingthepong/domain"
 	"github.com/pkg/errors"
 )
 
-// DBMemory implements PlayerRepository and store data on memory.
+// ErrTransactionDone is returned when a transaction that was already committed or
+// rolled back is used again.
+var ErrTransactionDone = errors.New("transaction was already committed or rolled back")
+
+// DBMemory implements PlayerRepository and store data on memory, it can be used by
+// many goroutines at the same time.
 type dbMemory struct {
-	data map[domain.Key]domain.Player
+	mu      sync.RWMutex
+	data    map[domain.Key]domain.Player
+	matches map[domain.Key]domain.MatchReport
+	index   *playerIndex
+	changes uint64 // it increases with every change of the data, so snapshots know when it changed
+}
+
+// memoryTx is a transaction on memory, it holds the lock of the repository until it
+// is committed or rolled back and remembers the players it changed to restore them.
+type memoryTx struct {
+	db      *dbMemory
+	undo    map[domain.Key]*domain.Player // player before the transaction, nil if it didn't exist
+	matches []domain.Key                  // matches stored by the transaction
+	done    bool
+}
+
+// memoryMatches implements MatchRepository on the memory of the players, so matches and
+// players are changed in the same transactions.
+type memoryMatches struct {
+	db *dbMemory
 }
 
 // NewPlayerRepositoryOnMemory contains an in memory database using a simple map.
@@ -19,122 +44,285 @@ func NewPlayerRepositoryOnMemory(seed int) domain.PlayerRepository {
 	log.Infof("creating on memory map repository for players with seed: %d", seed)
 	db := new(dbMemory)
 	db.data = make(map[domain.Key]domain.Player, seed)
+	db.matches = make(map[domain.Key]domain.MatchReport)
+	db.index = newPlayerIndex()
 	return db
 }
 
 // Save the given player
 func (db *dbMemory) Save(ctx context.Context, player *domain.Player) error {
 	log.Infof("receiven player: %v to store", player)
-	var iserror error
-	chanresult := make(chan error)
-
-	go func() {
-		if _, ok := db.data[player.ID]; ok {
-			log.Errorf("record with id: %s already exists on db", player.ID)
-			chanresult <- fmt.Errorf("The player with ID: %s already exists", player.ID)
-			return
-		}
-		db.data[player.ID] = *player
-		log.Infof("saving player: %v on database", player)
-		chanresult <- nil
-	}()
-	select {
-	case <-ctx.Done():
-		log.Errorf("Operation take a long to time to finish: %s", ctx.Err())
-		return errors.Wrap(ctx.Err(), "Could not finish save operation at time")
-	case iserror = <-chanresult:
-		return iserror
+	if err := checkContext(ctx, "Could not finish save operation at time"); err != nil {
+		return err
+	}
+	tx, release := db.access(ctx, true)
+	defer release()
+	if _, ok := db.data[player.ID]; ok {
+		log.Errorf("record with id: %s already exists on db", player.ID)
+		return fmt.Errorf("The player with ID: %s already exists", player.ID)
 	}
+	db.put(tx, *player)
+	saved := *player
+	domain.AfterCommit(ctx, func() { db.index.put(saved) })
+	log.Infof("saving player: %v on database", player)
+	return nil
 }
 
 // FindById searches a player record with the given Id.
-func (db dbMemory) FindByID(ctx context.Context, id domain.Key) (domain.Player, error) {
+func (db *dbMemory) FindByID(ctx context.Context, id domain.Key) (domain.Player, error) {
 	log.Infof("looking for player with id: %s", id)
-	var result domain.Player
-	resultchan := make(chan domain.Player)
-	go func() {
-		resultchan <- db.data[id]
-	}()
-	select {
-	case <-ctx.Done():
-		log.Errorf("Operation take a long to time to finish: %s", ctx.Err())
-		return domain.Player{}, errors.Wrap(ctx.Err(), "Could not finish the find by id at time")
-	case result = <-resultchan:
-		log.Infof("player was found on repository: %v", result)
+	if err := checkContext(ctx, "Could not finish the find by id at time"); err != nil {
+		return domain.Player{}, err
 	}
+	_, release := db.access(ctx, false)
+	defer release()
+	result := db.data[id]
+	log.Infof("player was found on repository: %v", result)
 	return result, nil
 }
 
-// FindAll returns all the players stored in the repository.
-func (db dbMemory) FindAll(ctx context.Context, sorted bool) ([]domain.Player, error) {
-	log.Infof("finding all players with sorted: %t", sorted)
-	var result []domain.Player
-	resultchan := make(chan []domain.Player)
+// FindAll returns the page of the players selected by the query.
+func (db *dbMemory) FindAll(ctx context.Context, query domain.PlayerQuery) (domain.PlayerPage, error) {
+	log.Infof("finding all players with query: %+v", query)
+	if err := checkContext(ctx, "Could not finish the findAll at time"); err != nil {
+		return domain.PlayerPage{}, err
+	}
+	_, release := db.access(ctx, false)
+	values := make([]domain.Player, 0, len(db.data))
+	// get values from map db
+	for _, v := range db.data {
+		values = append(values, v)
+	}
+	release()
+	result, err := query.Page(values)
+	if err != nil {
+		return domain.PlayerPage{}, err
+	}
+	log.Debugf("players found are: %+v", result)
+	return result, nil
+}
 
-	go func() {
-		values := make([]domain.Player, len(db.data))
-		index := 0
-		// get values from map db
-		for _, v := range db.data {
-			values[index] = v
-			index++
-		}
-		log.Debugf("All players without sorted are: %+v", values)
-		// sort the slice if required
-		if sorted {
-			sort.SliceStable(values, func(i, j int) bool {
-				return values[i].Names > values[j].Names
-			})
-			log.Debugf("All players sorted are: %+v", values)
-		}
-		resultchan <- values
-	}()
-	select {
-	case <-ctx.Done():
-		log.Errorf("Operation take a long to time to finish: %s", ctx.Err())
-		return nil, errors.Wrap(ctx.Err(), "Could not finish the findAll at time")
-	case result = <-resultchan:
-		log.Infof("player was found on repository: %v", result)
+// Search returns the players found by the index whose names match the text.
+func (db *dbMemory) Search(ctx context.Context, text string, limit int) ([]domain.SearchResult, error) {
+	log.Infof("searching players with text: %q", text)
+	if err := checkContext(ctx, "Could not finish the search at time"); err != nil {
+		return nil, err
 	}
+	found := db.index.search(text, limit)
+	_, release := db.access(ctx, false)
+	defer release()
+	result, _ := searchResults(found, func(id domain.Key) (domain.Player, error) {
+		return db.data[id], nil
+	})
+	log.Debugf("players found are: %+v", result)
 	return result, nil
 }
 
 // UpdateWins increases the value on field wins
-func (db dbMemory) UpdateWins(ctx context.Context, playerID domain.Key, wins int) error {
-	log.Infof("looking for player with id: %s", playerID)
-	resultchan := make(chan bool)
-	go func() {
-		player := db.data[playerID]
-		player.Wins += wins
-		db.data[playerID] = player
-		resultchan <- true
-	}()
-	select {
-	case <-ctx.Done():
-		log.Errorf("Operation take a long to time to finish: %s", ctx.Err())
-		return errors.Wrap(ctx.Err(), "Could not finish the find by id at time")
-	case <-resultchan:
-		log.Infof("player %q was updated on repository", playerID)
+func (db *dbMemory) UpdateWins(ctx context.Context, playerID domain.Key, wins int) error {
+	log.Infof("increasing wins of player with id: %s", playerID)
+	return db.RecordMatchResult(ctx, playerID, "", wins, 0)
+}
+
+// UpdateDefeats increases the value on field loses
+func (db *dbMemory) UpdateDefeats(ctx context.Context, playerID domain.Key, defeats int) error {
+	log.Infof("increasing defeats of player with id: %s", playerID)
+	return db.RecordMatchResult(ctx, "", playerID, 0, defeats)
+}
+
+// RecordMatchResult increases the wins of the winner and the losses of the loser under
+// the same lock, an empty id skips that player.
+func (db *dbMemory) RecordMatchResult(ctx context.Context, winnerID, loserID domain.Key, wins, losses int) error {
+	log.Infof("recording match result, winner: %q, loser: %q", winnerID, loserID)
+	if err := checkContext(ctx, "Could not finish the update of statistics at time"); err != nil {
+		return err
+	}
+	tx, release := db.access(ctx, true)
+	defer release()
+	_, winnerok := db.data[winnerID]
+	_, loserok := db.data[loserID]
+	if (winnerID != "" && !winnerok) || (loserID != "" && !loserok) {
+		log.Errorf("match result cannot be recorded, winner %q exists: %t, loser %q exists: %t", winnerID, winnerok, loserID, loserok)
+		return domain.ErrPlayerNotFound
+	}
+	if winnerID != "" {
+		winner := db.data[winnerID]
+		winner.Wins += wins
+		winner.Version++
+		db.put(tx, winner)
 	}
+	if loserID != "" {
+		loser := db.data[loserID]
+		loser.Losses += losses
+		loser.Version++
+		db.put(tx, loser)
+	}
+	log.Infof("players %q and %q were updated on repository", winnerID, loserID)
 	return nil
 }
 
-// UpdateDefeats increases the value on field loses
-func (db dbMemory) UpdateDefeats(ctx context.Context, playerID domain.Key, defeats int) error {
-	log.Infof("looking for player with id: %s", playerID)
-	resultchan := make(chan bool)
-	go func() {
-		player := db.data[playerID]
-		player.Losses += defeats
-		db.data[playerID] = player
-		resultchan <- true
-	}()
-	select {
-	case <-ctx.Done():
-		log.Errorf("Operation take a long to time to finish: %s", ctx.Err())
-		return errors.Wrap(ctx.Err(), "Could not finish the find by id at time")
-	case <-resultchan:
-		log.Infof("player %q was updated on repository", playerID)
+// Update replaces the stored player with the given one keeping its creation date, if
+// the player has the stored version.
+func (db *dbMemory) Update(ctx context.Context, player *domain.Player) error {
+	log.Infof("updating player: %v", player)
+	if err := checkContext(ctx, "Could not finish the update at time"); err != nil {
+		return err
+	}
+	tx, release := db.access(ctx, true)
+	defer release()
+	stored, ok := db.data[player.ID]
+	if !ok {
+		log.Errorf("player %q cannot be updated because it doesn't exist", player.ID)
+		return domain.ErrPlayerNotFound
+	}
+	if stored.Version != player.Version {
+		log.Errorf("player %q cannot be updated from version %d, it is on version %d", player.ID, player.Version, stored.Version)
+		return domain.ErrVersionConflict
+	}
+	player.Version++
+	updated := *player
+	updated.Created = stored.Created
+	db.put(tx, updated)
+	domain.AfterCommit(ctx, func() { db.index.put(updated) })
+	log.Infof("player %q was updated on repository", player.ID)
+	return nil
+}
+
+// Archive marks the player with the given id as archived.
+func (db *dbMemory) Archive(ctx context.Context, id domain.Key) error {
+	log.Infof("archiving player with id: %s", id)
+	if err := checkContext(ctx, "Could not finish the archive at time"); err != nil {
+		return err
+	}
+	tx, release := db.access(ctx, true)
+	defer release()
+	player, ok := db.data[id]
+	if !ok {
+		log.Errorf("player %q cannot be archived because it doesn't exist", id)
+		return domain.ErrPlayerNotFound
+	}
+	player.Archived = true
+	player.Updated = time.Now()
+	player.Version++
+	db.put(tx, player)
+	domain.AfterCommit(ctx, func() { db.index.delete(id) })
+	log.Infof("player %q was archived on repository", id)
+	return nil
+}
+
+// Save stores the report of the given match.
+func (m *memoryMatches) Save(ctx context.Context, match *domain.MatchReport) error {
+	log.Infof("receiving match %s to store", match.ID)
+	if err := checkContext(ctx, "Could not finish the save of the match at time"); err != nil {
+		return err
+	}
+	tx, release := m.db.access(ctx, true)
+	defer release()
+	if _, ok := m.db.matches[match.ID]; ok {
+		log.Errorf("match with id: %s already exists on db", match.ID)
+		return fmt.Errorf("The match with ID: %s already exists", match.ID)
+	}
+	m.db.matches[match.ID] = *match
+	if tx != nil {
+		tx.matches = append(tx.matches, match.ID)
+	}
+	return nil
+}
+
+// FindByID searches the report of the match with the given id, it returns an empty
+// report if there is not such match.
+func (m *memoryMatches) FindByID(ctx context.Context, id domain.Key) (domain.MatchReport, error) {
+	log.Infof("looking for match with id: %s", id)
+	if err := checkContext(ctx, "Could not finish the find of the match at time"); err != nil {
+		return domain.MatchReport{}, err
+	}
+	_, release := m.db.access(ctx, false)
+	defer release()
+	return m.db.matches[id], nil
+}
+
+// Begin starts a transaction, other goroutines wait to use the repository until it is
+// committed or rolled back.
+func (db *dbMemory) Begin(ctx context.Context) (domain.Transaction, error) {
+	if err := checkContext(ctx, "Could not begin the transaction at time"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	log.Debug("transaction on memory began")
+	return &memoryTx{db: db, undo: make(map[domain.Key]*domain.Player)}, nil
+}
+
+// Commit keeps the changes of the transaction.
+func (tx *memoryTx) Commit() error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.done = true
+	tx.db.mu.Unlock()
+	log.Debugf("transaction on memory committed with %d players changed", len(tx.undo))
+	return nil
+}
+
+// Rollback restores the players changed by the transaction.
+func (tx *memoryTx) Rollback() error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.done = true
+	for id, player := range tx.undo {
+		if player == nil {
+			delete(tx.db.data, id)
+			continue
+		}
+		tx.db.data[id] = *player
+	}
+	for _, id := range tx.matches {
+		delete(tx.db.matches, id)
+	}
+	tx.db.changes++
+	tx.db.mu.Unlock()
+	log.Debugf("transaction on memory rolled back with %d players restored", len(tx.undo))
+	return nil
+}
+
+// access locks the repository for an operation and returns the function that unlocks
+// it. If the context carries a transaction of this repository, it already holds the
+// lock and it is returned to record the changes.
+func (db *dbMemory) access(ctx context.Context, write bool) (*memoryTx, func()) {
+	if current, ok := domain.TransactionFrom(ctx); ok {
+		if tx, ok := current.(*memoryTx); ok && tx.db == db && !tx.done {
+			return tx, func() {}
+		}
+	}
+	if write {
+		db.mu.Lock()
+		return nil, db.mu.Unlock
+	}
+	db.mu.RLock()
+	return nil, db.mu.RUnlock
+}
+
+// put stores the given player, remembering its previous state if there is a transaction.
+func (db *dbMemory) put(tx *memoryTx, player domain.Player) {
+	if tx != nil {
+		if _, ok := tx.undo[player.ID]; !ok {
+			if previous, ok := db.data[player.ID]; ok {
+				tx.undo[player.ID] = &previous
+			} else {
+				tx.undo[player.ID] = nil
+			}
+		}
+	}
+	db.data[player.ID] = player
+	db.changes++
+}
+
+// checkContext returns the error of the context if it is done, so operations on a
+// cancelled or timed out context don't change anything.
+func checkContext(ctx context.Context, message string) error {
+	if err := ctx.Err(); err != nil {
+		log.Errorf("Operation take a long to time to finish: %s", err)
+		return errors.Wrap(err, message)
 	}
 	return nil
 }
@@ -88,13 +88,13 @@ func TestFindAllNotSorted(t *testing.T) {
 	}
 
 	// When we look for all the records
-	result, err := inmemoryrepo.FindAll(ctx, false)
+	result, err := inmemoryrepo.FindAll(ctx, domain.PlayerQuery{})
 
 	if err != nil {
 		t.Errorf("an expected error was found when findAll function was called: %s", err.Error())
 	}
 
-	for _, player := range result {
+	for _, player := range result.Players {
 		if _, ok := expectedresult[player.Names]; !ok {
 			t.Errorf("The player (%s) was expected in the findAll result but was not found", player.Names)
 		}
@@ -118,7 +118,8 @@ func TestFindAllSorted(t *testing.T) {
 	}
 
 	// When we look for all the records
-	result, err := inmemoryrepo.FindAll(ctx, true)
+	page, err := inmemoryrepo.FindAll(ctx, domain.PlayerQuery{Sort: []domain.SortKey{{Field: domain.SortByNames, Descending: true}}})
+	result := page.Players
 
 	if err != nil {
 		t.Errorf("an expected error was found when findAll function was called: %s", err.Error())
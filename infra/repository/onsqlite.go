@@ -0,0 +1,440 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite" // pure go sqlite driver, it doesn't need cgo
+)
+
+// selectPlayers is the query every find starts with, columns are in the order scanPlayer reads them.
+const selectPlayers = `SELECT id, names, wins, losses, rating, style, handedness, grip, created, updated, archived, version FROM players`
+
+// dbSQLite implements PlayerRepository and store data on a sqlite database.
+type dbSQLite struct {
+	db    *sql.DB
+	index *playerIndex
+}
+
+// sqliteMatches implements MatchRepository on the sqlite database of the players, so
+// matches and players are changed in the same transactions.
+type sqliteMatches struct {
+	db *dbSQLite
+}
+
+// sqliteTx is a transaction on a sqlite database.
+type sqliteTx struct {
+	db *dbSQLite
+	*sql.Tx
+}
+
+// queryer runs queries on the database or inside a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewPlayerRepositoryOnSQLite opens the sqlite database in the given file, it returns
+// ErrDatabaseNotMigrated if the schema lacks any migration.
+func NewPlayerRepositoryOnSQLite(path string) (domain.PlayerRepository, error) {
+	log.Infof("creating sqlite repository for players on file: %s", path)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "sqlite database %q cannot be opened", path)
+	}
+	// sqlite allows one writer, a single connection avoids busy errors between goroutines
+	db.SetMaxOpenConns(1)
+	if err := checkMigrations(db); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "sqlite database %q cannot be used", path)
+	}
+	index, err := loadSQLiteIndex(db)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "players of sqlite database %q cannot be indexed", path)
+	}
+	return &dbSQLite{db: db, index: index}, nil
+}
+
+// loadSQLiteIndex creates the search index with the names of the players that are not archived.
+func loadSQLiteIndex(db *sql.DB) (*playerIndex, error) {
+	rows, err := db.Query(`SELECT id, names FROM players WHERE archived = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var players []domain.Player
+	for rows.Next() {
+		var player domain.Player
+		var id string
+		if err := rows.Scan(&id, &player.Names); err != nil {
+			return nil, err
+		}
+		player.ID = domain.Key(id)
+		players = append(players, player)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	log.Infof("search index was created with %d players", len(players))
+	return newPlayerIndex(players...), nil
+}
+
+// checkMigrations returns ErrDatabaseNotMigrated if the database has pending migrations.
+func checkMigrations(db *sql.DB) error {
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		log.Errorf("%d migrations are pending, the first one is %d %s", len(pending), pending[0].Version, pending[0].Name)
+		return errors.Wrapf(ErrDatabaseNotMigrated, "%d migrations are pending, run the migrate up command", len(pending))
+	}
+	return nil
+}
+
+// Save the given player
+func (db *dbSQLite) Save(ctx context.Context, player *domain.Player) error {
+	log.Infof("receiven player: %v to store", player)
+	result, err := db.queryer(ctx).ExecContext(ctx,
+		`INSERT INTO players (id, names, wins, losses, rating, style, handedness, grip, created, updated, archived, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		string(player.ID), player.Names, player.Wins, player.Losses, player.Rating,
+		string(player.Style), string(player.Handedness), string(player.Grip),
+		formatTime(player.Created), formatTime(player.Updated), player.Archived, player.Version)
+	if err != nil {
+		return sqliteError(ctx, err, "Could not finish save operation at time")
+	}
+	if saved, _ := result.RowsAffected(); saved == 0 {
+		log.Errorf("record with id: %s already exists on db", player.ID)
+		return fmt.Errorf("The player with ID: %s already exists", player.ID)
+	}
+	saved := *player
+	domain.AfterCommit(ctx, func() { db.index.put(saved) })
+	log.Infof("saving player: %v on database", player)
+	return nil
+}
+
+// FindByID searches a player record with the given Id, it returns an empty player if
+// there is not such player.
+func (db *dbSQLite) FindByID(ctx context.Context, id domain.Key) (domain.Player, error) {
+	log.Infof("looking for player with id: %s", id)
+	row := db.queryer(ctx).QueryRowContext(ctx, selectPlayers+` WHERE id = ?`, string(id))
+	result, err := scanPlayer(row)
+	if err == sql.ErrNoRows {
+		log.Infof("player with id %s was not found on repository", id)
+		return domain.Player{}, nil
+	}
+	if err != nil {
+		return domain.Player{}, sqliteError(ctx, err, "Could not finish the find by id at time")
+	}
+	log.Infof("player was found on repository: %v", result)
+	return result, nil
+}
+
+// FindAll returns the page of the players selected by the query, the filters, order
+// and page are run by sqlite. Pages start after the cursor with a condition on the sort
+// keys instead of an offset, so players added or removed don't move the next page.
+func (db *dbSQLite) FindAll(ctx context.Context, query domain.PlayerQuery) (domain.PlayerPage, error) {
+	log.Infof("finding all players with query: %+v", query)
+	const message = "Could not finish the findAll at time"
+	after, ok, err := query.After()
+	if err != nil {
+		return domain.PlayerPage{}, err
+	}
+	where, args := playerFilters(query)
+	var result domain.PlayerPage
+	err = db.queryer(ctx).QueryRowContext(ctx, `SELECT COUNT(*) FROM players`+where, args...).Scan(&result.Total)
+	if err != nil {
+		return domain.PlayerPage{}, sqliteError(ctx, err, message)
+	}
+	if ok {
+		condition, cursorArgs := afterCursor(query.Sort, after)
+		where, args = appendCondition(where, condition), append(args, cursorArgs...)
+	}
+	statement := selectPlayers + where + orderBy(query.Sort)
+	if query.Limit > 0 {
+		// one more player tells if there is a next page
+		statement += ` LIMIT ?`
+		args = append(args, query.Limit+1)
+	}
+	rows, err := db.queryer(ctx).QueryContext(ctx, statement, args...)
+	if err != nil {
+		return domain.PlayerPage{}, sqliteError(ctx, err, message)
+	}
+	defer rows.Close()
+	result.Players = make([]domain.Player, 0)
+	for rows.Next() {
+		player, err := scanPlayer(rows)
+		if err != nil {
+			return domain.PlayerPage{}, sqliteError(ctx, err, message)
+		}
+		result.Players = append(result.Players, player)
+	}
+	if err := rows.Err(); err != nil {
+		return domain.PlayerPage{}, sqliteError(ctx, err, message)
+	}
+	if query.Limit > 0 && len(result.Players) > query.Limit {
+		result.Players = result.Players[:query.Limit]
+		result.NextCursor = query.CursorAfter(result.Players[query.Limit-1])
+	}
+	log.Debugf("players found are: %+v", result)
+	return result, nil
+}
+
+// Search returns the players found by the index whose names match the text, they are
+// read from the database.
+func (db *dbSQLite) Search(ctx context.Context, text string, limit int) ([]domain.SearchResult, error) {
+	log.Infof("searching players with text: %q", text)
+	result, err := searchResults(db.index.search(text, limit), func(id domain.Key) (domain.Player, error) {
+		return db.FindByID(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("players found are: %+v", result)
+	return result, nil
+}
+
+// UpdateWins increases the value on field wins
+func (db *dbSQLite) UpdateWins(ctx context.Context, playerID domain.Key, wins int) error {
+	log.Infof("increasing wins of player with id: %s", playerID)
+	return db.RecordMatchResult(ctx, playerID, "", wins, 0)
+}
+
+// UpdateDefeats increases the value on field loses
+func (db *dbSQLite) UpdateDefeats(ctx context.Context, playerID domain.Key, defeats int) error {
+	log.Infof("increasing defeats of player with id: %s", playerID)
+	return db.RecordMatchResult(ctx, "", playerID, 0, defeats)
+}
+
+// RecordMatchResult increases the wins of the winner and the losses of the loser in a
+// single transaction, an empty id skips that player.
+func (db *dbSQLite) RecordMatchResult(ctx context.Context, winnerID, loserID domain.Key, wins, losses int) error {
+	log.Infof("recording match result, winner: %q, loser: %q", winnerID, loserID)
+	const message = "Could not finish the update of statistics at time"
+	return domain.RunInTransaction(ctx, db, func(ctx context.Context) error {
+		tx := db.queryer(ctx)
+		// both players are checked first, so nothing changes inside a transaction that goes on
+		for _, playerID := range []domain.Key{winnerID, loserID} {
+			if playerID == "" {
+				continue
+			}
+			var found int
+			err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM players WHERE id = ?`, string(playerID)).Scan(&found)
+			if err != nil {
+				return sqliteError(ctx, err, message)
+			}
+			if found == 0 {
+				log.Errorf("match result cannot be recorded because player %q doesn't exist", playerID)
+				return domain.ErrPlayerNotFound
+			}
+		}
+		if winnerID != "" {
+			if err := updateCounter(ctx, tx, `UPDATE players SET wins = wins + ?, version = version + 1 WHERE id = ?`, wins, winnerID); err != nil {
+				return sqliteError(ctx, err, message)
+			}
+		}
+		if loserID != "" {
+			if err := updateCounter(ctx, tx, `UPDATE players SET losses = losses + ?, version = version + 1 WHERE id = ?`, losses, loserID); err != nil {
+				return sqliteError(ctx, err, message)
+			}
+		}
+		log.Infof("players %q and %q were updated on repository", winnerID, loserID)
+		return nil
+	})
+}
+
+// Update replaces the stored player with the given one keeping its creation date, if
+// the player has the stored version.
+func (db *dbSQLite) Update(ctx context.Context, player *domain.Player) error {
+	log.Infof("updating player: %v", player)
+	const message = "Could not finish the update at time"
+	tx := db.queryer(ctx)
+	result, err := tx.ExecContext(ctx,
+		`UPDATE players SET names = ?, wins = ?, losses = ?, rating = ?, style = ?, handedness = ?,
+		grip = ?, updated = ?, archived = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		player.Names, player.Wins, player.Losses, player.Rating,
+		string(player.Style), string(player.Handedness), string(player.Grip),
+		formatTime(player.Updated), player.Archived, string(player.ID), player.Version)
+	if err != nil {
+		return sqliteError(ctx, err, message)
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		// the player doesn't exist or it is on another version
+		var found int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM players WHERE id = ?`, string(player.ID)).Scan(&found)
+		if err != nil {
+			return sqliteError(ctx, err, message)
+		}
+		if found == 0 {
+			log.Errorf("player %q cannot be updated because it doesn't exist", player.ID)
+			return domain.ErrPlayerNotFound
+		}
+		log.Errorf("player %q cannot be updated from version %d, it is on another version", player.ID, player.Version)
+		return domain.ErrVersionConflict
+	}
+	player.Version++
+	updated := *player
+	domain.AfterCommit(ctx, func() { db.index.put(updated) })
+	log.Infof("player %q was updated on repository", player.ID)
+	return nil
+}
+
+// Archive marks the player with the given id as archived.
+func (db *dbSQLite) Archive(ctx context.Context, id domain.Key) error {
+	log.Infof("archiving player with id: %s", id)
+	result, err := db.queryer(ctx).ExecContext(ctx,
+		`UPDATE players SET archived = 1, updated = ?, version = version + 1 WHERE id = ?`, formatTime(time.Now()), string(id))
+	if err != nil {
+		return sqliteError(ctx, err, "Could not finish the archive at time")
+	}
+	if archived, _ := result.RowsAffected(); archived == 0 {
+		log.Errorf("player %q cannot be archived because it doesn't exist", id)
+		return domain.ErrPlayerNotFound
+	}
+	domain.AfterCommit(ctx, func() { db.index.delete(id) })
+	log.Infof("player %q was archived on repository", id)
+	return nil
+}
+
+// updateCounter runs the given update on the player with the given id, it returns
+// ErrPlayerNotFound if there is not such player.
+func updateCounter(ctx context.Context, tx queryer, update string, value int, playerID domain.Key) error {
+	result, err := tx.ExecContext(ctx, update, value, string(playerID))
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return domain.ErrPlayerNotFound
+	}
+	return nil
+}
+
+// Begin starts a transaction, the queries of the repository with a context carrying it
+// run inside it.
+func (db *dbSQLite) Begin(ctx context.Context) (domain.Transaction, error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, sqliteError(ctx, err, "Could not begin the transaction at time")
+	}
+	return &sqliteTx{db: db, Tx: tx}, nil
+}
+
+// queryer returns the transaction of this database carried by the context or the
+// database itself.
+func (db *dbSQLite) queryer(ctx context.Context) queryer {
+	if current, ok := domain.TransactionFrom(ctx); ok {
+		if tx, ok := current.(*sqliteTx); ok && tx.db == db {
+			return tx.Tx
+		}
+	}
+	return db.db
+}
+
+// Save stores the report of the given match.
+func (m *sqliteMatches) Save(ctx context.Context, match *domain.MatchReport) error {
+	log.Infof("receiving match %s to store", match.ID)
+	report, err := json.Marshal(match)
+	if err != nil {
+		return errors.Wrapf(err, "match %s cannot be encoded", match.ID)
+	}
+	result, err := m.db.queryer(ctx).ExecContext(ctx,
+		`INSERT INTO matches (id, player1id, player2id, report, created) VALUES (?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		string(match.ID), string(match.Player1ID), string(match.Player2ID), string(report), formatTime(match.Created))
+	if err != nil {
+		return sqliteError(ctx, err, "Could not finish the save of the match at time")
+	}
+	if saved, _ := result.RowsAffected(); saved == 0 {
+		log.Errorf("match with id: %s already exists on db", match.ID)
+		return fmt.Errorf("The match with ID: %s already exists", match.ID)
+	}
+	return nil
+}
+
+// FindByID searches the report of the match with the given id, it returns an empty
+// report if there is not such match.
+func (m *sqliteMatches) FindByID(ctx context.Context, id domain.Key) (domain.MatchReport, error) {
+	log.Infof("looking for match with id: %s", id)
+	var report string
+	err := m.db.queryer(ctx).QueryRowContext(ctx, `SELECT report FROM matches WHERE id = ?`, string(id)).Scan(&report)
+	if err == sql.ErrNoRows {
+		log.Infof("match with id %s was not found on repository", id)
+		return domain.MatchReport{}, nil
+	}
+	if err != nil {
+		return domain.MatchReport{}, sqliteError(ctx, err, "Could not finish the find of the match at time")
+	}
+	var result domain.MatchReport
+	if err := json.Unmarshal([]byte(report), &result); err != nil {
+		return domain.MatchReport{}, errors.Wrap(err, "match record cannot be decoded")
+	}
+	return result, nil
+}
+
+// Close closes the database.
+func (db *dbSQLite) Close() error {
+	log.Info("closing sqlite repository for players")
+	return db.db.Close()
+}
+
+// scanner is a row of a query.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPlayer reads a player from a row of selectPlayers.
+func scanPlayer(row scanner) (domain.Player, error) {
+	var player domain.Player
+	var id, style, handedness, grip, created, updated string
+	err := row.Scan(&id, &player.Names, &player.Wins, &player.Losses, &player.Rating,
+		&style, &handedness, &grip, &created, &updated, &player.Archived, &player.Version)
+	if err != nil {
+		return domain.Player{}, err
+	}
+	player.ID = domain.Key(id)
+	player.Style = domain.PlayingStyle(style)
+	player.Handedness = domain.Handedness(handedness)
+	player.Grip = domain.Grip(grip)
+	if player.Created, err = time.Parse(time.RFC3339Nano, created); err != nil {
+		return domain.Player{}, errors.Wrapf(err, "creation date of player %s is not valid", id)
+	}
+	if player.Updated, err = time.Parse(time.RFC3339Nano, updated); err != nil {
+		return domain.Player{}, errors.Wrapf(err, "update date of player %s is not valid", id)
+	}
+	return player, nil
+}
+
+// storedTimeFormat always writes nine decimals, so dates stored as text are sorted
+// and compared like the dates themselves.
+const storedTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// formatTime formats the given time the way it is stored on the database.
+func formatTime(value time.Time) string {
+	return value.UTC().Format(storedTimeFormat)
+}
+
+// sqliteError wraps the error of a query with the given message, queries cancelled by
+// the context return the error of the context like the other repositories do and
+// ErrPlayerNotFound is returned as it is.
+func sqliteError(ctx context.Context, err error, message string) error {
+	if err == domain.ErrPlayerNotFound {
+		return err
+	}
+	if ctx.Err() != nil {
+		log.Errorf("Operation take a long to time to finish: %s", ctx.Err())
+		return errors.Wrap(ctx.Err(), message)
+	}
+	log.Errorf("sqlite query failed: %s", err)
+	return errors.Wrap(err, message)
+}
@@ -0,0 +1,67 @@
+package repository_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+)
+
+func TestSQLitePlayersSurviveReopening(t *testing.T) {
+	// given a player stored on a sqlite file
+	path := filepath.Join(t.TempDir(), "players.db")
+	repo := newSQLiteRepository(t, path)
+	newplayer := domain.NewPlayer("Ma Long")
+	newplayer.Style = domain.OffensiveLooper
+	saveAPlayer(t, repo, newplayer)
+	assertNoError(t, repo.UpdateWins(context.TODO(), newplayer.ID, 2))
+	assertNoError(t, repo.UpdateDefeats(context.TODO(), newplayer.ID, 1))
+
+	// when the database is opened again
+	reopened := newSQLiteRepository(t, path)
+	got, err := reopened.FindByID(context.TODO(), newplayer.ID)
+
+	// then the player keeps its data
+	assertNoError(t, err)
+	if got.Names != newplayer.Names || got.Style != newplayer.Style || got.Rating != newplayer.Rating {
+		t.Errorf("player %+v was expected, but got: %+v", newplayer, got)
+	}
+	if got.Wins != 2 || got.Losses != 1 {
+		t.Errorf("2 wins and 1 loss were expected, but got: %d wins and %d losses", got.Wins, got.Losses)
+	}
+	if !got.Created.Equal(newplayer.Created) {
+		t.Errorf("creation date %s was expected, but got: %s", newplayer.Created, got.Created)
+	}
+	// and it can be searched by its names
+	found, err := reopened.Search(context.TODO(), "long", 0)
+	assertNoError(t, err)
+	if len(found) != 1 || found[0].Player.ID != newplayer.ID {
+		t.Errorf("player %s was expected to be found, but got: %+v", newplayer.ID, found)
+	}
+}
+
+func newSQLiteRepository(t *testing.T, path string) domain.PlayerRepository {
+	t.Helper()
+	migrator, err := repository.NewSQLiteMigrator(path)
+	assertNoError(t, err)
+	_, err = migrator.Up(context.TODO())
+	assertNoError(t, err)
+	assertNoError(t, migrator.Close())
+	repo, err := repository.NewPlayerRepositoryOnSQLite(path)
+	assertNoError(t, err)
+	t.Cleanup(func() { closeRepository(t, repo) })
+	return repo
+}
+
+// closeRepository closes the file of the given repository.
+func closeRepository(t *testing.T, repo domain.PlayerRepository) {
+	t.Helper()
+	closer, ok := repo.(io.Closer)
+	if !ok {
+		t.Fatalf("repository %T must be closed", repo)
+	}
+	assertNoError(t, closer.Close())
+}
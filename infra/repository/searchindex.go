@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Scores of a word of the search compared with a word of the names.
+const (
+	exactScore  = 1.0
+	prefixScore = 0.9
+	typoScore   = 0.8 // minus typoPenalty for every typo
+	typoPenalty = 0.15
+)
+
+// playerIndex finds players by their names ignoring case and accents and tolerating
+// typos. It keeps the words of the names of every player and the trigrams of those
+// words, a search only compares the players sharing a trigram with it.
+type playerIndex struct {
+	mu       sync.RWMutex
+	words    map[domain.Key][]string
+	names    map[domain.Key]string
+	trigrams map[string]map[domain.Key]struct{}
+}
+
+// scoredID is a player found by the index.
+type scoredID struct {
+	id    domain.Key
+	score float64
+}
+
+// newPlayerIndex creates an index with the given players, archived ones are left out.
+func newPlayerIndex(players ...domain.Player) *playerIndex {
+	index := &playerIndex{
+		words:    make(map[domain.Key][]string),
+		names:    make(map[domain.Key]string),
+		trigrams: make(map[string]map[domain.Key]struct{}),
+	}
+	for _, player := range players {
+		index.put(player)
+	}
+	return index
+}
+
+// put adds the player or replaces its names, an archived player is removed.
+func (x *playerIndex) put(player domain.Player) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(player.ID)
+	if player.Archived {
+		return
+	}
+	words := searchWords(player.Names)
+	x.words[player.ID] = words
+	x.names[player.ID] = player.Names
+	for _, word := range words {
+		for _, trigram := range trigrams(word) {
+			if x.trigrams[trigram] == nil {
+				x.trigrams[trigram] = make(map[domain.Key]struct{})
+			}
+			x.trigrams[trigram][player.ID] = struct{}{}
+		}
+	}
+}
+
+// delete removes the player with the given id.
+func (x *playerIndex) delete(id domain.Key) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+// remove removes the player with the given id, the caller holds the lock.
+func (x *playerIndex) remove(id domain.Key) {
+	for _, word := range x.words[id] {
+		for _, trigram := range trigrams(word) {
+			delete(x.trigrams[trigram], id)
+			if len(x.trigrams[trigram]) == 0 {
+				delete(x.trigrams, trigram)
+			}
+		}
+	}
+	delete(x.words, id)
+	delete(x.names, id)
+}
+
+// search returns the players whose names match every word of the text, the best
+// matches first and at most limit of them.
+func (x *playerIndex) search(text string, limit int) []scoredID {
+	words := searchWords(text)
+	if len(words) == 0 {
+		return nil
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	candidates := make(map[domain.Key]struct{})
+	for _, word := range words {
+		for _, trigram := range trigrams(word) {
+			for id := range x.trigrams[trigram] {
+				candidates[id] = struct{}{}
+			}
+		}
+	}
+	result := make([]scoredID, 0, len(candidates))
+	for id := range candidates {
+		if score := matchScore(words, x.words[id]); score > 0 {
+			result = append(result, scoredID{id: id, score: score})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].score != result[j].score {
+			return result[i].score > result[j].score
+		}
+		if x.names[result[i].id] != x.names[result[j].id] {
+			return x.names[result[i].id] < x.names[result[j].id]
+		}
+		return result[i].id < result[j].id
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// matchScore returns the average score of the words of the search, each one compared
+// with its best word of the names. It is zero if any of them doesn't match.
+func matchScore(search, names []string) float64 {
+	var total float64
+	for _, word := range search {
+		var best float64
+		for _, name := range names {
+			if score := wordScore(word, name); score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total / float64(len(search))
+}
+
+// wordScore compares a word of the search with a word of the names.
+func wordScore(search, name string) float64 {
+	switch {
+	case search == name:
+		return exactScore
+	case strings.HasPrefix(name, search):
+		return prefixScore
+	}
+	allowed := allowedTypos(search)
+	if allowed == 0 {
+		return 0
+	}
+	// a typo can be at the end of a word that is not complete yet
+	typos := editDistance(search, name)
+	if length := len([]rune(search)); len([]rune(name)) > length {
+		if prefix := editDistance(search, string([]rune(name)[:length])); prefix < typos {
+			typos = prefix
+		}
+	}
+	if typos > allowed {
+		return 0
+	}
+	return typoScore - typoPenalty*float64(typos-1)
+}
+
+// allowedTypos is the number of typos a word of the search can have, short words have
+// to be written right.
+func allowedTypos(word string) int {
+	switch length := len([]rune(word)); {
+	case length < 4:
+		return 0
+	case length < 7:
+		return 1
+	}
+	return 2
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and swaps of
+// two adjacent letters that turn a into b.
+func editDistance(a, b string) int {
+	left, right := []rune(a), []rune(b)
+	// rows i-2, i-1 and i of the distances between the prefixes
+	previous2 := make([]int, len(right)+1)
+	previous := make([]int, len(right)+1)
+	current := make([]int, len(right)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(left); i++ {
+		current[0] = i
+		for j := 1; j <= len(right); j++ {
+			cost := 1
+			if left[i-1] == right[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && left[i-1] == right[j-2] && left[i-2] == right[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(right)]
+}
+
+// trigrams returns the groups of three letters of the word, its beginning and end are
+// marked so short words have trigrams too.
+func trigrams(word string) []string {
+	letters := []rune("  " + word + " ")
+	result := make([]string, 0, len(letters)-2)
+	for index := 0; index+3 <= len(letters); index++ {
+		result = append(result, string(letters[index:index+3]))
+	}
+	return result
+}
+
+// searchWords splits the text into lower case words without accents.
+func searchWords(text string) []string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+	if err != nil {
+		folded = text
+	}
+	return strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchResults returns the players found by the index, find reads each one from the
+// repository. Players that are no longer stored or were archived are left out, the index
+// may not know it yet.
+func searchResults(found []scoredID, find func(id domain.Key) (domain.Player, error)) ([]domain.SearchResult, error) {
+	result := make([]domain.SearchResult, 0, len(found))
+	for _, match := range found {
+		player, err := find(match.id)
+		if err != nil {
+			return nil, err
+		}
+		if player.ID == "" || player.Archived {
+			continue
+		}
+		result = append(result, domain.SearchResult{Player: player, Score: match.score})
+	}
+	return result, nil
+}
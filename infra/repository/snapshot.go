@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// ErrSnapshotCorrupted is returned when the players of a snapshot don't match its checksum.
+var ErrSnapshotCorrupted = errors.New("snapshot of players is corrupted")
+
+// snapshotFormat is the version of the format of the snapshot files.
+const snapshotFormat = 1
+
+// snapshotFile is the content of a snapshot file, the checksum is the sha256 of the json
+// of the players as it is written.
+type snapshotFile struct {
+	Format   int             `json:"format"`
+	Taken    time.Time       `json:"taken"`
+	Checksum string          `json:"checksum"`
+	Players  json.RawMessage `json:"players"`
+}
+
+// snapshotMemory is a repository on memory that writes its players to a snapshot file
+// every interval and when it is closed, and reads them from it when it is created. The
+// matches are not written, they are lost when the service stops.
+type snapshotMemory struct {
+	*dbMemory
+	path    string
+	saved   uint64 // changes of the data in the last snapshot
+	writing sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewPlayerRepositoryOnMemoryWithSnapshots creates a repository on memory with the
+// players of the snapshot on the given path, if there is one, and writes a new snapshot
+// on it every interval if the players changed, and when it is closed. An interval of
+// zero only writes it when it is closed.
+func NewPlayerRepositoryOnMemoryWithSnapshots(path string, interval time.Duration) (domain.PlayerRepository, error) {
+	log.Infof("creating on memory repository for players with snapshots on %s every %s", path, interval)
+	players, err := readSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	db := &dbMemory{
+		data:    make(map[domain.Key]domain.Player, len(players)),
+		matches: make(map[domain.Key]domain.MatchReport),
+		index:   newPlayerIndex(players...),
+	}
+	for _, player := range players {
+		db.data[player.ID] = player
+	}
+	repo := &snapshotMemory{
+		dbMemory: db,
+		path:     path,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go repo.run(interval)
+	log.Infof("%d players were restored from snapshot %s", len(players), path)
+	return repo, nil
+}
+
+// Close stops the periodic snapshots and writes the last one.
+func (s *snapshotMemory) Close() error {
+	var err error
+	s.once.Do(func() {
+		log.Info("closing on memory repository for players")
+		close(s.stop)
+		<-s.stopped
+		err = s.snapshot()
+	})
+	return err
+}
+
+// run writes a snapshot every interval until the repository is closed.
+func (s *snapshotMemory) run(interval time.Duration) {
+	defer close(s.stopped)
+	if interval <= 0 {
+		<-s.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.snapshot(); err != nil { // just the logs, the next one may work
+				log.Errorf("snapshot of players cannot be written: %s", err.Error())
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// snapshot writes the committed players to the snapshot file if they changed since the
+// last one. A transaction holds the lock until it finishes, so its changes are written
+// entirely or not at all.
+func (s *snapshotMemory) snapshot() error {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+	s.mu.RLock()
+	changes := s.changes
+	if changes == s.saved {
+		s.mu.RUnlock()
+		return nil
+	}
+	players := make([]domain.Player, 0, len(s.data))
+	for _, player := range s.data {
+		players = append(players, player)
+	}
+	s.mu.RUnlock()
+	if err := writeSnapshot(s.path, players); err != nil {
+		return err
+	}
+	s.saved = changes
+	log.Infof("snapshot of %d players was written on %s", len(players), s.path)
+	return nil
+}
+
+// writeSnapshot writes the players on a temporary file next to the path and renames it
+// to the path once it is synced, so the snapshot is never left half written.
+func writeSnapshot(path string, players []domain.Player) error {
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	data, err := json.Marshal(players)
+	if err != nil {
+		return errors.Wrap(err, "players cannot be written on the snapshot")
+	}
+	sum := sha256.Sum256(data)
+	content, err := json.Marshal(snapshotFile{
+		Format:   snapshotFormat,
+		Taken:    time.Now().UTC(),
+		Checksum: hex.EncodeToString(sum[:]),
+		Players:  data,
+	})
+	if err != nil {
+		return errors.Wrap(err, "players cannot be written on the snapshot")
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "snapshot file cannot be created")
+	}
+	defer os.Remove(temp.Name()) // it fails once the file is renamed
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		return errors.Wrap(err, "snapshot file cannot be written")
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return errors.Wrap(err, "snapshot file cannot be synced")
+	}
+	if err := temp.Close(); err != nil {
+		return errors.Wrap(err, "snapshot file cannot be closed")
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return errors.Wrap(err, "snapshot file cannot be replaced")
+	}
+	return nil
+}
+
+// readSnapshot reads the players of the snapshot on the given path, there are none if
+// the file doesn't exist.
+func readSnapshot(path string) ([]domain.Player, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Infof("there is not any snapshot of players on %s", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "snapshot %s cannot be read", path)
+	}
+	var file snapshotFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, errors.Wrapf(ErrSnapshotCorrupted, "snapshot %s cannot be decoded: %s", path, err)
+	}
+	if file.Format != snapshotFormat {
+		return nil, errors.Errorf("snapshot %s has format %d, only %d can be read", path, file.Format, snapshotFormat)
+	}
+	sum := sha256.Sum256(file.Players)
+	if hex.EncodeToString(sum[:]) != file.Checksum {
+		log.Errorf("checksum of snapshot %s is %x, but it must be %s", path, sum, file.Checksum)
+		return nil, errors.Wrapf(ErrSnapshotCorrupted, "checksum of snapshot %s doesn't match", path)
+	}
+	var players []domain.Player
+	if err := json.Unmarshal(file.Players, &players); err != nil {
+		return nil, errors.Wrapf(ErrSnapshotCorrupted, "players of snapshot %s cannot be decoded: %s", path, err)
+	}
+	return players, nil
+}
@@ -0,0 +1,128 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+	"github.com/pkg/errors"
+)
+
+func TestSnapshotPlayersSurviveReopening(t *testing.T) {
+	// given players stored on memory, one of them archived, and a rolled back change
+	dir := t.TempDir()
+	path := filepath.Join(dir, "players.snapshot")
+	repo := newSnapshotRepository(t, path, 0)
+	malong, archived := domain.NewPlayer("Ma Long"), domain.NewPlayer("Zhang Yining")
+	saveAPlayer(t, repo, malong)
+	saveAPlayer(t, repo, archived)
+	assertNoError(t, repo.RecordMatchResult(context.TODO(), malong.ID, archived.ID, 1, 1))
+	assertNoError(t, repo.Archive(context.TODO(), archived.ID))
+	rolledback := domain.NewPlayer("Timo Boll")
+	err := domain.RunInTransaction(context.TODO(), repo, func(ctx context.Context) error {
+		assertNoError(t, repo.Save(ctx, rolledback))
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("transaction was expected to be rolled back")
+	}
+	closeRepository(t, repo)
+
+	// when the repository is created again from the snapshot
+	reopened := newSnapshotRepository(t, path, 0)
+
+	// then the committed players keep their data
+	got := findPlayer(t, reopened, malong.ID)
+	if got.Names != malong.Names || got.Wins != 1 || got.Version != malong.Version+1 {
+		t.Errorf("player %+v with 1 win was expected, but got: %+v", malong, got)
+	}
+	if got := findPlayer(t, reopened, archived.ID); !got.Archived || got.Losses != 1 {
+		t.Errorf("player %s was expected archived with 1 loss, but got: %+v", archived.ID, got)
+	}
+	if got := findPlayer(t, reopened, rolledback.ID); got.ID != "" {
+		t.Errorf("rolled back player must not be restored, but got: %+v", got)
+	}
+	// and only the active ones can be searched
+	found, err := reopened.Search(context.TODO(), "zhang long", 0)
+	assertNoError(t, err)
+	if len(found) != 0 {
+		t.Errorf("no player was expected with both names, but got: %+v", found)
+	}
+	found, err = reopened.Search(context.TODO(), "long", 0)
+	assertNoError(t, err)
+	if len(found) != 1 || found[0].Player.ID != malong.ID {
+		t.Errorf("player %s was expected to be found, but got: %+v", malong.ID, found)
+	}
+	// and the temporary files were renamed
+	files, err := os.ReadDir(dir)
+	assertNoError(t, err)
+	if len(files) != 1 || files[0].Name() != "players.snapshot" {
+		t.Errorf("only the snapshot was expected, but got: %v", files)
+	}
+}
+
+func TestSnapshotIsWrittenEveryInterval(t *testing.T) {
+	// given a repository that writes snapshots every few milliseconds
+	path := filepath.Join(t.TempDir(), "players.snapshot")
+	repo := newSnapshotRepository(t, path, 5*time.Millisecond)
+
+	// when a player is stored
+	newplayer := domain.NewPlayer("Ma Long")
+	saveAPlayer(t, repo, newplayer)
+
+	// then it is on the snapshot before the repository is closed
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("snapshot %s was not written", path)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	restored := newSnapshotRepository(t, path, 0)
+	if got := findPlayer(t, restored, newplayer.ID); got.Names != newplayer.Names {
+		t.Errorf("player %+v was expected on the snapshot, but got: %+v", newplayer, got)
+	}
+}
+
+func TestCorruptedSnapshotIsRefused(t *testing.T) {
+	// given a snapshot with a player
+	path := filepath.Join(t.TempDir(), "players.snapshot")
+	repo := newSnapshotRepository(t, path, 0)
+	saveAPlayer(t, repo, domain.NewPlayer("Ma Long"))
+	closeRepository(t, repo)
+	content, err := os.ReadFile(path)
+	assertNoError(t, err)
+
+	tests := map[string][]byte{
+		"changed player": bytes.Replace(content, []byte("Ma Long"), []byte("Ma Lung"), 1),
+		"truncated":      content[:len(content)/2],
+	}
+	for name, corrupted := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when the snapshot is corrupted
+			assertNoError(t, os.WriteFile(path, corrupted, 0o600))
+
+			// then the repository cannot be created from it
+			_, err := repository.NewPlayerRepositoryOnMemoryWithSnapshots(path, 0)
+			if errors.Cause(err) != repository.ErrSnapshotCorrupted {
+				t.Errorf("error %q was expected, but got: %v", repository.ErrSnapshotCorrupted, err)
+			}
+		})
+	}
+}
+
+func newSnapshotRepository(t *testing.T, path string, interval time.Duration) domain.PlayerRepository {
+	t.Helper()
+	repo, err := repository.NewPlayerRepositoryOnMemoryWithSnapshots(path, interval)
+	assertNoError(t, err)
+	t.Cleanup(func() { closeRepository(t, repo) })
+	return repo
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// winRatioColumn computes the win ratio of the players like Player.WinRatio does.
+const winRatioColumn = `(CASE WHEN wins + losses = 0 THEN 0.0 ELSE CAST(wins AS REAL) / (wins + losses) END)`
+
+// sortColumns are the expressions of the fields players are sorted by.
+var sortColumns = map[domain.SortField]string{
+	domain.SortByNames:    "names",
+	domain.SortByWins:     "wins",
+	domain.SortByLosses:   "losses",
+	domain.SortByRating:   "rating",
+	domain.SortByWinRatio: winRatioColumn,
+	domain.SortByCreated:  "created",
+	domain.SortByUpdated:  "updated",
+}
+
+// playerFilters returns the where clause with the filters of the query and its arguments.
+func playerFilters(query domain.PlayerQuery) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	if !query.IncludeArchived {
+		add(`archived = 0`)
+	}
+	if query.MinWins != nil {
+		add(`wins >= ?`, *query.MinWins)
+	}
+	if query.MaxWins != nil {
+		add(`wins <= ?`, *query.MaxWins)
+	}
+	if query.MinWinRatio != nil {
+		add(winRatioColumn+` >= ?`, *query.MinWinRatio)
+	}
+	if query.MaxWinRatio != nil {
+		add(winRatioColumn+` <= ?`, *query.MaxWinRatio)
+	}
+	if !query.CreatedFrom.IsZero() {
+		add(`created >= ?`, formatTime(query.CreatedFrom))
+	}
+	if !query.CreatedTo.IsZero() {
+		add(`created < ?`, formatTime(query.CreatedTo))
+	}
+	if query.NamesPrefix != "" {
+		// like ignores the case, substr compares the characters as they are
+		add(`substr(names, 1, ?) = ?`, utf8.RuneCountInString(query.NamesPrefix), query.NamesPrefix)
+	}
+	if query.Profile.Style != "" {
+		add(`style = ?`, string(query.Profile.Style))
+	}
+	if query.Profile.Handedness != "" {
+		add(`handedness = ?`, string(query.Profile.Handedness))
+	}
+	if query.Profile.Grip != "" {
+		add(`grip = ?`, string(query.Profile.Grip))
+	}
+	where := ""
+	for _, condition := range conditions {
+		where = appendCondition(where, condition)
+	}
+	return where, args
+}
+
+// appendCondition adds the condition to the where clause.
+func appendCondition(where, condition string) string {
+	if where == "" {
+		return ` WHERE ` + condition
+	}
+	return where + ` AND ` + condition
+}
+
+// orderBy returns the order by clause of the sort keys, the id sorts the players with
+// the same values.
+func orderBy(keys []domain.SortKey) string {
+	columns := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		column := sortColumns[key.Field]
+		if key.Descending {
+			column += ` DESC`
+		}
+		columns = append(columns, column)
+	}
+	columns = append(columns, `id`)
+	return ` ORDER BY ` + strings.Join(columns, ", ")
+}
+
+// afterCursor returns the condition that selects the players sorted after the given
+// one, for sort keys a and b it is: a > ? OR (a = ? AND b > ?) OR (a = ? AND b = ? AND id > ?)
+func afterCursor(keys []domain.SortKey, after domain.Player) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+	var equals []string
+	var equalArgs []interface{}
+	for _, key := range keys {
+		column, value := sortColumns[key.Field], sortValue(key.Field, after)
+		operator := ` > ?`
+		if key.Descending {
+			operator = ` < ?`
+		}
+		alternatives = append(alternatives, `(`+strings.Join(append(equals, column+operator), " AND ")+`)`)
+		args = append(append(args, equalArgs...), value)
+		equals = append(equals, column+` = ?`)
+		equalArgs = append(equalArgs, value)
+	}
+	alternatives = append(alternatives, `(`+strings.Join(append(equals, `id > ?`), " AND ")+`)`)
+	args = append(append(args, equalArgs...), string(after.ID))
+	return `(` + strings.Join(alternatives, " OR ") + `)`, args
+}
+
+// sortValue returns the value of the field the way it is stored on the database.
+func sortValue(field domain.SortField, player domain.Player) interface{} {
+	value := field.Value(player)
+	if date, ok := value.(time.Time); ok {
+		return formatTime(date)
+	}
+	return value
+}
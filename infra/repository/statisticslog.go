@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/pkg/errors"
+)
+
+// ErrStatisticsLogCorrupted is returned when an entry of the statistics log cannot be
+// read or it is out of sequence.
+var ErrStatisticsLogCorrupted = errors.New("statistics log is corrupted")
+
+// fileStatisticsLog keeps the statistics log on a file with a json entry on every line,
+// entries are only appended to it.
+type fileStatisticsLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64  // bytes of the complete entries of the file
+	last uint64 // sequence of the last entry
+}
+
+// NewStatisticsLogOnFile opens the statistics log of the given file, it is created if it
+// doesn't exist. Every entry is checked, and an incomplete last line, left by a crash in
+// the middle of an append, is removed.
+func NewStatisticsLogOnFile(path string) (domain.StatisticsLog, error) {
+	log.Infof("opening statistics log on file %s", path)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "statistics log %s cannot be opened", path)
+	}
+	statistics := &fileStatisticsLog{path: path, file: file}
+	err = readStatisticsEntries(file, -1, func(entry domain.StatisticsEntry, end int64) error {
+		statistics.last, statistics.size = entry.Sequence, end
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "statistics log %s cannot be read", path)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "statistics log %s cannot be read", path)
+	}
+	if info.Size() > statistics.size {
+		log.Warnf("statistics log %s ends with an incomplete entry of %d bytes, it is removed", path, info.Size()-statistics.size)
+		if err := file.Truncate(statistics.size); err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "incomplete entry of statistics log %s cannot be removed", path)
+		}
+	}
+	log.Infof("statistics log %s has %d entries", path, statistics.last)
+	return statistics, nil
+}
+
+// Append writes the entry at the end of the file and syncs it. If it cannot be written
+// entirely the file is truncated to the previous entry.
+func (f *fileStatisticsLog) Append(ctx context.Context, entry *domain.StatisticsEntry) error {
+	if err := checkContext(ctx, "Could not finish the append to the statistics log at time"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	appended := *entry
+	appended.Sequence = f.last + 1
+	appended.Recorded = time.Now().UTC()
+	line, err := json.Marshal(appended)
+	if err != nil {
+		return errors.Wrap(err, "statistics entry cannot be encoded")
+	}
+	line = append(line, '\n')
+	if _, err := f.file.Write(line); err != nil {
+		f.discard()
+		return errors.Wrapf(err, "statistics entry cannot be appended to %s", f.path)
+	}
+	if err := f.file.Sync(); err != nil {
+		f.discard()
+		return errors.Wrapf(err, "statistics entry cannot be synced to %s", f.path)
+	}
+	f.last, f.size = appended.Sequence, f.size+int64(len(line))
+	*entry = appended
+	return nil
+}
+
+// Replay reads the entries of the file, the ones appended while it runs are not replayed.
+func (f *fileStatisticsLog) Replay(ctx context.Context, fn func(entry domain.StatisticsEntry) error) error {
+	f.mu.Lock()
+	size := f.size
+	f.mu.Unlock()
+	file, err := os.Open(f.path)
+	if err != nil {
+		return errors.Wrapf(err, "statistics log %s cannot be opened", f.path)
+	}
+	defer file.Close()
+	return readStatisticsEntries(file, size, func(entry domain.StatisticsEntry, _ int64) error {
+		if err := checkContext(ctx, "Could not finish the replay of the statistics log at time"); err != nil {
+			return err
+		}
+		return fn(entry)
+	})
+}
+
+// Close closes the file of the log.
+func (f *fileStatisticsLog) Close() error {
+	log.Infof("closing statistics log %s", f.path)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// discard truncates the file to its last complete entry, the caller holds the lock.
+func (f *fileStatisticsLog) discard() {
+	if err := f.file.Truncate(f.size); err != nil { // just the logs, it is removed when the log is opened again
+		log.Errorf("incomplete entry of statistics log %s cannot be removed: %s", f.path, err)
+	}
+}
+
+// readStatisticsEntries calls fn with every complete line of the reader, up to size bytes
+// or all of them when it is negative, and the offset where the line ends. The entries
+// must come in sequence from 1.
+func readStatisticsEntries(reader io.Reader, size int64, fn func(entry domain.StatisticsEntry, end int64) error) error {
+	if size >= 0 {
+		reader = io.LimitReader(reader, size)
+	}
+	buffered := bufio.NewReader(reader)
+	var offset int64
+	var sequence uint64
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // a line without its end is an incomplete entry
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		var entry domain.StatisticsEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return errors.Wrapf(ErrStatisticsLogCorrupted, "entry %d cannot be decoded: %s", sequence+1, err)
+		}
+		if sequence++; entry.Sequence != sequence {
+			return errors.Wrapf(ErrStatisticsLogCorrupted, "entry %d was expected, but got %d", sequence, entry.Sequence)
+		}
+		if err := fn(entry, offset); err != nil {
+			return err
+		}
+	}
+}
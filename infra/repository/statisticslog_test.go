@@ -0,0 +1,90 @@
+package repository_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/infra/repository"
+	"github.com/pkg/errors"
+)
+
+func TestStatisticsLogSurvivesReopening(t *testing.T) {
+	// given a log file with two entries and an incomplete one left by a crash
+	path := filepath.Join(t.TempDir(), "statistics.log")
+	statistics := newStatisticsLog(t, path)
+	appendEntry(t, statistics, domain.NewMatchResultEntry("match1", "malong", "fan", 1, 1))
+	appendEntry(t, statistics, domain.NewMatchResultEntry("match2", "fan", "malong", 1, 1))
+	closeStatisticsLog(t, statistics)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assertNoError(t, err)
+	_, err = file.WriteString(`{"sequence":3,"kind":"ma`)
+	assertNoError(t, err)
+	assertNoError(t, file.Close())
+
+	// when it is opened again and a new entry is appended
+	reopened := newStatisticsLog(t, path)
+	entry := domain.NewMatchResultEntry("match3", "malong", "fan", 1, 1)
+	appendEntry(t, reopened, entry)
+
+	// then the incomplete entry is replaced and the sequence goes on
+	if entry.Sequence != 3 || entry.Recorded.IsZero() {
+		t.Errorf("entry 3 was expected with its record date, but got: %+v", entry)
+	}
+	var matches []domain.Key
+	assertNoError(t, reopened.Replay(context.TODO(), func(entry domain.StatisticsEntry) error {
+		matches = append(matches, entry.MatchID)
+		return nil
+	}))
+	if len(matches) != 3 || matches[0] != "match1" || matches[2] != "match3" {
+		t.Errorf("matches 1, 2 and 3 were expected, but got: %v", matches)
+	}
+	projection, err := domain.ProjectStatistics(context.TODO(), reopened)
+	assertNoError(t, err)
+	if got := projection["malong"]; got.Wins != 2 || got.Losses != 1 {
+		t.Errorf("2 wins and 1 loss were expected for malong, but got: %+v", got)
+	}
+}
+
+func TestCorruptedStatisticsLogIsRefused(t *testing.T) {
+	tests := map[string]string{
+		"not json":        "{\"sequence\":1,\"kind\":\"match\"}\nnot json\n",
+		"out of sequence": "{\"sequence\":1,\"kind\":\"match\"}\n{\"sequence\":3,\"kind\":\"match\"}\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			// given a log file with a complete entry that is not valid
+			path := filepath.Join(t.TempDir(), "statistics.log")
+			assertNoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+			// when it is opened
+			_, err := repository.NewStatisticsLogOnFile(path)
+
+			// then it is refused
+			if errors.Cause(err) != repository.ErrStatisticsLogCorrupted {
+				t.Errorf("error %q was expected, but got: %v", repository.ErrStatisticsLogCorrupted, err)
+			}
+		})
+	}
+}
+
+func newStatisticsLog(t *testing.T, path string) domain.StatisticsLog {
+	t.Helper()
+	statistics, err := repository.NewStatisticsLogOnFile(path)
+	assertNoError(t, err)
+	t.Cleanup(func() { statistics.(io.Closer).Close() })
+	return statistics
+}
+
+func appendEntry(t *testing.T, statistics domain.StatisticsLog, entry *domain.StatisticsEntry) {
+	t.Helper()
+	assertNoError(t, statistics.Append(context.TODO(), entry))
+}
+
+func closeStatisticsLog(t *testing.T, statistics domain.StatisticsLog) {
+	t.Helper()
+	assertNoError(t, statistics.(io.Closer).Close())
+}
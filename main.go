@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/fernandoocampo/thepingthepong/application/authapp"
+	"github.com/fernandoocampo/thepingthepong/application/feedapp"
 	"github.com/fernandoocampo/thepingthepong/application/matchapp"
 	"github.com/fernandoocampo/thepingthepong/application/playerapp"
+	"github.com/fernandoocampo/thepingthepong/application/webhookapp"
 	"github.com/fernandoocampo/thepingthepong/common/logging"
 	"github.com/fernandoocampo/thepingthepong/domain"
 	"github.com/fernandoocampo/thepingthepong/infra/repository"
@@ -22,28 +29,27 @@ func init() {
 	loadConfiguration()
 	// initialize logger
 	initLogger()
-	// initialize inversion of control
-	initIoC()
 }
 
 func loadConfiguration() {
 	domain.LoadConfiguration("conf/")
 }
 
-// initLogger Initialize logger
+// initLogger Initialize logger, its messages go to the standard error so they are not
+// mixed with the output of the subcommands.
 func initLogger() {
-	fmt.Println("... starting thepingthepong service logger")
-	fmt.Println()
+	fmt.Fprintln(os.Stderr, "... starting thepingthepong service logger")
+	fmt.Fprintln(os.Stderr)
 	loglevelval := domain.Configuration.Log.Main.Level
 	if loglevelval == "" {
-		fmt.Println("You have not defined the log level for main log, so warn will be used instead")
-		fmt.Println()
+		fmt.Fprintln(os.Stderr, "You have not defined the log level for main log, so warn will be used instead")
+		fmt.Fprintln(os.Stderr)
 		loglevelval = "Warn"
 	}
 
 	logformatval := domain.Configuration.Log.Main.Format
 	if logformatval == "" {
-		fmt.Println("You have not defined the log format for main log, so json will be used instead")
+		fmt.Fprintln(os.Stderr, "You have not defined the log format for main log, so json will be used instead")
 		logformatval = "json"
 	}
 
@@ -52,13 +58,13 @@ func initLogger() {
 		LogFormat: logformatval,
 		LogFields: logrus.Fields{"pkg": "main", "srv": "thepingthepong"},
 	}
-	fmt.Printf("\n%+v\n", options)
-	fmt.Println()
+	fmt.Fprintf(os.Stderr, "\n%+v\n", options)
+	fmt.Fprintln(os.Stderr)
 	var err error
 	// load log for dao package
 	log, err = logging.NewLogger(options)
 	if err != nil {
-		fmt.Printf("cant load logger: %v", err)
+		fmt.Fprintf(os.Stderr, "cant load logger: %v", err)
 		os.Exit(1)
 	}
 	// initializes log for all modules
@@ -67,24 +73,124 @@ func initLogger() {
 	repository.InitLog(domain.Configuration.Log.Repository)
 	matchapp.InitLog(domain.Configuration.Log.Matchapp)
 	playerapp.InitLog(domain.Configuration.Log.Playerapp)
+	feedapp.InitLog(domain.Configuration.Log.Feedapp)
+	webhookapp.InitLog(domain.Configuration.Log.Webhookapp)
 
 }
 
 // initIoC initializes the dao and service used service and controller.
 func initIoC() {
 	// initialize repository layer
-	repo := repository.NewPlayerRepositoryOnMemory(5)
+	repo := newPlayerRepository(domain.Configuration.Storage)
+	statistics := newStatisticsLog(domain.Configuration.Storage)
 	// initialize application layer
-	playerService := playerapp.NewBasicPlayerService(&repo)
-	matchService := matchapp.NewBasicMatchService(playerService)
+	bus := domain.NewEventBus()
+	feedService := feedapp.NewRingFeed(domain.Configuration.Feed.Capacity)
+	playerService := playerapp.NewBasicPlayerServiceWithStatistics(&repo, bus, statistics)
+	// statistics stored before the log was enabled are its first entries
+	if _, err := playerService.SeedStatistics(context.Background()); err != nil {
+		log.Fatalf("statistics log cannot be seeded: %s", err)
+	}
+	matches, err := repository.NewMatchRepositoryOn(repo)
+	if err != nil {
+		log.Fatalf("match repository cannot be created: %s", err)
+	}
+	matchService := matchapp.NewBasicMatchServiceWithBus(playerService, domain.Configuration.Match, bus, repo, matches)
+	// matches in background stop before their storages are closed
+	go closeOnSignal(matchService, repo, statistics)
+	// subscribers of the events
+	bus.Subscribe(domain.MatchPlayedEvent, playerapp.StatisticsHandler(playerService))
+	feedapp.Subscribe(bus, feedService)
 	authservice := authapp.NewBasicAuthenticator()
+	webhookService := webhookapp.NewBasicWebhookService(domain.Configuration.Webhook)
+	// webhook deliveries, retries included, stop when the service is interrupted or terminated
+	following, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go webhookService.Follow(following, feedService)
 	// initialize port layer
 	// initialize rest handler
 	playerhandler := port.NewPlayerRestHandler(playerService)
 	matchhandler := port.NewMatchRestHandler(matchService)
 	authhandler := port.NewBasicAuthRestHandler(authservice)
+	eventhandler := port.NewEventRestHandler(feedService)
+	webhookhandler := port.NewWebhookRestHandler(webhookService)
 	// initialize web server
-	webserver = port.NewWebServer(playerhandler, matchhandler, authhandler)
+	webserver = port.NewWebServer(playerhandler, matchhandler, authhandler, eventhandler, webhookhandler)
+}
+
+// newPlayerRepository creates the player repository of the configured backend, with a
+// cache in front of it when it is configured. The statistics of the cache are published
+// as the playercache variable of /debug/vars.
+func newPlayerRepository(setting domain.StorageSetting) domain.PlayerRepository {
+	repo := newPlayerRepositoryOn(setting)
+	if setting.CacheSize <= 0 {
+		return repo
+	}
+	cached := repository.NewCachedPlayerRepository(repo, setting.CacheSize, setting.CacheTTL)
+	expvar.Publish("playercache", expvar.Func(func() interface{} { return cached.Stats() }))
+	return cached
+}
+
+// newPlayerRepositoryOn creates the player repository of the configured backend.
+func newPlayerRepositoryOn(setting domain.StorageSetting) domain.PlayerRepository {
+	switch setting.Backend {
+	case "", "memory":
+		if setting.SnapshotPath == "" {
+			return repository.NewPlayerRepositoryOnMemory(5)
+		}
+		repo, err := repository.NewPlayerRepositoryOnMemoryWithSnapshots(setting.SnapshotPath, setting.SnapshotInterval)
+		if err != nil {
+			log.Fatalf("memory player repository cannot be restored: %s", err)
+		}
+		return repo
+	case "sqlite":
+		repo, err := repository.NewPlayerRepositoryOnSQLite(setting.SQLitePath)
+		if err != nil {
+			log.Fatalf("sqlite player repository cannot be created: %s", err)
+		}
+		return repo
+	case "bolt":
+		repo, err := repository.NewPlayerRepositoryOnBolt(setting.BoltPath)
+		if err != nil {
+			log.Fatalf("bbolt player repository cannot be created: %s", err)
+		}
+		return repo
+	default:
+		log.Fatalf("storage backend %q is not supported, it must be memory, sqlite or bolt", setting.Backend)
+		return nil
+	}
+}
+
+// newStatisticsLog opens the statistics log of the configured file, or creates one on
+// memory when there is no file.
+func newStatisticsLog(setting domain.StorageSetting) domain.StatisticsLog {
+	if setting.StatisticsLog == "" {
+		return domain.NewMemoryStatisticsLog()
+	}
+	statistics, err := repository.NewStatisticsLogOnFile(setting.StatisticsLog)
+	if err != nil {
+		log.Fatalf("statistics log cannot be opened: %s", err)
+	}
+	return statistics
+}
+
+// closeOnSignal closes the given services and storages in order and exits when the
+// service is interrupted or terminated, so the last snapshot of the players on memory is
+// written.
+func closeOnSignal(storages ...interface{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	received := <-signals
+	log.Infof("stopping thepingthepong service because of signal %s", received)
+	code := 0
+	for _, storage := range storages {
+		if closer, ok := storage.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Errorf("%T cannot be closed: %s", storage, err)
+				code = 1
+			}
+		}
+	}
+	os.Exit(code)
 }
 
 // initHTTPServer start webserver on the configuration parameter host.
@@ -102,5 +208,13 @@ func initHTTPServer() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "players" {
+		os.Exit(runPlayers(os.Args[2:]))
+	}
+	// initialize inversion of control
+	initIoC()
 	initHTTPServer()
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fernandoocampo/thepingthepong/application/playerapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// playersUsage explains the players subcommand.
+const playersUsage = `usage: thepingthepong players import [-format csv|ndjson] [-dry-run] FILE|-
+       thepingthepong players export [-format csv|ndjson] [-o FILE]
+       thepingthepong players rebuild [-force]
+
+  import   creates the players of the file, - reads them from the standard input
+  export   writes every player that is not archived, to the standard output by default
+  rebuild  stores on every player the wins and losses of the statistics log, -force to
+           rebuild them from a log without entries`
+
+// runPlayers runs the players subcommand on the configured storage and returns the exit
+// code. The import and rebuild reports are printed as json, import exits with 1 when a
+// line was not imported.
+func runPlayers(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, playersUsage)
+		return 2
+	}
+	flags := flag.NewFlagSet("players "+args[0], flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, playersUsage) }
+	formatName := flags.String("format", string(playerapp.CSVFormat), "format of the file, csv or ndjson")
+	dryRun, force, output, files := new(bool), new(bool), new(string), 0
+	switch args[0] {
+	case "import":
+		flags.BoolVar(dryRun, "dry-run", false, "validate the players without storing them")
+		files = 1
+	case "export":
+		flags.StringVar(output, "o", "", "file to write the players to")
+	case "rebuild":
+		flags.BoolVar(force, "force", false, "rebuild the statistics from a log without entries")
+	default:
+		fmt.Fprintln(os.Stderr, playersUsage)
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != files {
+		fmt.Fprintln(os.Stderr, playersUsage)
+		return 2
+	}
+	format, err := playerapp.ParseTransferFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	setting := domain.Configuration.Storage
+	if setting.Backend == "" || setting.Backend == "memory" {
+		fmt.Fprintln(os.Stderr, "storage backend memory only keeps the players of the running service, use sqlite or bolt")
+		return 1
+	}
+	repo, statistics := newPlayerRepository(setting), newStatisticsLog(setting)
+	for _, storage := range []interface{}{repo, statistics} {
+		if closer, ok := storage.(io.Closer); ok {
+			defer closer.Close()
+		}
+	}
+	service := playerapp.NewBasicPlayerServiceWithStatistics(&repo, domain.NewEventBus(), statistics)
+	if _, err := service.SeedStatistics(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	switch args[0] {
+	case "import":
+		return importPlayers(service, flags.Arg(0), format, *dryRun)
+	case "rebuild":
+		return rebuildStatistics(service, *force)
+	}
+	return exportPlayers(service, *output, format)
+}
+
+// importPlayers imports the players of the given file, - is the standard input.
+func importPlayers(service playerapp.PlayerService, path string, format playerapp.TransferFormat, dryRun bool) int {
+	input := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+	report, err := service.Import(context.Background(), input, format, dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printReport(report)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// rebuildStatistics rebuilds the statistics of the players from the statistics log.
+func rebuildStatistics(service playerapp.PlayerService, force bool) int {
+	report, err := service.RebuildStatistics(context.Background(), force)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printReport(report)
+	return 0
+}
+
+// printReport prints the given report as indented json.
+func printReport(report interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+// exportPlayers exports the players to the given file, the standard output when it is empty.
+func exportPlayers(service playerapp.PlayerService, path string, format playerapp.TransferFormat) int {
+	if path == "" {
+		if err := service.Export(context.Background(), os.Stdout, format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := service.Export(context.Background(), file, format); err != nil {
+		file.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := file.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
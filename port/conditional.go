@@ -0,0 +1,53 @@
+package port
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/fernandoocampo/thepingthepong/domain"
+)
+
+// headers of conditional requests (RFC 7232)
+const (
+	etag        = "ETag"
+	ifMatch     = "If-Match"
+	ifNoneMatch = "If-None-Match"
+)
+
+// playerETag returns the entity tag of the current version of the player.
+func playerETag(player domain.Player) string {
+	return strconv.Quote(strconv.Itoa(player.Version))
+}
+
+// matchesETag checks that the condition, a comma separated list of entity tags or *,
+// contains the given tag. Weak tags only match with the weak comparison of If-None-Match.
+func matchesETag(condition, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(condition, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifPlayerMatches returns a change that fails with domain.ErrVersionConflict when the
+// player doesn't match the If-Match condition, otherwise it applies the given change.
+func ifPlayerMatches(condition string, change func(player *domain.Player) error) func(player *domain.Player) error {
+	return func(player *domain.Player) error {
+		if !matchesETag(condition, playerETag(*player), false) {
+			log.Warnf("player %s on version %d doesn't match condition %s", player.ID, player.Version, condition)
+			return domain.ErrVersionConflict
+		}
+		return change(player)
+	}
+}
@@ -0,0 +1,17 @@
+package port
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// DebugVars serves the published variables, like the statistics of the cache of players,
+// to the clients with a valid token.
+func DebugVars(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting debug vars handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,84 @@
+package port
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fernandoocampo/thepingthepong/application/feedapp"
+)
+
+const (
+	// lastEventIDHeader is sent by the clients to resume the feed after the event they received
+	lastEventIDHeader = "Last-Event-ID"
+	// keepAliveInterval is how long the feed waits for an event before sending a comment,
+	// so proxies don't close an idle stream
+	keepAliveInterval = 15 * time.Second
+)
+
+// eventRestHandler implements the event handler to stream the feed of events.
+type eventRestHandler struct {
+	service feedapp.FeedService
+}
+
+// NewEventRestHandler creates a rest handler that streams the given feed.
+func NewEventRestHandler(feedService feedapp.FeedService) EventHandler {
+	log.Infof("creating event rest handler")
+	return &eventRestHandler{
+		service: feedService,
+	}
+}
+
+// Events streams the feed of events as server-sent events until the client leaves. The
+// stream resumes after the event in the Last-Event-ID header.
+func (e *eventRestHandler) Events(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting events handler for event rest handler")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Errorf("response writer %T does not support streaming", w)
+		RespondRestWithError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	var lastEventID uint64
+	if value := r.Header.Get(lastEventIDHeader); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			log.Warnf("last event id %q is not valid: %s", value, err.Error())
+			RespondRestWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID header")
+			return
+		}
+		lastEventID = id
+	}
+	subscriber := e.service.Subscribe(lastEventID)
+
+	w.Header().Set(contentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), keepAliveInterval)
+		event, ok := subscriber.Next(ctx)
+		cancel()
+		if r.Context().Err() != nil {
+			log.Infof("client left the feed of events after event %d", lastEventID)
+			return
+		}
+		if !ok {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+			continue
+		}
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			log.Errorf("event %d cannot be encoded: %s", event.ID, err.Error())
+			continue
+		}
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		flusher.Flush()
+		lastEventID = event.ID
+	}
+}
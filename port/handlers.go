@@ -18,6 +18,49 @@ type RestHandler interface {
 	Health(w http.ResponseWriter, r *http.Request)
 }
 
+// PlayerHandler Defines behavior for players in a REST mode.
+type PlayerHandler interface {
+	RestHandler
+	// Patch changes a record with a JSON merge patch
+	Patch(w http.ResponseWriter, r *http.Request)
+	// Search finds the records that match a text
+	Search(w http.ResponseWriter, r *http.Request)
+	// Import creates the records of a file
+	Import(w http.ResponseWriter, r *http.Request)
+	// Export streams all the records in a file
+	Export(w http.ResponseWriter, r *http.Request)
+	// RebuildStatistics recomputes the statistics of the records from their history
+	RebuildStatistics(w http.ResponseWriter, r *http.Request)
+}
+
+// MatchHandler Defines behavior for matches in a REST mode.
+type MatchHandler interface {
+	RestHandler
+	// Preview estimates the outcome of a match without playing it
+	Preview(w http.ResponseWriter, r *http.Request)
+	// Live streams the events of a match while it is played
+	Live(w http.ResponseWriter, r *http.Request)
+	// GetJob returns the status and result of a match played in background
+	GetJob(w http.ResponseWriter, r *http.Request)
+	// CancelJob cancels a match that is waiting to be played in background
+	CancelJob(w http.ResponseWriter, r *http.Request)
+}
+
+// EventHandler Defines behavior to stream the events of the application.
+type EventHandler interface {
+	// Events streams the events as they happen
+	Events(w http.ResponseWriter, r *http.Request)
+}
+
+// WebhookHandler Defines behavior to manage webhook subscriptions in a REST mode.
+type WebhookHandler interface {
+	RestHandler
+	// Deliveries returns the latest delivery attempts of a subscription
+	Deliveries(w http.ResponseWriter, r *http.Request)
+	// DeadLetters returns the events that could not be delivered
+	DeadLetters(w http.ResponseWriter, r *http.Request)
+}
+
 // AuthHandler Defines behavior for authentication and authorization in REST mode.
 type AuthHandler interface {
 	// SignIn authenticates an user
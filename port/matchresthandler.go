@@ -3,16 +3,62 @@ package port
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/fernandoocampo/thepingthepong/application/matchapp"
 	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 )
 
 // newMatch contains data to start a match
 type newMatch struct {
-	Player1ID string `json:"player1ID"`
-	Player2ID string `json:"player2ID"`
+	Player1ID      string          `json:"player1ID"`
+	Player2ID      string          `json:"player2ID"`
+	Player1Tactics *domain.Tactics `json:"player1Tactics,omitempty"`
+	Player2Tactics *domain.Tactics `json:"player2Tactics,omitempty"`
+	Competition    string          `json:"competition,omitempty"`
+	Live           bool            `json:"live,omitempty"`   // true to play the match in background and follow it live
+	Pacing         string          `json:"pacing,omitempty"` // pacing of a live match: realtime, accelerated or instant
+	Async          bool            `json:"async,omitempty"`  // true to queue the match as a job and query it later
+}
+
+// startedLiveMatch tells where to follow a live match
+type startedLiveMatch struct {
+	ID   domain.Key `json:"id"`
+	Live string     `json:"live"` // path of the websocket to follow the match
+}
+
+// upgrader upgrades the connections of the spectators of live matches, any origin is
+// allowed as the web server does for the rest of the api.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// newMatchWithDefaults creates a match request whose tactics are filled with
+// default values, so missing fields in the payload keep them.
+func newMatchWithDefaults() newMatch {
+	tactics1, tactics2 := domain.DefaultTactics(), domain.DefaultTactics()
+	return newMatch{
+		Player1Tactics: &tactics1,
+		Player2Tactics: &tactics2,
+	}
+}
+
+// toMatchSetup converts the match request into a match setup.
+func (n newMatch) toMatchSetup() matchapp.MatchSetup {
+	setup := matchapp.NewMatchSetup(domain.Key(n.Player1ID), domain.Key(n.Player2ID))
+	setup.Competition = n.Competition
+	if n.Player1Tactics != nil {
+		setup.Player1Tactics = *n.Player1Tactics
+	}
+	if n.Player2Tactics != nil {
+		setup.Player2Tactics = *n.Player2Tactics
+	}
+	return *setup
 }
 
 // MatchRestHandler implements rest handler to expose matches logic
@@ -21,7 +67,7 @@ type matchRestHandler struct {
 }
 
 // NewMatchRestHandler creates a basic match rest handler
-func NewMatchRestHandler(matchService matchapp.MatchService) RestHandler {
+func NewMatchRestHandler(matchService matchapp.MatchService) MatchHandler {
 	log.Infof("creating match rest handler")
 	return &matchRestHandler{
 		service: matchService,
@@ -54,7 +100,7 @@ func (m *matchRestHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	var match newMatch
+	match := newMatchWithDefaults()
 	log.Infof("request to play a match is: %v", r.Body)
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&match); err != nil {
@@ -62,18 +108,193 @@ func (m *matchRestHandler) Create(w http.ResponseWriter, r *http.Request) {
 		RespondRestWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	if match.Live && match.Async {
+		log.Warnf("match between %q and %q cannot be live and async", match.Player1ID, match.Player2ID)
+		RespondRestWithError(w, http.StatusBadRequest, "a match cannot be live and async at the same time")
+		return
+	}
+	if match.Live {
+		m.createLive(ctx, w, match)
+		return
+	}
+	if match.Async {
+		m.createJob(ctx, w, match)
+		return
+	}
 	log.Infof("consuming create from service to play a match: %v", match)
-	savedMatch, err := m.service.Play(ctx, domain.Key(match.Player1ID),
-		domain.Key(match.Player2ID))
+	savedMatch, err := m.service.PlayMatch(ctx, match.toMatchSetup())
 
 	if err != nil {
 		log.Errorf("something goes wront at service to play a match: %v, got: %s", match, err.Error())
-		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+		respondMatchError(w, err)
 		return
 	}
 	RespondRestWithJSON(w, http.StatusOK, savedMatch)
 }
 
+// createLive starts a live match and responds where it can be followed.
+func (m *matchRestHandler) createLive(ctx context.Context, w http.ResponseWriter, match newMatch) {
+	log.Infof("consuming play live from service to play a match: %v", match)
+	matchID, err := m.service.PlayLive(ctx, match.toMatchSetup(), matchapp.Pacing(match.Pacing))
+	if err != nil {
+		log.Errorf("something goes wrong at service to play a live match: %v, got: %s", match, err.Error())
+		respondMatchError(w, err)
+		return
+	}
+	RespondRestWithJSON(w, http.StatusAccepted, startedLiveMatch{
+		ID:   matchID,
+		Live: fmt.Sprintf("/matches/%s/live", matchID),
+	})
+}
+
+// createJob queues the match as a job and responds the job, which can be queried at
+// the location header.
+func (m *matchRestHandler) createJob(ctx context.Context, w http.ResponseWriter, match newMatch) {
+	log.Infof("consuming submit from service to queue a match: %v", match)
+	job, err := m.service.Submit(ctx, match.toMatchSetup())
+	if err != nil {
+		log.Errorf("something goes wrong at service to queue a match: %v, got: %s", match, err.Error())
+		respondMatchError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%s", job.ID))
+	RespondRestWithJSON(w, http.StatusAccepted, job)
+}
+
+// GetJob responds the status of a match job and the match report once it is done.
+func (m *matchRestHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting get job handler for match rest handler")
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	jobID := mux.Vars(r)["id"]
+	job, err := m.service.FindJob(ctx, domain.Key(jobID))
+	if err != nil {
+		log.Warnf("match job %q cannot be found: %s", jobID, err.Error())
+		RespondRestWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, job)
+}
+
+// CancelJob cancels a match job that is still queued.
+func (m *matchRestHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting cancel job handler for match rest handler")
+	status, ok := validateToken(r)
+	if !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	jobID := mux.Vars(r)["id"]
+	job, err := m.service.CancelJob(ctx, domain.Key(jobID))
+	switch err {
+	case nil:
+		RespondRestWithJSON(w, http.StatusOK, job)
+	case matchapp.ErrJobNotFound:
+		RespondRestWithError(w, http.StatusNotFound, err.Error())
+	case matchapp.ErrJobNotQueued:
+		RespondRestWithError(w, http.StatusConflict, fmt.Sprintf("%s, it is %s", err.Error(), job.Status))
+	default:
+		log.Errorf("something goes wrong at service to cancel match job %q, got: %s", jobID, err.Error())
+		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Live streams the events of a live match over a websocket until it finishes, the last
+// message contains the summary of the match.
+func (m *matchRestHandler) Live(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting live handler for match rest handler")
+	matchID := mux.Vars(r)["id"]
+	spectator, err := m.service.Follow(r.Context(), domain.Key(matchID))
+	if err != nil {
+		log.Warnf("live match %q cannot be followed: %s", matchID, err.Error())
+		RespondRestWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil { // the upgrader already responded to the client
+		log.Warnf("connection to follow live match %q cannot be upgraded: %s", matchID, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	// spectators only listen, reading detects when they leave
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		message, ok := spectator.Next(ctx)
+		if !ok {
+			break
+		}
+		if err := conn.WriteJSON(message); err != nil {
+			log.Warnf("live match %q cannot be sent to a spectator: %s", matchID, err.Error())
+			return
+		}
+	}
+	closing := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "match finished")
+	conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second))
+}
+
+// Preview estimates the outcome of a match without playing it. The players and the
+// competition are given in the query, or in a body like the one to play a match, which
+// can also carry the tactics of each player.
+func (m *matchRestHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting preview handler for match rest handler")
+	// context constraint
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	match := newMatchWithDefaults()
+	if r.Method == http.MethodPost {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&match); err != nil {
+			log.Warnf("payload to preview match is bad: %s", err.Error())
+			RespondRestWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	} else {
+		// Read parameters in the query url
+		filters := r.URL.Query()
+		match.Player1ID, match.Player2ID = filters.Get("player1ID"), filters.Get("player2ID")
+		match.Competition = filters.Get("competition")
+	}
+	if match.Player1ID == "" || match.Player2ID == "" {
+		log.Warnf("preview of match between %q and %q is missing a player", match.Player1ID, match.Player2ID)
+		RespondRestWithError(w, http.StatusBadRequest, "player1ID and player2ID are required")
+		return
+	}
+	log.Infof("consuming preview from service for match between %q and %q", match.Player1ID, match.Player2ID)
+	preview, err := m.service.Preview(ctx, match.toMatchSetup())
+	if err != nil {
+		log.Errorf("something goes wrong at service to preview a match between %q and %q, got: %s", match.Player1ID, match.Player2ID, err.Error())
+		respondMatchError(w, err)
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, preview)
+}
+
+// respondMatchError responds the status that matches the error of the match service.
+func respondMatchError(w http.ResponseWriter, err error) {
+	switch errors.Cause(err) {
+	case matchapp.ErrInvalidMatch:
+		RespondRestWithError(w, http.StatusBadRequest, err.Error())
+	case domain.ErrPlayerNotFound:
+		RespondRestWithError(w, http.StatusNotFound, err.Error())
+	case matchapp.ErrJobQueueFull, matchapp.ErrLiveMatchesFull, matchapp.ErrMatchServiceClosed:
+		RespondRestWithError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 // Update updates the data of existing record.
 func (m *matchRestHandler) Update(w http.ResponseWriter, r *http.Request) {
 	panic("not implemented")
@@ -0,0 +1,53 @@
+package port
+
+import (
+	"encoding/json"
+	"mime"
+)
+
+// mergePatchType is the media type of a JSON merge patch.
+const mergePatchType = "application/merge-patch+json"
+
+// isMergePatch checks that the given content type is a JSON merge patch, plain json is
+// accepted too because many clients don't know the merge patch type.
+func isMergePatch(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == mergePatchType || mediaType == appjson
+}
+
+// mergePatch applies the given JSON merge patch (RFC 7386) to the json document, members
+// of the patch replace the ones of the document and null members remove them.
+func mergePatch(document, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(target, changes))
+}
+
+// mergeValue merges the patch value into the target value.
+func mergeValue(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		// anything but an object replaces the target
+		return patch
+	}
+	result, ok := target.(map[string]interface{})
+	if !ok {
+		result = make(map[string]interface{})
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(result, name)
+			continue
+		}
+		result[name] = mergeValue(result[name], value)
+	}
+	return result
+}
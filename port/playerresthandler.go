@@ -3,20 +3,63 @@ package port
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/fernandoocampo/thepingthepong/application/playerapp"
 	"github.com/fernandoocampo/thepingthepong/domain"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
-// newPlayer contains data to save a new player
+// newPlayer contains data to save a new player. Wins and losses only come from the
+// matches played, they are read so the service refuses the requests that change them.
 type newPlayer struct {
 	Names  string `json:"names"`
-	Wins   int    `json:"wins,omitempty"`
-	Losses int    `json:"losses,omitempty"`
+	Wins   *int   `json:"wins,omitempty"`
+	Losses *int   `json:"losses,omitempty"`
+	domain.PlayerProfile
+}
+
+// newPlayerFrom returns the data of the given player that can be changed.
+func newPlayerFrom(player domain.Player) newPlayer {
+	return newPlayer{
+		Names:         player.Names,
+		Wins:          &player.Wins,
+		Losses:        &player.Losses,
+		PlayerProfile: player.PlayerProfile,
+	}
+}
+
+// statistics returns the wins and losses of the request, zero if they are missing.
+func (n newPlayer) statistics() (int, int) {
+	var wins, losses int
+	if n.Wins != nil {
+		wins = *n.Wins
+	}
+	if n.Losses != nil {
+		losses = *n.Losses
+	}
+	return wins, losses
+}
+
+// replace replaces the data of the given player with this one, the wins and losses that
+// are missing are kept.
+func (n newPlayer) replace(player *domain.Player) error {
+	player.Names = n.Names
+	if n.Wins != nil {
+		player.Wins = *n.Wins
+	}
+	if n.Losses != nil {
+		player.Losses = *n.Losses
+	}
+	player.PlayerProfile = n.PlayerProfile
+	return nil
 }
 
 type playerRestHandler struct {
@@ -24,49 +67,88 @@ type playerRestHandler struct {
 }
 
 // NewPlayerRestHandler instance of a basic implementation of player rest handler
-func NewPlayerRestHandler(playerService playerapp.PlayerService) RestHandler {
+func NewPlayerRestHandler(playerService playerapp.PlayerService) PlayerHandler {
 	log.Infof("creating player rest handler")
 	return playerRestHandler{
 		service: playerService,
 	}
 }
 
-const timeout = time.Second * 5
+const (
+	timeout = time.Second * 5
+	// totalCount is the header with the number of players matching the filters on every page
+	totalCount = "X-Total-Count"
+	// nextCursor is the header with the cursor of the next page of players
+	nextCursor = "X-Next-Cursor"
+	// transferTimeout limits how long players can be imported or exported
+	transferTimeout = time.Minute
+	// maxImportSize is the size in bytes of the largest file of players to import
+	maxImportSize = 10 << 20
+	// maxPatchSize is the size in bytes of the largest patch of a player
+	maxPatchSize = 64 << 10
+)
+
+// media types of the files of players
+const (
+	textcsv = "text/csv"
+	ndjson  = "application/x-ndjson"
+)
 
-// GetAll get all records or those that matches a given criteria
+// GetAll get a page of the players that match the filters of the query url, the total
+// number of players matching them and the cursor of the next page go in the headers.
 func (p playerRestHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	log.Info("initializing player rest handler to get all")
-	log.Info("checking if token is valid")
 
 	// context constraint
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	// Read parameters in the query url
-	filters := r.URL.Query()
-	sortedparam := filters.Get("sorted")
-	log.Infof("finding all players with parameter sorted: %s", sortedparam)
-
-	var sorted bool
-	var err error
-	var players []domain.Player
-
-	// not filters get all
-	if strings.EqualFold("true", sortedparam) {
-		sorted = true
+	query, err := playerQueryFrom(r.URL.Query())
+	if err != nil {
+		log.Warnf("query to get all players is bad: %s", err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	log.Infof("getting ready to find all players with query: %+v", query)
+	page, err := p.service.FindAll(ctx, query)
+	if err != nil {
+		respondPlayerError(w, err)
+		return
+	}
+	w.Header().Set(totalCount, strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set(nextCursor, page.NextCursor)
+	}
+	RespondRestWithJSON(w, http.StatusOK, page.Players)
+}
 
-	log.Infof("getting ready to find all players")
-	players, err = p.service.FindAll(ctx, sorted)
-
+// Search finds the players whose names match the text of the q parameter, the best
+// matches first with their scores.
+func (p playerRestHandler) Search(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting search players handler")
+	// context constraint
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	text, limit := r.URL.Query().Get("q"), 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			log.Warnf("limit %q to search players is bad", value)
+			RespondRestWithError(w, http.StatusBadRequest, fmt.Sprintf("limit %q must be a positive number", value))
+			return
+		}
+	}
+	log.Infof("getting ready to search players with text: %q", text)
+	result, err := p.service.Search(ctx, text, limit)
 	if err != nil {
-		log.Errorf("something goes wrong on service to get all players: %s", err.Error())
-		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+		respondPlayerError(w, err)
 		return
 	}
-	RespondRestWithJSON(w, http.StatusOK, players)
+	RespondRestWithJSON(w, http.StatusOK, result)
 }
 
-// GetByID get record by id
+// GetByID get record by id, the ETag header has its version and a request whose
+// If-None-Match has it too is answered with not modified and no body.
 func (p playerRestHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	log.Info("starting get by id handler")
 	// context constraint
@@ -79,6 +161,15 @@ func (p playerRestHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	player, err := p.service.FindByID(ctx, domain.Key(playerid))
 	if err != nil {
 		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if player.ID != "" {
+		w.Header().Set(etag, playerETag(player))
+		if condition := r.Header.Get(ifNoneMatch); condition != "" && matchesETag(condition, playerETag(player), true) {
+			log.Infof("player %s was not modified since version %d", playerid, player.Version)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
 	RespondRestWithJSON(w, http.StatusOK, player)
 }
@@ -110,27 +201,332 @@ func (p playerRestHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Infof("consuming create from service to create player: %v", player)
-	_, err := p.service.Create(ctx, player.Names, player.Wins, player.Losses)
+	wins, losses := player.statistics()
+	_, err := p.service.CreateWithProfile(ctx, player.Names, wins, losses, player.PlayerProfile)
 	if err != nil {
 		log.Errorf("something goes wront at service to create player: %v, got: %s", player, err.Error())
-		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+		respondPlayerError(w, err)
 		return
 	}
 	RespondRestWithJSON(w, http.StatusOK, "created!")
 
 }
 
-// Update updates the data of existing record.
+// Update replaces the names and profile of a player, the If-Match header must have the
+// ETag of its current version.
 func (p playerRestHandler) Update(w http.ResponseWriter, r *http.Request) {
-	panic("not implemented")
+	log.Info("starting update handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	condition, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	defer r.Body.Close()
+	var player newPlayer
+	if err := json.NewDecoder(r.Body).Decode(&player); err != nil {
+		log.Warnf("payload to update player is bad: %s", err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	playerid := mux.Vars(r)["playerid"]
+	log.Infof("consuming update from service to update player %s with: %v", playerid, player)
+	updated, err := p.service.Update(ctx, domain.Key(playerid), ifPlayerMatches(condition, player.replace))
+	if err != nil {
+		respondPlayerError(w, err)
+		return
+	}
+	w.Header().Set(etag, playerETag(updated))
+	RespondRestWithJSON(w, http.StatusOK, updated)
+}
+
+// Patch changes the names and profile of a player with a JSON merge patch, the If-Match
+// header must have the ETag of its current version.
+func (p playerRestHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting patch handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	if mediaType := r.Header.Get(contentType); mediaType != "" && !isMergePatch(mediaType) {
+		log.Warnf("payload to patch player has not a merge patch type: %s", mediaType)
+		RespondRestWithError(w, http.StatusUnsupportedMediaType, "Payload must be a "+mergePatchType)
+		return
+	}
+	condition, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	defer r.Body.Close()
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		log.Warnf("payload to patch player is larger than %d bytes", tooLarge.Limit)
+		RespondRestWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Payload must be %d bytes at most", tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		log.Warnf("payload to patch player cannot be read: %s", err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	playerid := mux.Vars(r)["playerid"]
+	log.Infof("consuming update from service to patch player %s with: %s", playerid, patch)
+	var errpatch error
+	updated, err := p.service.Update(ctx, domain.Key(playerid), ifPlayerMatches(condition, func(player *domain.Player) error {
+		errpatch = applyPlayerPatch(player, patch)
+		return errpatch
+	}))
+	if errpatch != nil {
+		log.Warnf("merge patch for player %s is bad: %s", playerid, errpatch.Error())
+		RespondRestWithError(w, http.StatusBadRequest, "Invalid merge patch")
+		return
+	}
+	if err != nil {
+		respondPlayerError(w, err)
+		return
+	}
+	w.Header().Set(etag, playerETag(updated))
+	RespondRestWithJSON(w, http.StatusOK, updated)
 }
 
-// Delete deletes a record.
+// Delete archives a player, it keeps the statistics of its matches.
 func (p playerRestHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	panic("not implemented")
+	log.Info("starting delete handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	playerid := mux.Vars(r)["playerid"]
+	log.Infof("consuming delete from service to archive player %s", playerid)
+	if err := p.service.Delete(ctx, domain.Key(playerid)); err != nil {
+		respondPlayerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Import creates the players of a csv or ndjson file, the format comes from the format
+// parameter or the Content-Type header. The report has the number of imported players
+// and why every other line was not imported, with dryRun=true the players are only
+// validated.
+func (p playerRestHandler) Import(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting import players handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	format, err := importFormatFrom(r)
+	if err != nil {
+		log.Warnf("format of players to import is bad: %s", err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dryRun := false
+	if value := r.URL.Query().Get("dryRun"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			log.Warnf("dryRun %q to import players is bad", value)
+			RespondRestWithError(w, http.StatusBadRequest, fmt.Sprintf("dryRun %q must be true or false", value))
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), transferTimeout)
+	defer cancel()
+	defer r.Body.Close()
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	log.Infof("consuming import from service with format %s, dry run: %t", format, dryRun)
+	report, err := p.service.Import(ctx, body, format, dryRun)
+	if err != nil {
+		respondPlayerError(w, err)
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, report)
+}
+
+// Export streams every player that is not archived as a csv or ndjson file, csv is the
+// format unless the format parameter says otherwise.
+func (p playerRestHandler) Export(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting export players handler")
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = string(playerapp.CSVFormat)
+	}
+	format, err := playerapp.ParseTransferFormat(name)
+	if err != nil {
+		respondPlayerError(w, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), transferTimeout)
+	defer cancel()
+	mediaType := textcsv
+	if format == playerapp.NDJSONFormat {
+		mediaType = ndjson
+	}
+	w.Header().Set(contentType, mediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "players."+string(format)))
+	// the status is sent with the first players, an error after that can only be logged
+	if err := p.service.Export(ctx, w, format); err != nil {
+		log.Errorf("players cannot be exported: %s", err.Error())
+	}
+}
+
+// RebuildStatistics stores on every player the wins and losses of the statistics log,
+// the report tells how many entries were replayed and how many players changed. A log
+// on memory or without entries is only rebuilt with force.
+func (p playerRestHandler) RebuildStatistics(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting rebuild statistics handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	force := false
+	if value := r.URL.Query().Get("force"); value != "" {
+		var err error
+		if force, err = strconv.ParseBool(value); err != nil {
+			log.Warnf("force %q to rebuild statistics is bad", value)
+			RespondRestWithError(w, http.StatusBadRequest, fmt.Sprintf("force %q must be true or false", value))
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), transferTimeout)
+	defer cancel()
+	log.Infof("consuming rebuild statistics from service, forced: %t", force)
+	report, err := p.service.RebuildStatistics(ctx, force)
+	if err != nil {
+		respondPlayerError(w, err)
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, report)
 }
 
 // Health returns the health of this service
 func (p playerRestHandler) Health(w http.ResponseWriter, r *http.Request) {
 	panic("not implemented")
 }
+
+// applyPlayerPatch applies the given merge patch to the data of the player that can be changed.
+func applyPlayerPatch(player *domain.Player, patch []byte) error {
+	document, err := json.Marshal(newPlayerFrom(*player))
+	if err != nil {
+		return err
+	}
+	patched, err := mergePatch(document, patch)
+	if err != nil {
+		return err
+	}
+	var result newPlayer
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return err
+	}
+	return result.replace(player)
+}
+
+// requireIfMatch returns the If-Match condition of the request, if it is missing it
+// responds precondition required, so players are never changed from a stale copy.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (string, bool) {
+	condition := r.Header.Get(ifMatch)
+	if condition == "" {
+		log.Warn("request to change a player has not If-Match header")
+		RespondRestWithError(w, http.StatusPreconditionRequired, "If-Match header with the ETag of the player is required")
+		return "", false
+	}
+	return condition, true
+}
+
+// importFormatFrom returns the format of the players to import of the format parameter or,
+// when it is missing, of the Content-Type header.
+func importFormatFrom(r *http.Request) (playerapp.TransferFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		return playerapp.ParseTransferFormat(name)
+	}
+	mediaType := strings.TrimSpace(strings.Split(r.Header.Get(contentType), ";")[0])
+	switch strings.ToLower(mediaType) {
+	case textcsv:
+		return playerapp.CSVFormat, nil
+	case ndjson:
+		return playerapp.NDJSONFormat, nil
+	}
+	return "", errors.Wrapf(playerapp.ErrUnknownFormat, "format parameter is missing and content type %q is not known", mediaType)
+}
+
+// respondPlayerError responds not found for unknown or archived players, precondition
+// failed for stale versions, bad request for players that are not valid and internal
+// server error for any other error.
+func respondPlayerError(w http.ResponseWriter, err error) {
+	switch errors.Cause(err) {
+	case domain.ErrPlayerNotFound:
+		RespondRestWithError(w, http.StatusNotFound, err.Error())
+	case domain.ErrVersionConflict:
+		log.Warnf("player was changed by someone else: %s", err.Error())
+		RespondRestWithError(w, http.StatusPreconditionFailed, err.Error())
+	case playerapp.ErrInvalidPlayer, playerapp.ErrInvalidQuery, playerapp.ErrUnknownFormat, playerapp.ErrInvalidImport:
+		log.Warnf("player request is not valid: %s", err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, err.Error())
+	case playerapp.ErrUnsafeRebuild:
+		log.Warnf("statistics cannot be rebuilt: %s", err.Error())
+		RespondRestWithError(w, http.StatusConflict, err.Error())
+	default:
+		log.Errorf("something goes wrong on service with the player: %s", err.Error())
+		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// playerQueryFrom reads the query to find players from the parameters of the url.
+func playerQueryFrom(filters url.Values) (domain.PlayerQuery, error) {
+	query := domain.PlayerQuery{
+		NamesPrefix: filters.Get("prefix"),
+		Profile: domain.PlayerProfile{
+			Style:      domain.PlayingStyle(filters.Get("style")),
+			Handedness: domain.Handedness(filters.Get("handedness")),
+			Grip:       domain.Grip(filters.Get("grip")),
+		},
+		Cursor: filters.Get("cursor"),
+	}
+	var err error
+	if query.Sort, err = domain.ParseSort(filters.Get("sort")); err != nil {
+		return domain.PlayerQuery{}, err
+	}
+	// sorted is the first way players were sorted
+	if len(query.Sort) == 0 && strings.EqualFold("true", filters.Get("sorted")) {
+		query.Sort = []domain.SortKey{{Field: domain.SortByNames, Descending: true}}
+	}
+	if value := filters.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 {
+			return domain.PlayerQuery{}, errors.Errorf("limit %q must be a positive number", value)
+		}
+	}
+	for name, target := range map[string]**int{"minWins": &query.MinWins, "maxWins": &query.MaxWins} {
+		if value := filters.Get(name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return domain.PlayerQuery{}, errors.Errorf("%s %q must be a number", name, value)
+			}
+			*target = &number
+		}
+	}
+	for name, target := range map[string]**float64{"minWinRatio": &query.MinWinRatio, "maxWinRatio": &query.MaxWinRatio} {
+		if value := filters.Get(name); value != "" {
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return domain.PlayerQuery{}, errors.Errorf("%s %q must be a number", name, value)
+			}
+			*target = &ratio
+		}
+	}
+	for name, target := range map[string]*time.Time{"createdFrom": &query.CreatedFrom, "createdTo": &query.CreatedTo} {
+		if value := filters.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				return domain.PlayerQuery{}, errors.Errorf("%s %q must be a RFC 3339 date", name, value)
+			}
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,49 @@
+package port_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/port"
+	"github.com/gorilla/mux"
+)
+
+func TestDebugVarsRequireToken(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/debug/vars", port.DebugVars).Methods("GET")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+
+	// Given a request without token.
+	req := httptest.NewRequest("GET", "/debug/vars", nil)
+	rr := httptest.NewRecorder()
+
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+
+	// Then the variables are not published.
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	// Given a request with a token.
+	req = httptest.NewRequest("GET", "/debug/vars", nil)
+	req.AddCookie(tokencookie)
+	rr = httptest.NewRecorder()
+
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+
+	// Then the variables are published.
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil || vars["memstats"] == nil {
+		t.Errorf("the published variables were expected, but got: %s, %v", rr.Body.String(), err)
+	}
+}
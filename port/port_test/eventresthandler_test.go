@@ -0,0 +1,71 @@
+package port_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/application/feedapp"
+	"github.com/fernandoocampo/thepingthepong/port"
+	"github.com/gorilla/mux"
+)
+
+func TestStreamEventsAfterLastEventID(t *testing.T) {
+	feed := feedapp.NewRingFeed(10)
+	eventhandler := port.NewEventRestHandler(feed)
+	r := mux.NewRouter()
+	r.HandleFunc("/events", eventhandler.Events).Methods("GET")
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// Given three events already published.
+	feed.Publish(feedapp.PlayerCreatedEvent, map[string]string{"names": "Jan-Ove Waldner"})
+	feed.Publish(feedapp.PlayerCreatedEvent, map[string]string{"names": "Timo Boll"})
+	feed.Publish(feedapp.PlayerCreatedEvent, map[string]string{"names": "Ma Long"})
+
+	// When a client resumes the stream after the first event.
+	req, err := http.NewRequest("GET", server.URL+"/events", nil)
+	assertNoError(t, err)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	assertNoError(t, err)
+	defer resp.Body.Close()
+
+	// Then it receives the events after it.
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("an event stream was expected, but got: %q", got)
+	}
+	want := []string{
+		"id: 2", "event: player.created", `data: {"names":"Timo Boll"}`, "",
+		"id: 3", "event: player.created", `data: {"names":"Ma Long"}`, "",
+	}
+	reader := bufio.NewReader(resp.Body)
+	for _, line := range want {
+		got, err := reader.ReadString('\n')
+		assertNoError(t, err)
+		if strings.TrimSuffix(got, "\n") != line {
+			t.Fatalf("line %q was expected, but got: %q", line, got)
+		}
+	}
+}
+
+func TestStreamEventsWithInvalidLastEventID(t *testing.T) {
+	eventhandler := port.NewEventRestHandler(feedapp.NewRingFeed(10))
+	req, err := http.NewRequest("GET", "/events", nil)
+	assertNoError(t, err)
+	req.Header.Set("Last-Event-ID", "first")
+	rr := httptest.NewRecorder()
+	r := mux.NewRouter()
+	r.HandleFunc("/events", eventhandler.Events).Methods("GET")
+
+	r.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
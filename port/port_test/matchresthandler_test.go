@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fernandoocampo/thepingthepong/application/matchapp"
 	"github.com/fernandoocampo/thepingthepong/application/playerapp"
@@ -15,6 +17,7 @@ import (
 	"github.com/fernandoocampo/thepingthepong/infra/repository"
 	"github.com/fernandoocampo/thepingthepong/port"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 )
 
 func TestCreateAMatch(t *testing.T) {
@@ -76,6 +79,366 @@ func TestCreateAMatch(t *testing.T) {
 	}
 }
 
+func TestCreateAMatchWithTactics(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	matchService := matchapp.NewBasicMatchService(playerService)
+	matchhandler := port.NewMatchRestHandler(matchService)
+
+	// Given a the following players to start a match.
+	player1ID, err := playerService.Create(context.TODO(), "Jan-Ove Waldner", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(context.TODO(), "Timo Boll", 0, 0)
+	assertNoError(t, err)
+
+	// and tactics just for the first player, the second one uses defaults.
+	strjson := fmt.Sprintf(`{"player1ID": "%s", "player2ID": "%s",
+		"player1Tactics": {"aggression": 5, "serve": "spin", "defense": "counter", "longBalls": "loop"}}`,
+		player1ID, player2ID)
+	req, errreq := http.NewRequest("POST", "/matches", bytes.NewBuffer([]byte(strjson)))
+	assertNoError(t, errreq)
+
+	rr := httptest.NewRecorder()
+	r := mux.NewRouter()
+	r.HandleFunc("/matches", matchhandler.Create).Methods("POST")
+
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+	req.AddCookie(tokencookie)
+
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+
+	// Then we check the tactics report of the match.
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	var got domain.MatchReport
+	err = json.NewDecoder(rr.Body).Decode(&got)
+	assertNoError(t, err)
+
+	if len(got.Tactics) != 2 {
+		t.Fatalf("a tactics report for each player was expected, but got: %+v", got.Tactics)
+	}
+	want1 := domain.Tactics{Aggression: 5, Serve: domain.SpinServe, Defense: domain.CounterAttack, LongBalls: domain.LoopLongBall}
+	if got.Tactics[0].Tactics != want1 {
+		t.Errorf("player 1 tactics must be %+v, but got: %+v", want1, got.Tactics[0].Tactics)
+	}
+	if got.Tactics[1].Tactics != domain.DefaultTactics() {
+		t.Errorf("player 2 tactics must be the default ones %+v, but got: %+v", domain.DefaultTactics(), got.Tactics[1].Tactics)
+	}
+}
+
+func TestCreateAMatchThatIsNotValid(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	matchService := matchapp.NewBasicMatchService(playerService)
+	matchhandler := port.NewMatchRestHandler(matchService)
+	r := mux.NewRouter()
+	r.HandleFunc("/matches", matchhandler.Create).Methods("POST")
+	r.HandleFunc("/matches/preview", matchhandler.Preview).Methods("GET")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+
+	// Given a the following players to start a match.
+	player1ID, err := playerService.Create(context.TODO(), "Jan-Ove Waldner", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(context.TODO(), "Timo Boll", 0, 0)
+	assertNoError(t, err)
+
+	tests := map[string]*http.Request{
+		"invalid tactics": httptest.NewRequest("POST", "/matches", strings.NewReader(fmt.Sprintf(
+			`{"player1ID": "%s", "player2ID": "%s", "player2Tactics": {"aggression": 99}}`, player1ID, player2ID))),
+		"unknown competition": httptest.NewRequest("POST", "/matches", strings.NewReader(fmt.Sprintf(
+			`{"player1ID": "%s", "player2ID": "%s", "competition": "unknown"}`, player1ID, player2ID))),
+		"unknown pacing": httptest.NewRequest("POST", "/matches", strings.NewReader(fmt.Sprintf(
+			`{"player1ID": "%s", "player2ID": "%s", "live": true, "pacing": "slow"}`, player1ID, player2ID))),
+		"live and async": httptest.NewRequest("POST", "/matches", strings.NewReader(fmt.Sprintf(
+			`{"player1ID": "%s", "player2ID": "%s", "live": true, "async": true}`, player1ID, player2ID))),
+		"preview of unknown competition": httptest.NewRequest("GET", fmt.Sprintf(
+			"/matches/preview?player1ID=%s&player2ID=%s&competition=unknown", player1ID, player2ID), nil),
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			req.AddCookie(tokencookie)
+			rr := httptest.NewRecorder()
+
+			// When client consumes a rest api.
+			r.ServeHTTP(rr, req)
+
+			// Then the request is refused as bad.
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s",
+					status, http.StatusBadRequest, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateAMatchWithUnknownPlayer(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	matchService := matchapp.NewBasicMatchService(playerService)
+	matchhandler := port.NewMatchRestHandler(matchService)
+	r := mux.NewRouter()
+	r.HandleFunc("/matches", matchhandler.Create).Methods("POST")
+	r.HandleFunc("/matches/preview", matchhandler.Preview).Methods("GET")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+
+	// Given a player and the id of a player that doesn't exist.
+	player1ID, err := playerService.Create(context.TODO(), "Jan-Ove Waldner", 0, 0)
+	assertNoError(t, err)
+	unknownID := domain.GenerateUUIDKey()
+
+	tests := map[string]*http.Request{
+		"match": httptest.NewRequest("POST", "/matches", strings.NewReader(fmt.Sprintf(
+			`{"player1ID": "%s", "player2ID": "%s"}`, player1ID, unknownID))),
+		"match without player": httptest.NewRequest("POST", "/matches", strings.NewReader(fmt.Sprintf(
+			`{"player1ID": "%s"}`, player1ID))),
+		"preview": httptest.NewRequest("GET", fmt.Sprintf(
+			"/matches/preview?player1ID=%s&player2ID=%s", unknownID, player1ID), nil),
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			req.AddCookie(tokencookie)
+			rr := httptest.NewRecorder()
+
+			// When client consumes a rest api.
+			r.ServeHTTP(rr, req)
+
+			// Then the player is not found.
+			if status := rr.Code; status != http.StatusNotFound {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s",
+					status, http.StatusNotFound, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestPreviewAMatch(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	matchService := matchapp.NewBasicMatchServiceWithSetting(playerService,
+		domain.MatchSetting{PreviewSimulations: 20, PreviewWorkers: 2})
+	matchhandler := port.NewMatchRestHandler(matchService)
+
+	// Given a the following players to preview a match.
+	player1ID, err := playerService.Create(context.TODO(), "Jan-Ove Waldner", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(context.TODO(), "Timo Boll", 0, 0)
+	assertNoError(t, err)
+
+	url := fmt.Sprintf("/matches/preview?player1ID=%s&player2ID=%s", player1ID, player2ID)
+	req, errreq := http.NewRequest("GET", url, nil)
+	assertNoError(t, errreq)
+
+	rr := httptest.NewRecorder()
+	r := mux.NewRouter()
+	r.HandleFunc("/matches/preview", matchhandler.Preview).Methods("GET")
+
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+
+	// Then we check the preview of the match.
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	var got domain.MatchPreview
+	err = json.NewDecoder(rr.Body).Decode(&got)
+	assertNoError(t, err)
+	if got.Simulations != 20 || len(got.Scores) == 0 {
+		t.Errorf("a preview of 20 simulations with a score distribution was expected, but got: %+v", got)
+	}
+}
+
+func TestPreviewAMatchWithTactics(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	matchService := matchapp.NewBasicMatchServiceWithSetting(playerService,
+		domain.MatchSetting{PreviewSimulations: 20, PreviewWorkers: 2})
+	matchhandler := port.NewMatchRestHandler(matchService)
+	r := mux.NewRouter()
+	r.HandleFunc("/matches/preview", matchhandler.Preview).Methods("GET", "POST")
+
+	// Given a the following players to preview a match.
+	player1ID, err := playerService.Create(context.TODO(), "Jan-Ove Waldner", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(context.TODO(), "Timo Boll", 0, 0)
+	assertNoError(t, err)
+
+	tests := map[string]struct {
+		tactics string
+		want    int
+	}{
+		"valid tactics":   {tactics: `{"aggression": 5, "serve": "spin"}`, want: http.StatusOK},
+		"invalid tactics": {tactics: `{"aggression": 9}`, want: http.StatusBadRequest},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			strjson := fmt.Sprintf(`{"player1ID": "%s", "player2ID": "%s", "player1Tactics": %s}`, player1ID, player2ID, test.tactics)
+			req := httptest.NewRequest("POST", "/matches/preview", strings.NewReader(strjson))
+			rr := httptest.NewRecorder()
+
+			// When client posts the match with the tactics of the first player.
+			r.ServeHTTP(rr, req)
+
+			// Then the preview is played with them.
+			if status := rr.Code; status != test.want {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", status, test.want, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestFollowALiveMatch(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	matchService := matchapp.NewBasicMatchServiceWithSetting(playerService,
+		domain.MatchSetting{LivePacing: string(matchapp.InstantPacing)})
+	matchhandler := port.NewMatchRestHandler(matchService)
+	r := mux.NewRouter()
+	r.HandleFunc("/matches", matchhandler.Create).Methods("POST")
+	r.HandleFunc("/matches/{id}/live", matchhandler.Live).Methods("GET")
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// Given a live match between the following players.
+	player1ID, err := playerService.Create(context.TODO(), "Jan-Ove Waldner", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(context.TODO(), "Timo Boll", 0, 0)
+	assertNoError(t, err)
+	strjson := fmt.Sprintf(`{"player1ID": "%s", "player2ID": "%s", "live": true}`, player1ID, player2ID)
+	req, errreq := http.NewRequest("POST", "/matches", bytes.NewBuffer([]byte(strjson)))
+	assertNoError(t, errreq)
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+	req.AddCookie(tokencookie)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+	var started struct {
+		ID   string `json:"id"`
+		Live string `json:"live"`
+	}
+	err = json.NewDecoder(rr.Body).Decode(&started)
+	assertNoError(t, err)
+
+	// When a spectator follows the match.
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + started.Live
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assertNoError(t, err)
+	defer conn.Close()
+	var got []matchapp.LiveMessage
+	for {
+		var message matchapp.LiveMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Fatalf("the live match must finish with a normal closure, but got: %s", err)
+			}
+			break
+		}
+		got = append(got, message)
+	}
+
+	// Then the spectator receives the events and the summary at the end.
+	if len(got) < 2 {
+		t.Fatalf("events and a summary were expected, but got: %+v", got)
+	}
+	if got[0].Type != matchapp.EventMessage {
+		t.Errorf("the first message must be an event, but got: %+v", got[0])
+	}
+	summary := got[len(got)-1]
+	if summary.Type != matchapp.SummaryMessage || summary.Summary == nil || string(summary.Summary.ID) != started.ID {
+		t.Errorf("the last message must be the summary of match %q, but got: %+v", started.ID, summary)
+	}
+
+	// And an unknown match cannot be followed.
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/matches/unknown/live", nil)
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("an unknown live match must respond %d, but got: %v", http.StatusNotFound, resp)
+	}
+}
+
+func TestCreateAMatchJob(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	playerService := playerapp.NewBasicPlayerService(&repo)
+	matchService := matchapp.NewBasicMatchService(playerService)
+	matchhandler := port.NewMatchRestHandler(matchService)
+	r := mux.NewRouter()
+	r.HandleFunc("/matches", matchhandler.Create).Methods("POST")
+	r.HandleFunc("/jobs/{id}", matchhandler.GetJob).Methods("GET")
+	r.HandleFunc("/jobs/{id}", matchhandler.CancelJob).Methods("DELETE")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+
+	// Given a the following players to play a match in background.
+	player1ID, err := playerService.Create(context.TODO(), "Jan-Ove Waldner", 0, 0)
+	assertNoError(t, err)
+	player2ID, err := playerService.Create(context.TODO(), "Timo Boll", 0, 0)
+	assertNoError(t, err)
+	strjson := fmt.Sprintf(`{"player1ID": "%s", "player2ID": "%s", "async": true}`, player1ID, player2ID)
+	req, errreq := http.NewRequest("POST", "/matches", bytes.NewBuffer([]byte(strjson)))
+	assertNoError(t, errreq)
+	req.AddCookie(tokencookie)
+
+	// When client queues the match.
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	// Then the job is accepted and its result can be queried at the location.
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+	var job matchapp.MatchJob
+	assertNoError(t, json.NewDecoder(rr.Body).Decode(&job))
+	location := rr.Header().Get("Location")
+	if location != "/jobs/"+string(job.ID) {
+		t.Fatalf("location of job %q was expected, but got: %q", job.ID, location)
+	}
+	for start := time.Now(); job.Status != matchapp.JobDone; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("the job must be done after 5 seconds, but got: %+v", job)
+		}
+		req, errreq := http.NewRequest("GET", location, nil)
+		assertNoError(t, errreq)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		assertNoError(t, json.NewDecoder(rr.Body).Decode(&job))
+	}
+	if job.Result == nil || job.Result.Winner == nil {
+		t.Errorf("the job must contain the match report, but got: %+v", job)
+	}
+
+	// And a finished job cannot be cancelled.
+	req, errreq = http.NewRequest("DELETE", location, nil)
+	assertNoError(t, errreq)
+	req.AddCookie(tokencookie)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+}
+
 func assertNoError(t *testing.T, err error) {
 	t.Helper()
 	if err != nil {
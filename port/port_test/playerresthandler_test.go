@@ -3,6 +3,7 @@ package port_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -61,9 +62,7 @@ func TestCreateAPlayer(t *testing.T) {
 
 	// Given a get request to find by Id a player.
 	strnames := "Hugo Calderano"
-	wins := 5
-	losses := 3
-	strjson := fmt.Sprintf(`{"names" : "%s", "wins": %d, "losses": %d}`, strnames, wins, losses)
+	strjson := fmt.Sprintf(`{"names" : "%s", "wins": 0, "losses": 0}`, strnames)
 	req, errreq := http.NewRequest("POST", "/players", bytes.NewBuffer([]byte(strjson)))
 
 	if errreq != nil {
@@ -98,12 +97,12 @@ func TestCreateAPlayer(t *testing.T) {
 	// context constraint
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	players, errfindall := repo.FindAll(ctx, false)
+	players, errfindall := repo.FindAll(ctx, domain.PlayerQuery{})
 	if errfindall != nil {
 		t.Fatal(errfindall)
 	}
 	exists := false
-	for _, player := range players {
+	for _, player := range players.Players {
 		if player.Names == strnames {
 			exists = true
 			break
@@ -112,6 +111,18 @@ func TestCreateAPlayer(t *testing.T) {
 	if !exists {
 		t.Errorf("The player %s was not stored in the database", strnames)
 	}
+
+	// And a player with wins is not valid, they only come from the matches played
+	req, errreq = http.NewRequest("POST", "/players", strings.NewReader(`{"names": "Lin Yun-Ju", "wins": 5, "losses": 3}`))
+	if errreq != nil {
+		t.Fatal(errreq)
+	}
+	req.AddCookie(tokencookie)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
 }
 
 func TestGetAnExistingPlayer(t *testing.T) {
@@ -160,6 +171,43 @@ func TestGetAnExistingPlayer(t *testing.T) {
 	}
 }
 
+func TestGetAPlayerConditionally(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id, err := service.Create(ctx, "Wang Liqin", 0, 0)
+	if err != nil {
+		t.Fatalf("A player cannot be saved because of: %s", err.Error())
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/players/{playerid}", playerhandler.GetByID).Methods("GET")
+
+	// Given a get request without condition.
+	req, _ := http.NewRequest("GET", "/players/"+string(id), nil)
+	rr := httptest.NewRecorder()
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+	// Then the player comes with the ETag of its version.
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("player with ETag \"1\" was expected, but got: %d %v", rr.Code, rr.Header())
+	}
+
+	// And it is not sent again while it doesn't change.
+	for condition, status := range map[string]int{`"1"`: http.StatusNotModified, `W/"1"`: http.StatusNotModified, `"0", *`: http.StatusNotModified, `"2"`: http.StatusOK} {
+		req.Header.Set("If-None-Match", condition)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Errorf("status %d was expected for If-None-Match %s, but got: %d", status, condition, rr.Code)
+		}
+		if status == http.StatusNotModified && rr.Body.Len() != 0 {
+			t.Errorf("not modified responses cannot have body, but got: %s", rr.Body.String())
+		}
+	}
+}
+
 func TestGetAllPlayers(t *testing.T) {
 	repo := repository.NewPlayerRepositoryOnMemory(1)
 	service := playerapp.NewBasicPlayerService(&repo)
@@ -208,3 +256,461 @@ func TestGetAllPlayers(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAllPlayersByProfile(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	// save players with different styles in the db.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := service.CreateWithProfile(ctx, "Joo Sae-hyuk", 0, 0, domain.PlayerProfile{Style: domain.Chopper, Handedness: domain.RightHanded})
+	if err != nil {
+		t.Fatalf("A player cannot be saved because of: %s", err.Error())
+	}
+	_, err = service.CreateWithProfile(ctx, "Timo Boll", 0, 0, domain.PlayerProfile{Style: domain.OffensiveLooper, Handedness: domain.LeftHanded})
+	if err != nil {
+		t.Fatalf("A player cannot be saved because of: %s", err.Error())
+	}
+	// Given a get request to find the choppers.
+	req, errreq := http.NewRequest("GET", "/players?style=chopper&handedness=right", nil)
+	if errreq != nil {
+		t.Fatal(errreq)
+	}
+
+	rr := httptest.NewRecorder()
+	r := mux.NewRouter()
+	r.HandleFunc("/players", playerhandler.GetAll).Methods("GET")
+
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+
+	// Then we check that only the chopper was found.
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "Joo Sae-hyuk") {
+		t.Errorf("player Joo Sae-hyuk was not found in the result body: got %v", rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "Timo Boll") {
+		t.Errorf("player Timo Boll is not a chopper but was found in the result body: got %v", rr.Body.String())
+	}
+}
+
+func TestGetAllPlayersByPages(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for index, names := range []string{"Ma Long", "Ma Lin", "Xu Xin", "Timo Boll"} {
+		if err := repo.Save(ctx, domain.NewPlayerWithStatistics(names, index, 0)); err != nil {
+			t.Fatalf("A player cannot be saved because of: %s", err.Error())
+		}
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/players", playerhandler.GetAll).Methods("GET")
+
+	// Given a request for the first page of the players with at least one win.
+	req, _ := http.NewRequest("GET", "/players?minWins=1&sort=-wins,names&limit=2", nil)
+	rr := httptest.NewRecorder()
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+	// Then the page has the best players, the total and the cursor of the next page.
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "Timo Boll") || !strings.Contains(rr.Body.String(), "Xu Xin") || strings.Contains(rr.Body.String(), "Ma Lin") {
+		t.Errorf("players Timo Boll and Xu Xin were expected, but got: %s", rr.Body.String())
+	}
+	if total := rr.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("3 players were expected in total, but got: %q", total)
+	}
+	cursor := rr.Header().Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatalf("a cursor to the next page was expected")
+	}
+
+	// When the next page is requested.
+	req, _ = http.NewRequest("GET", "/players?minWins=1&sort=-wins,names&limit=2&cursor="+cursor, nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	// Then it has the last player and no cursor.
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Ma Lin") || rr.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("only Ma Lin was expected on the last page, but got: %d %s %v", rr.Code, rr.Body.String(), rr.Header())
+	}
+
+	// And queries that are not valid are bad requests.
+	for _, query := range []string{"limit=0", "limit=1000", "sort=id", "minWins=many", "createdFrom=yesterday", "minWinRatio=2", "cursor=broken"} {
+		req, _ = http.NewRequest("GET", "/players?"+query, nil)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("query %q must be a bad request, but got: %d %s", query, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestUpdateAPlayer(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	player := domain.NewPlayerWithStatistics("Hugo Calderano", 5, 3)
+	player.Grip = domain.ShakehandGrip
+	if err := repo.Save(ctx, player); err != nil {
+		t.Fatalf("A player cannot be saved because of: %s", err.Error())
+	}
+	id := player.ID
+	r := mux.NewRouter()
+	r.HandleFunc("/players/{playerid}", playerhandler.Update).Methods("PUT")
+	r.HandleFunc("/players/{playerid}", playerhandler.Patch).Methods("PATCH")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+	// requests have the ETag of the current version unless they have another If-Match
+	cases := map[string]struct {
+		method, id, contentType, body string
+		ifMatch                       string
+		withoutIfMatch, token         bool
+		status                        int
+		want                          domain.Player
+	}{
+		"put": {
+			method: "PUT", id: string(id), body: `{"names": "Hugo Calderano", "wins": 5, "style": "looper"}`, token: true,
+			status: http.StatusOK, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Style: domain.OffensiveLooper}},
+		},
+		"put statistics": {
+			method: "PUT", id: string(id), body: `{"names": "Hugo Calderano", "wins": 7, "losses": 3}`, token: true,
+			status: http.StatusBadRequest, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Style: domain.OffensiveLooper}},
+		},
+		"merge patch": {
+			method: "PATCH", id: string(id), contentType: "application/merge-patch+json", body: `{"style": null, "grip": "penhold"}`, token: true,
+			status: http.StatusOK, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"patch statistics": {
+			method: "PATCH", id: string(id), body: `{"wins": 8}`, token: true,
+			status: http.StatusBadRequest, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"without token": {
+			method: "PUT", id: string(id), body: `{"names": "Ma Long"}`,
+			status: http.StatusUnauthorized, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"not valid": {
+			method: "PATCH", id: string(id), body: `{"names": null}`, token: true,
+			status: http.StatusBadRequest, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"bad merge patch": {
+			method: "PATCH", id: string(id), body: `{"grip": 1}`, token: true,
+			status: http.StatusBadRequest, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"too large": {
+			method: "PATCH", id: string(id), body: `{"names": "` + strings.Repeat("Hugo ", 20000) + `"}`, token: true,
+			status: http.StatusRequestEntityTooLarge, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"unsupported media type": {
+			method: "PATCH", id: string(id), contentType: "text/plain", body: `{"grip": "shakehand"}`, token: true,
+			status: http.StatusUnsupportedMediaType, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"without if match": {
+			method: "PUT", id: string(id), body: `{"names": "Ma Long"}`, token: true, withoutIfMatch: true,
+			status: http.StatusPreconditionRequired, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"stale version": {
+			method: "PATCH", id: string(id), body: `{"grip": "shakehand"}`, token: true, ifMatch: `"1"`,
+			status: http.StatusPreconditionFailed, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.PenholdGrip}},
+		},
+		"any version": {
+			method: "PATCH", id: string(id), body: `{"grip": "shakehand"}`, token: true, ifMatch: `"1", *`,
+			status: http.StatusOK, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.ShakehandGrip}},
+		},
+		"unknown player": {
+			method: "PUT", id: "unknown", body: `{"names": "Ma Long"}`, token: true,
+			status: http.StatusNotFound, want: domain.Player{Names: "Hugo Calderano", Wins: 5, Losses: 3, PlayerProfile: domain.PlayerProfile{Grip: domain.ShakehandGrip}},
+		},
+	}
+	// cases change the same player, so they run in order
+	for _, name := range []string{"put", "put statistics", "merge patch", "patch statistics", "without token", "not valid", "bad merge patch", "too large", "unsupported media type", "without if match", "stale version", "any version", "unknown player"} {
+		c := cases[name]
+		t.Run(name, func(t *testing.T) {
+			// Given a request to change the player.
+			req, errreq := http.NewRequest(c.method, "/players/"+c.id, strings.NewReader(c.body))
+			if errreq != nil {
+				t.Fatal(errreq)
+			}
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			if c.token {
+				req.AddCookie(tokencookie)
+			}
+			before, _ := repo.FindByID(ctx, id)
+			switch {
+			case c.ifMatch != "":
+				req.Header.Set("If-Match", c.ifMatch)
+			case !c.withoutIfMatch:
+				req.Header.Set("If-Match", fmt.Sprintf("%q", fmt.Sprint(before.Version)))
+			}
+			rr := httptest.NewRecorder()
+			// When client consumes a rest api.
+			r.ServeHTTP(rr, req)
+			// Then the status is the expected one and the player has the expected data.
+			if rr.Code != c.status {
+				t.Errorf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, c.status, rr.Body.String())
+			}
+			got, err := repo.FindByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// and only a change increases the version, which is the new ETag
+			if rr.Code == http.StatusOK {
+				if etag := rr.Header().Get("ETag"); got.Version != before.Version+1 || etag != fmt.Sprintf("%q", fmt.Sprint(got.Version)) {
+					t.Errorf("version %d with its ETag was expected, but got: %d and %s", before.Version+1, got.Version, etag)
+				}
+			} else if got.Version != before.Version {
+				t.Errorf("version %d must not change, but got: %d", before.Version, got.Version)
+			}
+			if got.Names != c.want.Names || got.Wins != c.want.Wins || got.Losses != c.want.Losses || got.PlayerProfile != c.want.PlayerProfile {
+				t.Errorf("player %+v was expected, but got: %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestDeleteAPlayer(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	player := domain.NewPlayerWithStatistics("Hugo Calderano", 5, 3)
+	if err := repo.Save(ctx, player); err != nil {
+		t.Fatalf("A player cannot be saved because of: %s", err.Error())
+	}
+	id := player.ID
+	r := mux.NewRouter()
+	r.HandleFunc("/players/{playerid}", playerhandler.Delete).Methods("DELETE")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+
+	// Given a request to delete the player without token.
+	req, _ := http.NewRequest("DELETE", "/players/"+string(id), nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	// Then it is not authorized.
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// When the player is deleted with the token.
+	req.AddCookie(tokencookie)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	// Then it is archived with its statistics.
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	got, _ := repo.FindByID(ctx, id)
+	if !got.Archived || got.Wins != 5 || got.Losses != 3 {
+		t.Errorf("player was expected to be archived with its statistics, but got: %+v", got)
+	}
+
+	// And it is not found when it is deleted again.
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestSearchPlayers(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, names := range []string{"Fan Zhendong", "Félix Lebrun", "Alexis Lebrun"} {
+		if _, err := service.Create(ctx, names, 0, 0); err != nil {
+			t.Fatalf("A player cannot be saved because of: %s", err.Error())
+		}
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/players/search", playerhandler.Search).Methods("GET")
+
+	// Given a search with one of the names in lower case.
+	req, _ := http.NewRequest("GET", "/players/search?q=zhendong", nil)
+	rr := httptest.NewRecorder()
+	// When client consumes a rest api.
+	r.ServeHTTP(rr, req)
+	// Then the player is found with its score.
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var results []domain.SearchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("search results cannot be read from %s: %s", rr.Body.String(), err)
+	}
+	if len(results) != 1 || results[0].Player.Names != "Fan Zhendong" || results[0].Score != 1 {
+		t.Errorf("Fan Zhendong was expected with score 1, but got: %+v", results)
+	}
+
+	// When the search has no accents and a limit.
+	req, _ = http.NewRequest("GET", "/players/search?q=felix+lebrun&limit=1", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	// Then the best match is the only one returned.
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Félix Lebrun") || strings.Contains(rr.Body.String(), "Alexis") {
+		t.Errorf("only Félix Lebrun was expected, but got: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// And searches that are not valid are bad requests.
+	for _, query := range []string{"", "q=", "q=ma&limit=0", "q=ma&limit=1000", "q=ma&limit=many"} {
+		req, _ = http.NewRequest("GET", "/players/search?"+query, nil)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("search %q must be a bad request, but got: %d %s", query, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestImportAndExportPlayers(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	r := mux.NewRouter()
+	r.HandleFunc("/players/import", playerhandler.Import).Methods("POST")
+	r.HandleFunc("/players/export", playerhandler.Export).Methods("GET")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+	csvfile := "names,wins,losses\nMa Long,0,0\n,0,0\nXu Xin,,\nWang Hao,3,1\n"
+	importPlayers := func(query, mediaType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/players/import"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", mediaType)
+		req.AddCookie(tokencookie)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Given a csv file imported on a dry run.
+	rr := importPlayers("?dryRun=true", "text/csv", csvfile)
+	// Then the report has the invalid lines, statistics don't come from a file, and nothing is stored.
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var report playerapp.ImportReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("import report cannot be read from %s: %s", rr.Body.String(), err)
+	}
+	if !report.DryRun || report.Imported != 2 || report.Failed != 2 || report.Errors[0].Line != 3 || report.Errors[1].Line != 5 {
+		t.Errorf("dry run with 2 players and lines 3 and 5 failed was expected, but got: %+v", report)
+	}
+	if page, _ := service.FindAll(context.TODO(), domain.PlayerQuery{}); page.Total != 0 {
+		t.Errorf("a dry run must not store players, but got: %d", page.Total)
+	}
+
+	// When the file is imported.
+	rr = importPlayers("", "text/csv; charset=utf-8", csvfile)
+	// Then the valid players are exported as ndjson.
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	req, _ := http.NewRequest("GET", "/players/export?format=ndjson", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("ndjson export was expected, but got: %d %v", rr.Code, rr.Header())
+	}
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"names":"Ma Long"`) {
+		t.Errorf("Ma Long and Xu Xin were expected, but got: %s", rr.Body.String())
+	}
+	// And as csv by default.
+	req, _ = http.NewRequest("GET", "/players/export", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "id,names,wins,losses") || !strings.Contains(rr.Body.String(), "Xu Xin") {
+		t.Errorf("csv export was expected, but got: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// And requests with unknown formats are bad requests.
+	for query, mediaType := range map[string]string{"": "application/json", "?format=xml": "text/csv", "?dryRun=maybe": "text/csv"} {
+		if rr := importPlayers(query, mediaType, csvfile); rr.Code != http.StatusBadRequest {
+			t.Errorf("import %q of %s must be a bad request, but got: %d %s", query, mediaType, rr.Code, rr.Body.String())
+		}
+	}
+	req, _ = http.NewRequest("GET", "/players/export?format=xml", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("export as xml must be a bad request, but got: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRebuildStatistics(t *testing.T) {
+	repo := repository.NewPlayerRepositoryOnMemory(1)
+	service := playerapp.NewBasicPlayerService(&repo)
+	playerhandler := port.NewPlayerRestHandler(service)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id, err := service.Create(ctx, "Hugo Calderano", 0, 0)
+	if err != nil {
+		t.Fatalf("A player cannot be saved because of: %s", err.Error())
+	}
+	rival, err := service.Create(ctx, "Fan Zhendong", 0, 0)
+	if err != nil {
+		t.Fatalf("A player cannot be saved because of: %s", err.Error())
+	}
+	if err := service.UpdateStatistics(ctx, *playerapp.NewPlayerStatistics(id, rival, 1, 1)); err != nil {
+		t.Fatalf("The match cannot be recorded because of: %s", err.Error())
+	}
+	tampered, _ := repo.FindByID(ctx, id)
+	tampered.Wins = 50
+	if err := repo.Update(ctx, &tampered); err != nil {
+		t.Fatalf("A player cannot be updated because of: %s", err.Error())
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/players/statistics/rebuild", playerhandler.RebuildStatistics).Methods("POST")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+
+	// Given a request to rebuild the statistics without token.
+	req, _ := http.NewRequest("POST", "/players/statistics/rebuild", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	// Then it is not authorized.
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// When the statistics on memory are rebuilt with the token but without force.
+	req.AddCookie(tokencookie)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	// Then they are not rebuilt.
+	if rr.Code != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+
+	// When they are rebuilt with force.
+	req, _ = http.NewRequest("POST", "/players/statistics/rebuild?force=true", nil)
+	req.AddCookie(tokencookie)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	// Then the player has the statistics of the log again.
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"entries":1,"players":1}` {
+		t.Errorf("rebuild of 1 entry and 1 player was expected, but got: %d %s", rr.Code, rr.Body.String())
+	}
+	if got, _ := repo.FindByID(ctx, id); got.Wins != 1 || got.Losses != 0 {
+		t.Errorf("player was expected with 1 win, but got: %+v", got)
+	}
+}
@@ -0,0 +1,71 @@
+package port_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fernandoocampo/thepingthepong/application/webhookapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/fernandoocampo/thepingthepong/port"
+	"github.com/gorilla/mux"
+)
+
+func TestManageWebhookSubscriptions(t *testing.T) {
+	service := webhookapp.NewBasicWebhookService(domain.WebhookSetting{})
+	webhookhandler := port.NewWebhookRestHandler(service)
+	r := mux.NewRouter()
+	r.HandleFunc("/webhooks", webhookhandler.Create).Methods("POST")
+	r.HandleFunc("/webhooks/{id}", webhookhandler.GetByID).Methods("GET")
+	r.HandleFunc("/webhooks/{id}", webhookhandler.Delete).Methods("DELETE")
+	r.HandleFunc("/webhooks/{id}/deliveries", webhookhandler.Deliveries).Methods("GET")
+	tokencookie, tokenok := generateToken(t)
+	if !tokenok {
+		t.Fatalf("token cannot be generated, we got this token")
+	}
+	serve := func(method, url, body string, withToken bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		assertNoError(t, err)
+		if withToken {
+			req.AddCookie(tokencookie)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	subscription := `{"url": "http://bots.local/hook", "events": ["match.completed"]}`
+
+	// Given a client without token, it cannot subscribe.
+	if rr := serve("POST", "/webhooks", subscription, false); rr.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	// When a client subscribes to an unknown event, the subscription is rejected.
+	if rr := serve("POST", "/webhooks", `{"url": "http://bots.local/hook", "events": ["unknown"]}`, true); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	// When a client subscribes, it gets the secret to check the signatures.
+	rr := serve("POST", "/webhooks", subscription, true)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var created webhookapp.Subscription
+	assertNoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	if created.ID == "" || created.Secret == "" {
+		t.Fatalf("a subscription with id and secret was expected, but got: %+v", created)
+	}
+	// Then the subscription and its deliveries can be queried and deleted.
+	if rr := serve("GET", "/webhooks/"+string(created.ID), "", true); rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := serve("GET", "/webhooks/"+string(created.ID)+"/deliveries", "", true); rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := serve("DELETE", "/webhooks/"+string(created.ID), "", true); rr.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := serve("GET", "/webhooks/"+string(created.ID), "", true); rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,196 @@
+package port
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/fernandoocampo/thepingthepong/application/webhookapp"
+	"github.com/fernandoocampo/thepingthepong/domain"
+	"github.com/gorilla/mux"
+)
+
+// newSubscription contains data to create or update a webhook subscription
+type newSubscription struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"` // generated when a subscription is created without it
+}
+
+// toSubscription converts the request into a subscription with the given id.
+func (n newSubscription) toSubscription(id domain.Key) webhookapp.Subscription {
+	return webhookapp.Subscription{
+		ID:     id,
+		URL:    n.URL,
+		Events: n.Events,
+		Secret: n.Secret,
+	}
+}
+
+// webhookRestHandler implements rest handler to manage webhook subscriptions
+type webhookRestHandler struct {
+	service webhookapp.WebhookService
+}
+
+// NewWebhookRestHandler creates a rest handler for webhook subscriptions
+func NewWebhookRestHandler(webhookService webhookapp.WebhookService) WebhookHandler {
+	log.Infof("creating webhook rest handler")
+	return &webhookRestHandler{
+		service: webhookService,
+	}
+}
+
+// GetAll get all the webhook subscriptions
+func (h *webhookRestHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting get all handler for webhook rest handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	subscriptions, err := h.service.FindAll(ctx)
+	if err != nil {
+		log.Errorf("something goes wrong on service to get all webhook subscriptions: %s", err.Error())
+		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, subscriptions)
+}
+
+// GetByID get a webhook subscription by id
+func (h *webhookRestHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting get by id handler for webhook rest handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	id := mux.Vars(r)["id"]
+	subscription, err := h.service.FindByID(ctx, domain.Key(id))
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, subscription)
+}
+
+// Create creates a webhook subscription and responds it with its secret
+func (h *webhookRestHandler) Create(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting create handler for webhook rest handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	defer r.Body.Close()
+	var subscription newSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		log.Warnf("payload to create webhook subscription is bad: %s", err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	created, err := h.service.Create(ctx, subscription.toSubscription(""))
+	if err != nil {
+		log.Errorf("something goes wrong at service to create webhook subscription: %v, got: %s", subscription, err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	RespondRestWithJSON(w, http.StatusCreated, created)
+}
+
+// Update updates the url, events and optionally the secret of a webhook subscription
+func (h *webhookRestHandler) Update(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting update handler for webhook rest handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	defer r.Body.Close()
+	var subscription newSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		log.Warnf("payload to update webhook subscription is bad: %s", err.Error())
+		RespondRestWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	id := mux.Vars(r)["id"]
+	updated, err := h.service.Update(ctx, subscription.toSubscription(domain.Key(id)))
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, updated)
+}
+
+// Delete deletes a webhook subscription
+func (h *webhookRestHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting delete handler for webhook rest handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	id := mux.Vars(r)["id"]
+	if err := h.service.Delete(ctx, domain.Key(id)); err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries returns the latest delivery attempts of a webhook subscription
+func (h *webhookRestHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting deliveries handler for webhook rest handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	id := mux.Vars(r)["id"]
+	deliveries, err := h.service.Deliveries(ctx, domain.Key(id))
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, deliveries)
+}
+
+// DeadLetters returns the latest events that could not be delivered
+func (h *webhookRestHandler) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	log.Info("starting dead letters handler for webhook rest handler")
+	if status, ok := validateToken(r); !ok {
+		w.WriteHeader(status.StatusCode)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	letters, err := h.service.DeadLetters(ctx)
+	if err != nil {
+		log.Errorf("something goes wrong on service to get webhook dead letters: %s", err.Error())
+		RespondRestWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	RespondRestWithJSON(w, http.StatusOK, letters)
+}
+
+// Health returns the health of this service
+func (h *webhookRestHandler) Health(w http.ResponseWriter, r *http.Request) {
+	panic("not implemented")
+}
+
+// respondWebhookError responds not found for unknown subscriptions and bad request
+// for any other error, which comes from the validation of the subscription.
+func respondWebhookError(w http.ResponseWriter, err error) {
+	if err == webhookapp.ErrSubscriptionNotFound {
+		RespondRestWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Warnf("webhook subscription request is not valid: %s", err.Error())
+	RespondRestWithError(w, http.StatusBadRequest, err.Error())
+}
@@ -14,18 +14,22 @@ type WebServer interface {
 }
 
 type restServer struct {
-	playerRestHandler RestHandler
-	matchRestHandler  RestHandler
-	authRestHandler   AuthHandler
+	playerRestHandler  PlayerHandler
+	matchRestHandler   MatchHandler
+	authRestHandler    AuthHandler
+	eventRestHandler   EventHandler
+	webhookRestHandler WebhookHandler
 }
 
 // NewWebServer instance of a person handler
-func NewWebServer(playerHandler RestHandler, matchHandler RestHandler, authHandler AuthHandler) WebServer {
+func NewWebServer(playerHandler PlayerHandler, matchHandler MatchHandler, authHandler AuthHandler, eventHandler EventHandler, webhookHandler WebhookHandler) WebServer {
 	log.Infof("creating web server")
 	return &restServer{
-		playerRestHandler: playerHandler,
-		matchRestHandler:  matchHandler,
-		authRestHandler:   authHandler,
+		playerRestHandler:  playerHandler,
+		matchRestHandler:   matchHandler,
+		authRestHandler:    authHandler,
+		eventRestHandler:   eventHandler,
+		webhookRestHandler: webhookHandler,
 	}
 }
 
@@ -34,11 +38,15 @@ func NewWebServer(playerHandler RestHandler, matchHandler RestHandler, authHandl
 func (w *restServer) StartWebServer(port string) {
 	router := newRouter(w.playerRestHandler,
 		w.matchRestHandler,
-		w.authRestHandler)
+		w.authRestHandler,
+		w.eventRestHandler,
+		w.webhookRestHandler)
 
 	log.Infof("Starting HTTP service at %s", port)
 	originsOk := handlers.AllowedOrigins([]string{"*"})
-	err := http.ListenAndServe(":"+port, handlers.CORS(originsOk)(router))
+	// browsers only let scripts read the headers that are exposed
+	exposedOk := handlers.ExposedHeaders([]string{totalCount, nextCursor, etag})
+	err := http.ListenAndServe(":"+port, handlers.CORS(originsOk, exposedOk)(router))
 
 	if err != nil {
 		log.Panicf("An error occured starting HTTP listener at port %s, error %s", port, err)
@@ -46,7 +54,7 @@ func (w *restServer) StartWebServer(port string) {
 }
 
 // NewRouter returns a pointer to a mux.Router we can use as a handler.
-func newRouter(playerHandler RestHandler, matchHandler RestHandler, authHandler AuthHandler) *mux.Router {
+func newRouter(playerHandler PlayerHandler, matchHandler MatchHandler, authHandler AuthHandler, eventHandler EventHandler, webhookHandler WebhookHandler) *mux.Router {
 	log.Info("Creating router handler")
 	// Create an instance of the Gorilla router
 	// Gorilla router matches incoming requests against a list of
@@ -60,6 +68,18 @@ func newRouter(playerHandler RestHandler, matchHandler RestHandler, authHandler
 		Name("getAllPlayers").
 		HandlerFunc(playerHandler.GetAll)
 
+	// Search players by names, before the player id takes the path
+	router.Methods("GET").
+		Path("/players/search").
+		Name("searchPlayers").
+		HandlerFunc(playerHandler.Search)
+
+	// Export all players as a file, before the player id takes the path
+	router.Methods("GET").
+		Path("/players/export").
+		Name("exportPlayers").
+		HandlerFunc(playerHandler.Export)
+
 	// Get player by id
 	router.Methods("GET").
 		Path("/players/{playerid}").
@@ -72,12 +92,120 @@ func newRouter(playerHandler RestHandler, matchHandler RestHandler, authHandler
 		Name("createPlayer").
 		HandlerFunc(playerHandler.Create)
 
+	// Post a file of players to create them
+	router.Methods("POST").
+		Path("/players/import").
+		Name("importPlayers").
+		HandlerFunc(playerHandler.Import)
+
+	// Post to rebuild the statistics of the players from the statistics log
+	router.Methods("POST").
+		Path("/players/statistics/rebuild").
+		Name("rebuildStatistics").
+		HandlerFunc(playerHandler.RebuildStatistics)
+
+	// Put to replace the data of a player
+	router.Methods("PUT").
+		Path("/players/{playerid}").
+		Name("updatePlayer").
+		HandlerFunc(playerHandler.Update)
+
+	// Patch to change the data of a player with a JSON merge patch
+	router.Methods("PATCH").
+		Path("/players/{playerid}").
+		Name("patchPlayer").
+		HandlerFunc(playerHandler.Patch)
+
+	// Delete to archive a player
+	router.Methods("DELETE").
+		Path("/players/{playerid}").
+		Name("deletePlayer").
+		HandlerFunc(playerHandler.Delete)
+
+	// Get the published variables, like the statistics of the cache of players
+	router.Methods("GET").
+		Path("/debug/vars").
+		Name("debugVars").
+		HandlerFunc(DebugVars)
+
 	// Post to create a player
 	router.Methods("POST").
 		Path("/matches").
 		Name("playMatch").
 		HandlerFunc(matchHandler.Create)
 
+	// Get the estimated outcome of a match, or post it with the tactics of the players
+	router.Methods("GET", "POST").
+		Path("/matches/preview").
+		Name("previewMatch").
+		HandlerFunc(matchHandler.Preview)
+
+	// Follow the events of a live match over a websocket
+	router.Methods("GET").
+		Path("/matches/{id}/live").
+		Name("liveMatch").
+		HandlerFunc(matchHandler.Live)
+
+	// Get the status and result of a match job
+	router.Methods("GET").
+		Path("/jobs/{id}").
+		Name("getJob").
+		HandlerFunc(matchHandler.GetJob)
+
+	// Delete to cancel a queued match job
+	router.Methods("DELETE").
+		Path("/jobs/{id}").
+		Name("cancelJob").
+		HandlerFunc(matchHandler.CancelJob)
+
+	// Stream the events of the application as server-sent events
+	router.Methods("GET").
+		Path("/events").
+		Name("events").
+		HandlerFunc(eventHandler.Events)
+
+	// Get all the webhook subscriptions
+	router.Methods("GET").
+		Path("/webhooks").
+		Name("getAllWebhooks").
+		HandlerFunc(webhookHandler.GetAll)
+
+	// Post to create a webhook subscription
+	router.Methods("POST").
+		Path("/webhooks").
+		Name("createWebhook").
+		HandlerFunc(webhookHandler.Create)
+
+	// Get the events that could not be delivered to webhooks
+	router.Methods("GET").
+		Path("/webhooks/dead-letters").
+		Name("getWebhookDeadLetters").
+		HandlerFunc(webhookHandler.DeadLetters)
+
+	// Get webhook subscription by id
+	router.Methods("GET").
+		Path("/webhooks/{id}").
+		Name("getWebhookById").
+		HandlerFunc(webhookHandler.GetByID)
+
+	// Put to update a webhook subscription
+	router.Methods("PUT").
+		Path("/webhooks/{id}").
+		Name("updateWebhook").
+		HandlerFunc(webhookHandler.Update)
+
+	// Delete a webhook subscription
+	router.Methods("DELETE").
+		Path("/webhooks/{id}").
+		Name("deleteWebhook").
+		HandlerFunc(webhookHandler.Delete)
+
+	// Get the latest deliveries of a webhook subscription
+	router.Methods("GET").
+		Path("/webhooks/{id}/deliveries").
+		Name("getWebhookDeliveries").
+		HandlerFunc(webhookHandler.Deliveries)
+
 	// Post to sign an user
 	router.Methods("POST").
 		Path("/signin").